@@ -0,0 +1,29 @@
+package athena
+
+import "io"
+
+//Codec convert raw bytes to event messages and back, shared by sources and sinks
+type Codec interface {
+	//PropertiesDef return codec properties defend, names are prefixed by codec name
+	PropertiesDef() PropertiesDef
+	//ContentType is the media type of encoded bytes
+	ContentType() string
+	//NewDecoder create decoder of the component properties
+	NewDecoder(ps Properties) (Decoder, error)
+	//NewEncoder create encoder writing to w of the component properties
+	NewEncoder(ps Properties, w io.Writer) (Encoder, error)
+}
+
+type Decoder interface {
+	//Decode one payload to messages, line framed codecs return a message per record
+	Decode(data []byte) ([]any, error)
+}
+
+type Encoder interface {
+	//Encode write one message to the writer without buffering
+	Encode(message any) error
+	//Flush write trailing bytes like closing bracket, the encoder is not used after Flush
+	Flush() error
+}
+
+type NewCodecFunc func() Codec
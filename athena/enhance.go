@@ -1,5 +1,7 @@
 package athena
 
+import "sync"
+
 //Stateful is event trans mode, for snapshot mode
 type Stateful interface {
 	//Snapshot will snapshot  component state after close
@@ -8,3 +10,46 @@ type Stateful interface {
 	//Restore will restore component state after open
 	Restore(snapshot []byte) error
 }
+
+//Failing is the sink which can fail at runtime, like losing its connection,
+//the failed sink is closed and restarted by restart policy, upstream is blocked meanwhile
+type Failing interface {
+	//Failed return the channel of runtime failure, it's called after every open
+	Failed() <-chan error
+}
+
+//Failures implement Failing by consecutive failures, the sink fails when they reach max, 0 max is disabled
+type Failures struct {
+	max    int
+	count  int
+	failed chan error
+	mutex  sync.Mutex
+}
+
+func NewFailures(max int) *Failures {
+	return &Failures{max: max, failed: make(chan error, 1)}
+}
+
+func (f *Failures) Failed() <-chan error {
+	return f.failed
+}
+
+//Succeed reset the consecutive failures
+func (f *Failures) Succeed() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.count = 0
+}
+
+//Fail count the failure, the sink fails with err if consecutive failures reach max
+func (f *Failures) Fail(err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.count++; f.max <= 0 || f.count < f.max {
+		return
+	}
+	select {
+	case f.failed <- err:
+	default:
+	}
+}
@@ -16,19 +16,40 @@ type Event struct {
 
 const (
 	PrivateACKHandler = "$private_ack_handler"
+	//PrivateNACKHandler is called before ACKHandler if event is nacked
+	PrivateNACKHandler = "$private_nack_handler"
+	//PrivateTrace is the trace context of sampled event
+	PrivateTrace = "$private_trace"
+	//ACKObserverKey is context kv key of ACKObserver
+	ACKObserverKey = "$ack_observer"
 )
 
 type ACKHandler func()
 
+//ACKObserver is notified of every ack result of the component
+type ACKObserver func(event *Event, ok bool)
+
 type ACKer interface {
 	OnACK(event *Event, ok bool)
 	Close()
 }
 
-type simpleACKer struct{}
+type simpleACKer struct {
+	observer ACKObserver
+}
 
-func (n *simpleACKer) OnACK(event *Event, _ bool) {
+func (n *simpleACKer) OnACK(event *Event, ok bool) {
+	if n.observer != nil {
+		n.observer(event, ok)
+	}
 	if event.Private != nil {
+		if !ok {
+			if nackHandler, exists := event.Private[PrivateNACKHandler]; exists {
+				if handler, exists := nackHandler.(ACKHandler); exists {
+					handler()
+				}
+			}
+		}
 		if ackHandler, ok := event.Private[PrivateACKHandler]; ok {
 			if handler, ok := ackHandler.(ACKHandler); ok {
 				handler()
@@ -40,6 +61,10 @@ func (n *simpleACKer) OnACK(event *Event, _ bool) {
 
 func (n *simpleACKer) Close() {}
 
-func NewACKer() ACKer {
+//NewACKer create ACKer of the component, ctx ACKObserver will be notified if stored
+func NewACKer(ctx Context) ACKer {
+	if observer, ok := ctx.Load(ACKObserverKey); ok {
+		return &simpleACKer{observer: observer.(ACKObserver)}
+	}
 	return &simpleACKer{}
 }
@@ -14,6 +14,10 @@ type Properties interface {
 	GetInt(property Property) int
 	GetUint64(property Property) uint64
 	GetDuration(property Property) time.Duration
+	GetBool(property Property) bool
+	GetFloat64(property Property) float64
+	GetStringMap(property Property) map[string]any
+	AllSettings() map[string]any
 }
 
 type Property interface {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"athena/athena"
+	"athena/lib/codec"
 	"athena/lib/component"
 	"athena/lib/properties"
 	"fmt"
@@ -11,8 +12,8 @@ import (
 func init() {
 	Command.AddCommand(&cobra.Command{
 		Use:   "component",
-		Short: "list athena source operator sink.",
-		Long:  `list athena source operator sink.`,
+		Short: "list athena source operator sink codec.",
+		Long:  `list athena source operator sink codec.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) < 1 {
 				panic("inventory type can't be nil.")
@@ -26,6 +27,8 @@ func init() {
 				defs = component.ListOperatorDef()
 			case "sink":
 				defs = component.ListSinkDef()
+			case "codec":
+				defs = codec.ListCodecDef()
 			default:
 				panic("unknown component type.")
 			}
@@ -1,24 +1,52 @@
 package main
 
 import (
+	"athena/lib/properties"
 	"athena/lib/runtime"
 	_c "context"
+	"fmt"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-	"path"
 )
 
 func init() {
-	Command.AddCommand(&cobra.Command{
-		Use:   "run",
-		Short: "run [config file]",
-		Long:  `config source operator sink, start vesta`,
-		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) == 0 {
-				panic("config file can't be nil")
+	var (
+		sets         []string
+		profile      string
+		configFormat string
+		dryRun       bool
+	)
+	command := &cobra.Command{
+		Use:           "run [config file]",
+		Short:         "run [config file]",
+		Long:          `config source operator sink, start vesta`,
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ps, err := properties.New(args[0], properties.Options{
+				Format:    configFormat,
+				Profile:   profile,
+				Overrides: sets,
+			})
+			if err != nil {
+				return errors.WithMessagef(err, "can't load config %s", args[0])
+			}
+			e := runtime.New(_c.Background(), ps)
+			if dryRun {
+				if err = e.Build(); err != nil {
+					return err
+				}
+				fmt.Print(e.RenderTopology())
+				return nil
 			}
-			configFilePath := args[0]
-			e := runtime.New(_c.Background(), path.Base(configFilePath), path.Ext(configFilePath)[1:], path.Dir(configFilePath))
 			e.Run()
+			return nil
 		},
-	})
+	}
+	command.Flags().StringArrayVar(&sets, "set", nil, "override config value, key=value, e.g. sink.echo.batch=10")
+	command.Flags().StringVar(&profile, "profile", "", "merge the [profile.<name>] overlay into config")
+	command.Flags().StringVar(&configFormat, "config-format", "", "config format, default is the config file extension")
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "build and validate the topology, print it and exit")
+	Command.AddCommand(command)
 }
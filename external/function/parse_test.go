@@ -0,0 +1,27 @@
+package function
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseOrigin(t *testing.T) {
+	edge := `1.2.3.4 example.com "text/html" [10/Oct/2022:13:55:36 +0800] "GET /a HTTP/1.1" 200 512 "-" "curl/7.68.0" 15 256 0 "-" "-" a@b c@d 10.0.0.1 - HIT L1 x`
+	parsed, err := ParseOrigin("origin-1 " + edge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed["host"] != "origin-1" || parsed["http_code"] != int64(200) || parsed["url"] != "/a" {
+		t.Fatalf("unexpected parsed %v", parsed)
+	}
+	if parsed, err = ParseEdgeOrigin(edge); err != nil || parsed["client_ip"] != "1.2.3.4" {
+		t.Fatalf("unexpected parsed %v %v", parsed, err)
+	}
+	//truncated lines keep the deprecated error
+	if _, err = ParseOrigin("origin-1"); !errors.Is(err, ErrIllegalFieldCount) {
+		t.Fatalf("expected %v, got %v", ErrIllegalFieldCount, err)
+	}
+	if _, err = ParseEdgeOrigin(`1.2.3.4 example.com "text/html"`); !errors.Is(err, ErrIllegalFieldCount) {
+		t.Fatalf("expected %v, got %v", ErrIllegalFieldCount, err)
+	}
+}
@@ -0,0 +1,159 @@
+package codec
+
+import (
+	"athena/athena"
+	"athena/lib/properties"
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+const (
+	PayloadMessage = "message"
+	PayloadEvent   = "event"
+
+	//MetaDecodeError is the meta of event not decoded
+	MetaDecodeError = "decode_error"
+
+	linesCodec = "lines"
+)
+
+var (
+	codecMap = map[string]athena.NewCodecFunc{}
+
+	ErrUnknownCodec   = fmt.Errorf("unknown codec")
+	ErrUnknownPayload = fmt.Errorf("unknown payload")
+	ErrMessageCount   = fmt.Errorf("line should be decoded to exactly one message")
+)
+
+func RegisterNewCodecFunc(name string, codecFunc athena.NewCodecFunc) {
+	codecMap[name] = codecFunc
+}
+
+func NewCodecFunc(name string) athena.NewCodecFunc {
+	return codecMap[name]
+}
+
+func ListCodecDef() map[string]athena.PropertiesDef {
+	codecDefMap := map[string]athena.PropertiesDef{}
+	for name, codecFunc := range codecMap {
+		codecDefMap[name] = codecFunc().PropertiesDef()
+	}
+	return codecDefMap
+}
+
+//Property return the codec property of component with its default codec
+func Property(defaultCodec string) athena.Property {
+	return properties.NewProperty[string]("codec", "codec name, see athena component codec", defaultCodec)
+}
+
+//PayloadProperty return the payload property of sink with its default payload
+func PayloadProperty(defaultPayload string) athena.Property {
+	return properties.NewProperty[string]("payload", "encoded value of event, message or event(meta message time)", defaultPayload)
+}
+
+//New return the codec named by the property, properties of the codec are initialized
+func New(ps athena.Properties, property athena.Property) (athena.Codec, error) {
+	return Load(ps, ps.GetString(property))
+}
+
+//Load return the named codec and init its properties of component, codec properties are not in component PropertiesDef
+func Load(ps athena.Properties, name string) (athena.Codec, error) {
+	c, err := Named(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = properties.InitAndRender(ps, c.PropertiesDef()); err != nil {
+		return nil, errors.WithMessagef(err, "can't init %s codec properties", name)
+	}
+	return c, nil
+}
+
+func Named(name string) (athena.Codec, error) {
+	codecFunc, ok := codecMap[name]
+	if !ok {
+		return nil, errors.WithMessage(ErrUnknownCodec, name)
+	}
+	return codecFunc(), nil
+}
+
+//LineCodec is the codec decoding lines in its own way, as every line is decoded alone, like csv has no header in lines
+type LineCodec interface {
+	NewLineDecoder(ps athena.Properties) (athena.Decoder, error)
+}
+
+//LineDecoder decode one line of line oriented sources to one message, so acks of lines are kept
+type LineDecoder struct {
+	//decoder is nil for lines codec, the line is the message
+	decoder athena.Decoder
+}
+
+//NewLineDecoder create the line decoder of codec property, empty codec is lines
+func NewLineDecoder(ps athena.Properties, property athena.Property) (*LineDecoder, error) {
+	name := ps.GetString(property)
+	if name == "" || name == linesCodec {
+		return &LineDecoder{}, nil
+	}
+	c, err := Load(ps, name)
+	if err != nil {
+		return nil, err
+	}
+	var decoder athena.Decoder
+	if lineCodec, ok := c.(LineCodec); ok {
+		decoder, err = lineCodec.NewLineDecoder(ps)
+	} else {
+		decoder, err = c.NewDecoder(ps)
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "can't create %s decoder", name)
+	}
+	return &LineDecoder{decoder: decoder}, nil
+}
+
+//Decode return the message of line, the line is returned with error if it's not decoded to exactly one message
+func (d *LineDecoder) Decode(line string) (any, error) {
+	if d.decoder == nil {
+		return line, nil
+	}
+	messages, err := d.decoder.Decode([]byte(line))
+	if err != nil {
+		return line, err
+	}
+	if len(messages) != 1 {
+		return line, errors.WithMessagef(ErrMessageCount, "%d messages", len(messages))
+	}
+	return messages[0], nil
+}
+
+//Value return the value of event to encode by payload
+func Value(event *athena.Event, payload string) any {
+	if payload == PayloadEvent {
+		return map[string]any{"meta": event.Meta, "message": event.Message, "time": event.Time}
+	}
+	return event.Message
+}
+
+func CheckPayload(payload string) error {
+	switch payload {
+	case PayloadMessage, PayloadEvent:
+		return nil
+	}
+	return errors.WithMessage(ErrUnknownPayload, payload)
+}
+
+//Lines call fn with every non empty line of data, trailing \r is trimmed
+func Lines(data []byte, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := bytes.TrimRight(scanner.Bytes(), "\r")
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
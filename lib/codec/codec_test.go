@@ -0,0 +1,46 @@
+package codec_test
+
+import (
+	"athena/lib/codec"
+	_ "athena/lib/codec/json"
+	"athena/lib/properties"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLineDecoder(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "athena.toml")
+	if err := os.WriteFile(file, []byte("[source.a]\ncodec = \"ndjson\"\n[source.b]\ntype = \"tail\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := properties.New(file, properties.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	property := codec.Property("lines")
+	//lines codec keep the line as is
+	lines, err := codec.NewLineDecoder(p.Sub("source.b"), property)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message, err := lines.Decode(`{"a":1}`); err != nil || message != `{"a":1}` {
+		t.Fatalf("line is changed, got %v %v", message, err)
+	}
+	decoder, err := codec.NewLineDecoder(p.Sub("source.a"), property)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message, err := decoder.Decode(`{"a":1}`); err != nil || !reflect.DeepEqual(message, map[string]any{"a": 1.0}) {
+		t.Fatalf("line is not decoded, got %v %v", message, err)
+	}
+	//the line is kept if it can't be decoded
+	if message, err := decoder.Decode(`{"a":`); err == nil || message != `{"a":` {
+		t.Fatalf("invalid line should be kept with error, got %v %v", message, err)
+	}
+	if message, err := decoder.Decode(" "); !errors.Is(err, codec.ErrMessageCount) || message != " " {
+		t.Fatalf("blank line should be kept with count error, got %v %v", message, err)
+	}
+}
@@ -0,0 +1,229 @@
+package csv
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"athena/lib/properties"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	FieldsProperty = properties.NewProperty[[]string]("csv-fields",
+		"column names, dotted path like meta.host is looked up in nested map when encoding, header or first row is used if empty, required by line sources", []string{})
+	HeaderProperty    = properties.NewProperty[bool]("csv-header", "first row is header when decoding, write header when encoding", true)
+	DelimiterProperty = properties.NewProperty[string]("csv-delimiter", "delimiter of csv, tsv always uses tab", ",")
+
+	ErrInvalidDelimiter = fmt.Errorf("csv delimiter should be one character")
+	ErrNoFields         = fmt.Errorf("csv-fields is required to encode map message")
+	ErrNoLineFields     = fmt.Errorf("csv-fields is required to decode lines, lines have no header")
+)
+
+//csvCodec decode records to map by column names, or string list if no names, encode map by column names
+type csvCodec struct {
+	tsv bool
+}
+
+func (c csvCodec) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{FieldsProperty, HeaderProperty, DelimiterProperty}
+}
+
+func (c csvCodec) ContentType() string {
+	if c.tsv {
+		return "text/tab-separated-values"
+	}
+	return "text/csv"
+}
+
+func (c csvCodec) delimiter(ps athena.Properties) (rune, error) {
+	if c.tsv {
+		return '\t', nil
+	}
+	delimiter := ps.GetString(DelimiterProperty)
+	if utf8.RuneCountInString(delimiter) != 1 {
+		return 0, errors.WithMessage(ErrInvalidDelimiter, delimiter)
+	}
+	r, _ := utf8.DecodeRuneInString(delimiter)
+	return r, nil
+}
+
+func (c csvCodec) NewDecoder(ps athena.Properties) (athena.Decoder, error) {
+	delimiter, err := c.delimiter(ps)
+	if err != nil {
+		return nil, err
+	}
+	return &decoder{delimiter: delimiter, lazyQuotes: c.tsv, fields: ps.GetStringSlice(FieldsProperty), header: ps.GetBool(HeaderProperty)}, nil
+}
+
+//NewLineDecoder decode every line as a record, csv-header is ignored as each line is decoded alone
+func (c csvCodec) NewLineDecoder(ps athena.Properties) (athena.Decoder, error) {
+	delimiter, err := c.delimiter(ps)
+	if err != nil {
+		return nil, err
+	}
+	fields := ps.GetStringSlice(FieldsProperty)
+	if len(fields) == 0 {
+		return nil, ErrNoLineFields
+	}
+	return &decoder{delimiter: delimiter, lazyQuotes: c.tsv, fields: fields}, nil
+}
+
+func (c csvCodec) NewEncoder(ps athena.Properties, w io.Writer) (athena.Encoder, error) {
+	delimiter, err := c.delimiter(ps)
+	if err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+	fields := ps.GetStringSlice(FieldsProperty)
+	return &encoder{w: writer, fields: fields, header: ps.GetBool(HeaderProperty) && len(fields) > 0, record: make([]string, len(fields))}, nil
+}
+
+type decoder struct {
+	delimiter  rune
+	lazyQuotes bool
+	fields     []string
+	header     bool
+}
+
+func (d *decoder) Decode(data []byte) ([]any, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = d.delimiter
+	reader.LazyQuotes = d.lazyQuotes
+	reader.FieldsPerRecord = -1
+	fields := d.fields
+	skipHeader := d.header
+	var messages []any
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return messages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if skipHeader {
+			skipHeader = false
+			if len(fields) == 0 {
+				fields = record
+			}
+			continue
+		}
+		if len(fields) == 0 {
+			values := make([]any, len(record))
+			for i, value := range record {
+				values[i] = value
+			}
+			messages = append(messages, values)
+			continue
+		}
+		message := make(map[string]any, len(fields))
+		for i, field := range fields {
+			if i < len(record) {
+				message[field] = record[i]
+			}
+		}
+		messages = append(messages, message)
+	}
+}
+
+type encoder struct {
+	w      *csv.Writer
+	fields []string
+	header bool
+	record []string
+}
+
+func (e *encoder) Encode(message any) error {
+	if _, ok := message.(map[string]any); ok && len(e.fields) == 0 {
+		return ErrNoFields
+	}
+	if e.header {
+		e.header = false
+		if err := e.w.Write(e.fields); err != nil {
+			return err
+		}
+	}
+	if err := e.w.Write(e.toRecord(message)); err != nil {
+		return err
+	}
+	//flush every record, encoders don't buffer
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *encoder) toRecord(message any) []string {
+	switch value := message.(type) {
+	case []string:
+		return value
+	case []any:
+		record := make([]string, len(value))
+		for i, v := range value {
+			record[i] = format(v)
+		}
+		return record
+	}
+	for i, field := range e.fields {
+		e.record[i] = format(lookup(message, field))
+	}
+	return e.record
+}
+
+func (e *encoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+//lookup the dotted path in nested map, the whole path is tried first as key may contain dot
+func lookup(value any, path string) any {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil
+	}
+	if v, ok := m[path]; ok {
+		return v
+	}
+	index := strings.Index(path, ".")
+	if index < 0 {
+		return nil
+	}
+	return lookup(m[path[:index]], path[index+1:])
+}
+
+func format(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case map[string]any, []any, map[string]string:
+		text, _ := json.Marshal(v)
+		return string(text)
+	}
+	return cast.ToString(value)
+}
+
+func NewCSV() athena.Codec {
+	return csvCodec{}
+}
+
+func NewTSV() athena.Codec {
+	return csvCodec{tsv: true}
+}
+
+func init() {
+	codec.RegisterNewCodecFunc("csv", NewCSV)
+	codec.RegisterNewCodecFunc("tsv", NewTSV)
+}
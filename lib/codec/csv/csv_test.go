@@ -0,0 +1,144 @@
+package csv
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"athena/lib/properties"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//newProperties return the properties of codec config like csv-header = false
+func newProperties(t *testing.T, config string) athena.Properties {
+	file := filepath.Join(t.TempDir(), "athena.toml")
+	if err := os.WriteFile(file, []byte("[codec]\n"+config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := properties.New(file, properties.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := p.Sub("codec")
+	if _, err = properties.InitAndRender(ps, NewCSV().PropertiesDef()); err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
+
+func encode(t *testing.T, c athena.Codec, ps athena.Properties, messages ...any) string {
+	var buffer bytes.Buffer
+	encoder, err := c.NewEncoder(ps, &buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range messages {
+		if err = encoder.Encode(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = encoder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.String()
+}
+
+func decode(t *testing.T, c athena.Codec, ps athena.Properties, data string) []any {
+	decoder, err := c.NewDecoder(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := decoder.Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+func TestRoundTrip(t *testing.T) {
+	ps := newProperties(t, `csv-fields = ["a", "meta.host"]`)
+	encoded := encode(t, NewCSV(), ps,
+		map[string]any{"a": "x,y", "meta": map[string]any{"host": "h1"}},
+		map[string]any{"a": 1, "meta.host": "h2"},
+		[]any{"raw", true})
+	if expected := "a,meta.host\n\"x,y\",h1\n1,h2\nraw,true\n"; encoded != expected {
+		t.Fatalf("expected %q, got %q", expected, encoded)
+	}
+	expected := []any{
+		map[string]any{"a": "x,y", "meta.host": "h1"},
+		map[string]any{"a": "1", "meta.host": "h2"},
+		map[string]any{"a": "raw", "meta.host": "true"},
+	}
+	if decoded := decode(t, NewCSV(), ps, encoded); !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("expected %v, got %v", expected, decoded)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	//header names the columns if fields is empty, short records miss the keys
+	decoded := decode(t, NewCSV(), newProperties(t, ""), "a,b\n1,2\n3\n")
+	if expected := []any{map[string]any{"a": "1", "b": "2"}, map[string]any{"a": "3"}}; !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("expected %v, got %v", expected, decoded)
+	}
+	//header is skipped if fields is set
+	decoded = decode(t, NewCSV(), newProperties(t, `csv-fields = ["x"]`), "a\n1\n")
+	if expected := []any{map[string]any{"x": "1"}}; !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("expected %v, got %v", expected, decoded)
+	}
+	//records are lists without header and fields
+	ps := newProperties(t, "csv-header = false\ncsv-delimiter = \";\"")
+	decoded = decode(t, NewCSV(), ps, "1;2\n")
+	if expected := []any{[]any{"1", "2"}}; !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("expected %v, got %v", expected, decoded)
+	}
+	if encoded := encode(t, NewCSV(), ps, []any{"1", "2"}); encoded != "1;2\n" {
+		t.Fatalf("header is written without fields, got %q", encoded)
+	}
+	encoder, err := NewCSV().NewEncoder(ps, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = encoder.Encode(map[string]any{"a": 1}); err != ErrNoFields {
+		t.Fatalf("map is encoded without fields, err %v", err)
+	}
+	if _, err = NewCSV().NewDecoder(newProperties(t, `csv-delimiter = ";;"`)); err == nil {
+		t.Fatal("illegal delimiter is accepted")
+	}
+}
+
+func TestTSV(t *testing.T) {
+	ps := newProperties(t, "csv-fields = [\"a\", \"b\"]\ncsv-delimiter = \";\"")
+	encoded := encode(t, NewTSV(), ps, map[string]any{"a": "x y", "b": map[string]any{"c": 1}})
+	if expected := "a\tb\nx y\t\"{\"\"c\"\":1}\"\n"; encoded != expected {
+		t.Fatalf("expected %q, got %q", expected, encoded)
+	}
+	//tsv always uses tab and allows bare quotes
+	decoded := decode(t, NewTSV(), ps, "a\tb\nsay \"hi\t2\n")
+	if expected := []any{map[string]any{"a": `say "hi`, "b": "2"}}; !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("expected %v, got %v", expected, decoded)
+	}
+}
+
+func TestLineDecoder(t *testing.T) {
+	property := codec.Property("lines")
+	for name, line := range map[string]string{"csv": "1,2", "tsv": "1\t2"} {
+		//csv-header is ignored, every line is a record
+		ps := newProperties(t, "codec = \""+name+"\"\ncsv-fields = [\"a\", \"b\"]")
+		decoder, err := codec.NewLineDecoder(ps, property)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			message, err := decoder.Decode(line)
+			if expected := map[string]any{"a": "1", "b": "2"}; err != nil || !reflect.DeepEqual(message, expected) {
+				t.Fatalf("%s line %q, expected %v, got %v %v", name, line, expected, message, err)
+			}
+		}
+		if _, err = codec.NewLineDecoder(newProperties(t, "codec = \""+name+"\""), property); !errors.Is(err, ErrNoLineFields) {
+			t.Fatalf("%s expected %v, got %v", name, ErrNoLineFields, err)
+		}
+	}
+}
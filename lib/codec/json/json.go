@@ -0,0 +1,134 @@
+package json
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+//jsonCodec decode a json value, array is split to messages, encode messages as one json array
+type jsonCodec struct{}
+
+func (jsonCodec) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{}
+}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) NewDecoder(_ athena.Properties) (athena.Decoder, error) {
+	return jsonDecoder{}, nil
+}
+
+func (jsonCodec) NewEncoder(_ athena.Properties, w io.Writer) (athena.Encoder, error) {
+	return &jsonEncoder{w: w}, nil
+}
+
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(data []byte) ([]any, error) {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	if array, ok := value.([]any); ok {
+		return array, nil
+	}
+	return []any{value}, nil
+}
+
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonEncoder) Encode(message any) error {
+	value, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	separator := ","
+	if e.count == 0 {
+		separator = "["
+	}
+	if _, err = io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	e.count++
+	_, err = e.w.Write(value)
+	return err
+}
+
+func (e *jsonEncoder) Flush() error {
+	if e.count == 0 {
+		_, err := io.WriteString(e.w, "[]")
+		return err
+	}
+	_, err := io.WriteString(e.w, "]")
+	return err
+}
+
+//ndjsonCodec decode and encode a json value per line
+type ndjsonCodec struct{}
+
+func (ndjsonCodec) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{}
+}
+
+func (ndjsonCodec) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (ndjsonCodec) NewDecoder(_ athena.Properties) (athena.Decoder, error) {
+	return ndjsonDecoder{}, nil
+}
+
+func (ndjsonCodec) NewEncoder(_ athena.Properties, w io.Writer) (athena.Encoder, error) {
+	return &ndjsonEncoder{json.NewEncoder(w)}, nil
+}
+
+type ndjsonDecoder struct{}
+
+func (ndjsonDecoder) Decode(data []byte) ([]any, error) {
+	var messages []any
+	err := codec.Lines(data, func(line []byte) error {
+		if len(bytes.TrimSpace(line)) == 0 {
+			return nil
+		}
+		var value any
+		if err := json.Unmarshal(line, &value); err != nil {
+			return err
+		}
+		messages = append(messages, value)
+		return nil
+	})
+	return messages, err
+}
+
+type ndjsonEncoder struct {
+	*json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(message any) error {
+	return e.Encoder.Encode(message)
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return nil
+}
+
+func NewJSON() athena.Codec {
+	return jsonCodec{}
+}
+
+func NewNDJSON() athena.Codec {
+	return ndjsonCodec{}
+}
+
+func init() {
+	codec.RegisterNewCodecFunc("json", NewJSON)
+	codec.RegisterNewCodecFunc("ndjson", NewNDJSON)
+}
@@ -0,0 +1,68 @@
+package json
+
+import (
+	"athena/athena"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var messages = []any{map[string]any{"a": 1.0, "b": []any{"x", true}}, "text", nil}
+
+func roundTrip(t *testing.T, c athena.Codec, messages []any) ([]any, string) {
+	var buffer bytes.Buffer
+	encoder, _ := c.NewEncoder(nil, &buffer)
+	for _, message := range messages {
+		if err := encoder.Encode(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	decoder, _ := c.NewDecoder(nil)
+	decoded, err := decoder.Decode(buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded, buffer.String()
+}
+
+func TestJSON(t *testing.T) {
+	decoded, encoded := roundTrip(t, NewJSON(), messages)
+	if encoded != `[{"a":1,"b":["x",true]},"text",null]` {
+		t.Fatalf("unexpected encoded %s", encoded)
+	}
+	if !reflect.DeepEqual(decoded, messages) {
+		t.Fatalf("expected %v, got %v", messages, decoded)
+	}
+	//empty batch is an empty array
+	if decoded, encoded = roundTrip(t, NewJSON(), nil); encoded != "[]" || len(decoded) != 0 {
+		t.Fatalf("unexpected empty batch %s %v", encoded, decoded)
+	}
+	//value not array is one message
+	decoder, _ := NewJSON().NewDecoder(nil)
+	if decoded, _ = decoder.Decode([]byte(`{"a":1}`)); len(decoded) != 1 {
+		t.Fatalf("object should be one message, got %v", decoded)
+	}
+	if _, err := decoder.Decode([]byte(`{"a":`)); err == nil {
+		t.Fatal("invalid json is decoded")
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	decoded, encoded := roundTrip(t, NewNDJSON(), messages)
+	if encoded != "{\"a\":1,\"b\":[\"x\",true]}\n\"text\"\nnull\n" {
+		t.Fatalf("unexpected encoded %q", encoded)
+	}
+	if !reflect.DeepEqual(decoded, messages) {
+		t.Fatalf("expected %v, got %v", messages, decoded)
+	}
+	decoder, _ := NewNDJSON().NewDecoder(nil)
+	if decoded, _ = decoder.Decode([]byte("1\r\n  \n[2]\n")); !reflect.DeepEqual(decoded, []any{1.0, []any{2.0}}) {
+		t.Fatalf("blank lines should be skipped, got %v", decoded)
+	}
+	if _, err := decoder.Decode([]byte("1\n{")); err == nil {
+		t.Fatal("invalid line is decoded")
+	}
+}
@@ -0,0 +1,68 @@
+package lines
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"github.com/spf13/cast"
+	"io"
+)
+
+//lines decode every non empty line to a string message, encode message as one line
+type lines struct{}
+
+func (lines) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{}
+}
+
+func (lines) ContentType() string {
+	return "text/plain"
+}
+
+func (lines) NewDecoder(_ athena.Properties) (athena.Decoder, error) {
+	return decoder{}, nil
+}
+
+func (lines) NewEncoder(_ athena.Properties, w io.Writer) (athena.Encoder, error) {
+	return &encoder{w: w}, nil
+}
+
+type decoder struct{}
+
+func (decoder) Decode(data []byte) ([]any, error) {
+	var messages []any
+	err := codec.Lines(data, func(line []byte) error {
+		messages = append(messages, string(line))
+		return nil
+	})
+	return messages, err
+}
+
+type encoder struct {
+	w io.Writer
+}
+
+func (e *encoder) Encode(message any) (err error) {
+	switch value := message.(type) {
+	case []byte:
+		_, err = e.w.Write(value)
+	default:
+		_, err = io.WriteString(e.w, cast.ToString(value))
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(e.w, "\n")
+	return err
+}
+
+func (e *encoder) Flush() error {
+	return nil
+}
+
+func New() athena.Codec {
+	return lines{}
+}
+
+func init() {
+	codec.RegisterNewCodecFunc("lines", New)
+}
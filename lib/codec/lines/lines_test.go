@@ -0,0 +1,32 @@
+package lines
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder, _ := New().NewEncoder(nil, &buffer)
+	for _, message := range []any{"a b", []byte("c"), 1} {
+		if err := encoder.Encode(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != "a b\nc\n1\n" {
+		t.Fatalf("unexpected encoded %q", buffer.String())
+	}
+	decoder, _ := New().NewDecoder(nil)
+	//empty lines are skipped and \r is trimmed
+	messages, err := decoder.Decode([]byte(buffer.String() + "\r\n\nd\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []any{"a b", "c", "1", "d"}; !reflect.DeepEqual(messages, expected) {
+		t.Fatalf("expected %v, got %v", expected, messages)
+	}
+}
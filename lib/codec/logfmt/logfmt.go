@@ -0,0 +1,164 @@
+package logfmt
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cast"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnclosedQuote = fmt.Errorf("unclosed quote")
+
+//logfmt decode every line of key=value pairs to a map, key without value is true
+type logfmt struct{}
+
+func (logfmt) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{}
+}
+
+func (logfmt) ContentType() string {
+	return "text/plain"
+}
+
+func (logfmt) NewDecoder(_ athena.Properties) (athena.Decoder, error) {
+	return decoder{}, nil
+}
+
+func (logfmt) NewEncoder(_ athena.Properties, w io.Writer) (athena.Encoder, error) {
+	return &encoder{w: w}, nil
+}
+
+type decoder struct{}
+
+func (decoder) Decode(data []byte) ([]any, error) {
+	var messages []any
+	err := codec.Lines(data, func(line []byte) error {
+		message, err := Parse(string(line))
+		if err != nil {
+			return err
+		}
+		messages = append(messages, message)
+		return nil
+	})
+	return messages, err
+}
+
+//Parse the logfmt line
+func Parse(line string) (map[string]any, error) {
+	message := map[string]any{}
+	for i := 0; i < len(line); {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		if i >= len(line) || line[i] == ' ' {
+			if key != "" {
+				message[key] = true
+			}
+			continue
+		}
+		//skip =
+		i++
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for ; end < len(line); end++ {
+				if line[end] == '\\' {
+					end++
+					continue
+				}
+				if line[end] == '"' {
+					break
+				}
+			}
+			if end >= len(line) {
+				return nil, ErrUnclosedQuote
+			}
+			value, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil, err
+			}
+			message[key] = value
+			i = end + 1
+			continue
+		}
+		start = i
+		for i < len(line) && line[i] != ' ' {
+			i++
+		}
+		message[key] = line[start:i]
+	}
+	return message, nil
+}
+
+type encoder struct {
+	w io.Writer
+}
+
+//Encode write map as sorted key=value pairs, other message is written as msg
+func (e *encoder) Encode(message any) error {
+	m, ok := message.(map[string]any)
+	if !ok {
+		m = map[string]any{"msg": message}
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	builder := &strings.Builder{}
+	for i, key := range keys {
+		if i > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(key)
+		builder.WriteByte('=')
+		builder.WriteString(quote(format(m[key])))
+	}
+	builder.WriteByte('\n')
+	_, err := io.WriteString(e.w, builder.String())
+	return err
+}
+
+func (e *encoder) Flush() error {
+	return nil
+}
+
+func format(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case map[string]any, []any, map[string]string:
+		text, _ := json.Marshal(v)
+		return string(text)
+	}
+	return cast.ToString(value)
+}
+
+func quote(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\\\t\r\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func New() athena.Codec {
+	return logfmt{}
+}
+
+func init() {
+	codec.RegisterNewCodecFunc("logfmt", New)
+}
@@ -0,0 +1,58 @@
+package logfmt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected map[string]any
+	}{
+		{`a=1 b=x`, map[string]any{"a": "1", "b": "x"}},
+		{`  a=1   debug  `, map[string]any{"a": "1", "debug": true}},
+		{`msg="hello world" path="a\"b\\c"`, map[string]any{"msg": "hello world", "path": `a"b\c`}},
+		{`empty= quoted=""`, map[string]any{"empty": "", "quoted": ""}},
+		{`url=http://x/?a=b`, map[string]any{"url": "http://x/?a=b"}},
+		{``, map[string]any{}},
+	}
+	for _, test := range tests {
+		message, err := Parse(test.line)
+		if err != nil {
+			t.Fatalf("%s: %v", test.line, err)
+		}
+		if !reflect.DeepEqual(message, test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.line, test.expected, message)
+		}
+	}
+	for _, line := range []string{`msg="unclosed`, `msg="escaped\"`} {
+		if _, err := Parse(line); err == nil {
+			t.Fatalf("%s: unclosed quote is parsed", line)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder, _ := New().NewEncoder(nil, &buffer)
+	messages := []any{map[string]any{"b": "x y", "a": 1, "c": "", "d": `q"=`}, "plain"}
+	for _, message := range messages {
+		if err := encoder.Encode(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expected := "a=1 b=\"x y\" c=\"\" d=\"q\\\"=\"\nmsg=plain\n"; buffer.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buffer.String())
+	}
+	decoder, _ := New().NewDecoder(nil)
+	decoded, err := decoder.Decode(buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []any{map[string]any{"a": "1", "b": "x y", "c": "", "d": `q"=`}, map[string]any{"msg": "plain"}}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("expected %v, got %v", expected, decoded)
+	}
+}
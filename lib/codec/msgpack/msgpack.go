@@ -0,0 +1,65 @@
+package msgpack
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"bytes"
+	"github.com/vmihailenco/msgpack/v5"
+	"io"
+)
+
+//msgpackCodec decode the stream of message pack values, map is decoded as map[string]any
+type msgpackCodec struct{}
+
+func (msgpackCodec) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{}
+}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) NewDecoder(_ athena.Properties) (athena.Decoder, error) {
+	return decoder{}, nil
+}
+
+func (msgpackCodec) NewEncoder(_ athena.Properties, w io.Writer) (athena.Encoder, error) {
+	return &encoder{msgpack.NewEncoder(w)}, nil
+}
+
+type decoder struct{}
+
+func (decoder) Decode(data []byte) ([]any, error) {
+	d := msgpack.NewDecoder(bytes.NewReader(data))
+	var messages []any
+	for {
+		value, err := d.DecodeInterface()
+		if err == io.EOF {
+			return messages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, value)
+	}
+}
+
+type encoder struct {
+	*msgpack.Encoder
+}
+
+func (e *encoder) Encode(message any) error {
+	return e.Encoder.Encode(message)
+}
+
+func (e *encoder) Flush() error {
+	return nil
+}
+
+func New() athena.Codec {
+	return msgpackCodec{}
+}
+
+func init() {
+	codec.RegisterNewCodecFunc("msgpack", New)
+}
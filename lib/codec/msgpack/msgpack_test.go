@@ -0,0 +1,32 @@
+package msgpack
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	messages := []any{map[string]any{"a": "x", "b": []any{true, nil}}, "text", 1.5}
+	var buffer bytes.Buffer
+	encoder, _ := New().NewEncoder(nil, &buffer)
+	for _, message := range messages {
+		if err := encoder.Encode(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	decoder, _ := New().NewDecoder(nil)
+	decoded, err := decoder.Decode(buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, messages) {
+		t.Fatalf("expected %v, got %v", messages, decoded)
+	}
+	if _, err = decoder.Decode(buffer.Bytes()[:buffer.Len()-1]); err == nil {
+		t.Fatal("truncated value is decoded")
+	}
+}
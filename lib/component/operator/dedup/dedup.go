@@ -0,0 +1,274 @@
+package dedup
+
+import (
+	"athena/athena"
+	"athena/lib/component"
+	"athena/lib/log"
+	"athena/lib/metrics"
+	"athena/lib/properties"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"github.com/pkg/errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+const (
+	StoreLRU   = "lru"
+	StoreBloom = "bloom"
+)
+
+var (
+	KeyProperty = properties.NewProperty[string]("key",
+		"key template of event, like {{.Message.id}}, keys are kept as 64 bit hashes, events without key are passed", "{{.Message}}")
+	StoreProperty         = properties.NewProperty[string]("store", "seen keys store, lru or bloom(time bucketed bloom filters)", StoreLRU)
+	TTLProperty           = properties.NewProperty[time.Duration]("ttl", "how long a key is remembered", 10*time.Minute)
+	SizeProperty          = properties.NewProperty[int]("size", "max keys of lru, or expected keys in ttl of bloom", 100000)
+	FalsePositiveProperty = properties.NewProperty[float64]("false-positive", "false positive rate of each bloom filter, unique events are dropped by false positives", 0.001)
+	BucketsProperty       = properties.NewProperty[int]("buckets", "bloom filters in ttl, keys expire by one bucket", 4)
+
+	ErrUnknownStore         = fmt.Errorf("unknown store")
+	ErrIncompatibleSnapshot = fmt.Errorf("snapshot is incompatible with store properties")
+)
+
+type operator struct {
+	ctx      athena.Context
+	logger   athena.Logger
+	acker    athena.ACKer
+	emitNext athena.EmitNext
+	key      *template.Template
+	metrics  *metrics.Metrics
+	name     string
+	ttl      time.Duration
+	size     int
+	mutex    sync.Mutex
+	store    store
+	//pending is the keys waiting for ack, they are seen but recorded after ack
+	pending   map[uint64]*pending
+	pruneSize int
+}
+
+//pending is the key of emitted event, its duplicates are held until the event is acked or nacked
+type pending struct {
+	emitted    time.Time
+	duplicates []*athena.Event
+}
+
+func (o *operator) Open(ctx athena.Context) (err error) {
+	o.ctx = ctx
+	o.logger = log.Ctx(o.ctx)
+	o.metrics = metrics.Ctx(o.ctx)
+	o.acker = athena.NewACKer(ctx)
+	if o.key, err = template.New(ctx.Name()).Option("missingkey=error").Parse(ctx.Properties().GetString(KeyProperty)); err != nil {
+		return err
+	}
+	ttl := ctx.Properties().GetDuration(TTLProperty)
+	size := ctx.Properties().GetInt(SizeProperty)
+	if ttl <= 0 || size <= 0 {
+		return fmt.Errorf("ttl and size must be positive")
+	}
+	o.ttl, o.size = ttl, size
+	o.pending, o.pruneSize = map[uint64]*pending{}, size
+	o.name = ctx.Properties().GetString(StoreProperty)
+	switch o.name {
+	case StoreLRU:
+		o.store = newLRU(ttl, size)
+	case StoreBloom:
+		falsePositive := ctx.Properties().GetFloat64(FalsePositiveProperty)
+		if falsePositive <= 0 || falsePositive >= 1 {
+			return fmt.Errorf("false-positive must be in (0, 1)")
+		}
+		buckets := ctx.Properties().GetInt(BucketsProperty)
+		if buckets <= 0 {
+			return fmt.Errorf("buckets must be positive")
+		}
+		o.store = newBloom(ttl, size, falsePositive, buckets)
+	default:
+		return errors.WithMessage(ErrUnknownStore, o.name)
+	}
+	return nil
+}
+
+func (o *operator) Close() error {
+	o.acker.Close()
+	return nil
+}
+
+func (o *operator) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{KeyProperty, StoreProperty, TTLProperty, SizeProperty, FalsePositiveProperty, BucketsProperty}
+}
+
+//Snapshot the seen keys, the store name is written first
+func (o *operator) Snapshot() ([]byte, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	if err := encoder.Encode(o.name); err != nil {
+		return nil, err
+	}
+	if err := o.store.encode(encoder); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+//Restore the seen keys, snapshot of other store or sizes is discarded
+func (o *operator) Restore(snapshot []byte) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	decoder := gob.NewDecoder(bytes.NewReader(snapshot))
+	var name string
+	if err := decoder.Decode(&name); err != nil {
+		return err
+	}
+	if name != o.name {
+		o.logger.Warnw("discard snapshot of other store.", "store", name)
+		return nil
+	}
+	if err := o.store.decode(decoder); err != nil {
+		if err == ErrIncompatibleSnapshot {
+			o.logger.Warnw("discard snapshot.", "err", err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (o *operator) Collect(emitNext athena.EmitNext) error {
+	o.emitNext = emitNext
+	<-o.ctx.Done()
+	return nil
+}
+
+func (o *operator) GenerateEmit(_ athena.Context) athena.Emit {
+	return o.emit
+}
+
+//emit pass the first event of key, duplicates of recorded keys are dropped and acked,
+//duplicates of pending keys are held, then dropped and acked with the first event, or nacked with it.
+//the key is recorded after the event is acked, so the redelivered event of nacked key is passed
+func (o *operator) emit(event *athena.Event) {
+	var buffer bytes.Buffer
+	if err := o.key.Execute(&buffer, event); err != nil || buffer.Len() == 0 {
+		o.logger.Debugw("event has no key, pass it.", "err", err)
+		o.emitNext(event, nil)
+		return
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(buffer.Bytes())
+	hash := h.Sum64()
+	p, held, expired := o.seen(hash, event, time.Now())
+	o.nack(expired)
+	if held {
+		return
+	}
+	if p == nil {
+		o.metrics.Drop.Inc()
+		o.acker.OnACK(event, true)
+		return
+	}
+	//copy event as it's shared by the other outputs of upstream
+	var nacked int32
+	private := make(map[string]any, len(event.Private)+1)
+	for key, value := range event.Private {
+		private[key] = value
+	}
+	nackHandler, _ := event.Private[athena.PrivateNACKHandler].(athena.ACKHandler)
+	private[athena.PrivateNACKHandler] = athena.ACKHandler(func() {
+		atomic.StoreInt32(&nacked, 1)
+		if nackHandler != nil {
+			nackHandler()
+		}
+	})
+	ackHandler, _ := event.Private[athena.PrivateACKHandler].(athena.ACKHandler)
+	o.emitNext(&athena.Event{Meta: event.Meta, Message: event.Message, Time: event.Time, Private: private}, func() {
+		acked := atomic.LoadInt32(&nacked) == 0
+		for _, duplicate := range o.record(hash, p, acked, time.Now()) {
+			if acked {
+				o.metrics.Drop.Inc()
+			}
+			o.acker.OnACK(duplicate, acked)
+		}
+		if ackHandler != nil {
+			ackHandler()
+		}
+	})
+}
+
+//seen hold the event if its key is pending, return nil pending if the key is recorded,
+//or add the key to pending. duplicates of the expired pending keys are returned to be nacked
+func (o *operator) seen(hash uint64, event *athena.Event, now time.Time) (*pending, bool, []*athena.Event) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	var expired []*athena.Event
+	if p, ok := o.pending[hash]; ok {
+		if now.Sub(p.emitted) < o.ttl {
+			p.duplicates = append(p.duplicates, event)
+			return nil, true, nil
+		}
+		expired, p.duplicates = p.duplicates, nil
+	}
+	if o.store.contains(hash, now) {
+		return nil, false, expired
+	}
+	p := &pending{emitted: now}
+	o.pending[hash] = p
+	if len(o.pending) > o.pruneSize {
+		expired = append(expired, o.prune(now)...)
+	}
+	return p, false, expired
+}
+
+//prune the pending keys never acked in ttl like dropped by downstream, return their duplicates
+func (o *operator) prune(now time.Time) []*athena.Event {
+	var expired []*athena.Event
+	for hash, p := range o.pending {
+		if now.Sub(p.emitted) >= o.ttl {
+			delete(o.pending, hash)
+			expired = append(expired, p.duplicates...)
+			p.duplicates = nil
+		}
+	}
+	o.pruneSize = 2 * len(o.pending)
+	if o.pruneSize < o.size {
+		o.pruneSize = o.size
+	}
+	return expired
+}
+
+//nack the held duplicates, they are redelivered as the first event is unknown
+func (o *operator) nack(duplicates []*athena.Event) {
+	for _, duplicate := range duplicates {
+		o.acker.OnACK(duplicate, false)
+	}
+}
+
+//record the acked key, nacked key is forgotten, return the held duplicates
+func (o *operator) record(hash uint64, p *pending, acked bool, now time.Time) []*athena.Event {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	//the key may be pending again after expired
+	if o.pending[hash] == p {
+		delete(o.pending, hash)
+	}
+	if acked {
+		o.store.add(hash, now)
+	}
+	duplicates := p.duplicates
+	p.duplicates = nil
+	return duplicates
+}
+
+func New() athena.Operator {
+	return &operator{}
+}
+
+func init() {
+	component.RegisterNewOperatorFunc("dedup", New)
+}
@@ -0,0 +1,224 @@
+package dedup
+
+import (
+	"athena/athena"
+	"athena/lib/context"
+	"athena/lib/log"
+	"athena/lib/properties"
+	_c "context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+//downstream keep the emitted events and their ack handlers
+type downstream struct {
+	events   []*athena.Event
+	handlers []athena.ACKHandler
+}
+
+func (d *downstream) emitNext(event *athena.Event, handler athena.ACKHandler) {
+	d.events = append(d.events, event)
+	d.handlers = append(d.handlers, handler)
+}
+
+//ack the ith event like acker of downstream, nack handler is called first
+func (d *downstream) ack(i int, ok bool) {
+	if !ok {
+		d.events[i].Private[athena.PrivateNACKHandler].(athena.ACKHandler)()
+	}
+	d.handlers[i]()
+}
+
+func newOperator(t *testing.T, store string) (*operator, *downstream) {
+	log.Setup(log.DefaultOptions())
+	file := filepath.Join(t.TempDir(), "athena.toml")
+	if err := os.WriteFile(file, []byte("[operator.dedup]\nkey = \"{{.Message.id}}\"\nstore = \""+store+"\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := properties.New(file, properties.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.New(_c.Background(), p).Named("operator.dedup")
+	o := New().(*operator)
+	if _, err = properties.InitAndRender(ctx.Properties(), o.PropertiesDef()); err != nil {
+		t.Fatal(err)
+	}
+	if err = o.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d := &downstream{}
+	o.emitNext = d.emitNext
+	return o, d
+}
+
+func event(id string) *athena.Event {
+	return &athena.Event{Message: map[string]any{"id": id}}
+}
+
+//acks count the ack handler calls and the nacks of upstream events, acks are concurrent
+type acks struct {
+	acked  int32
+	nacked int32
+}
+
+func (a *acks) event(id string) *athena.Event {
+	e := event(id)
+	e.Private = map[string]any{
+		athena.PrivateACKHandler:  athena.ACKHandler(func() { atomic.AddInt32(&a.acked, 1) }),
+		athena.PrivateNACKHandler: athena.ACKHandler(func() { atomic.AddInt32(&a.nacked, 1) }),
+	}
+	return e
+}
+
+func (a *acks) get() (int, int) {
+	return int(atomic.LoadInt32(&a.acked)), int(atomic.LoadInt32(&a.nacked))
+}
+
+func TestDedup(t *testing.T) {
+	for _, store := range []string{StoreLRU, StoreBloom} {
+		o, d := newOperator(t, store)
+		drops := testutil.ToFloat64(o.metrics.Drop)
+		//duplicate of pending key is held until the first event is acked or nacked
+		a := &acks{}
+		o.emit(event("a"))
+		o.emit(a.event("a"))
+		if acked, _ := a.get(); len(d.events) != 1 || acked != 0 || testutil.ToFloat64(o.metrics.Drop)-drops != 0 {
+			t.Fatalf("%s: duplicate of pending key is passed or acked", store)
+		}
+		//nacked key is forgotten with its duplicates, so the redelivered event is passed
+		d.ack(0, false)
+		if acked, nacked := a.get(); acked != 1 || nacked != 1 {
+			t.Fatalf("%s: held duplicate is not nacked, acked %d nacked %d", store, acked, nacked)
+		}
+		o.emit(event("a"))
+		if len(d.events) != 2 {
+			t.Fatalf("%s: redelivered event of nacked key is dropped", store)
+		}
+		o.emit(a.event("a"))
+		d.ack(1, true)
+		if acked, nacked := a.get(); acked != 2 || nacked != 1 || testutil.ToFloat64(o.metrics.Drop)-drops != 1 {
+			t.Fatalf("%s: held duplicate is not dropped, acked %d nacked %d", store, acked, nacked)
+		}
+		o.emit(a.event("a"))
+		if acked, _ := a.get(); len(d.events) != 2 || acked != 3 || testutil.ToFloat64(o.metrics.Drop)-drops != 2 || len(o.pending) != 0 {
+			t.Fatalf("%s: duplicate of acked key is passed", store)
+		}
+		//events without key are passed
+		o.emit(&athena.Event{Message: "text"})
+		o.emit(&athena.Event{Message: "text"})
+		if len(d.events) != 4 {
+			t.Fatalf("%s: events without key are dropped", store)
+		}
+		_ = o.Close()
+	}
+}
+
+func TestDedupExpired(t *testing.T) {
+	o, d := newOperator(t, StoreLRU)
+	a := &acks{}
+	o.emit(event("a"))
+	o.emit(a.event("a"))
+	//duplicates of expired pending key are nacked, the key is pending again
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("a"))
+	p, held, expired := o.seen(h.Sum64(), event("a"), time.Now().Add(o.ttl))
+	o.nack(expired)
+	if acked, nacked := a.get(); p == nil || held || acked != 1 || nacked != 1 {
+		t.Fatalf("duplicate of expired key is not nacked, acked %d nacked %d", acked, nacked)
+	}
+	//late ack of the expired event doesn't remove the pending key
+	d.ack(0, true)
+	if len(o.pending) != 1 {
+		t.Fatalf("pending key is removed by late ack, pending %d", len(o.pending))
+	}
+}
+
+func TestDedupPrivate(t *testing.T) {
+	o, d := newOperator(t, StoreLRU)
+	var acked, nacked int
+	input := event("a")
+	input.Private = map[string]any{
+		athena.PrivateACKHandler:  athena.ACKHandler(func() { acked++ }),
+		athena.PrivateNACKHandler: athena.ACKHandler(func() { nacked++ }),
+	}
+	o.emit(input)
+	//the input nack handler is kept as the event is shared
+	input.Private[athena.PrivateNACKHandler].(athena.ACKHandler)()
+	if d.events[0] == input || nacked != 1 || len(o.pending) != 1 {
+		t.Fatal("shared input event is changed")
+	}
+	//upstream handlers are chained
+	d.ack(0, false)
+	if acked != 1 || nacked != 2 {
+		t.Fatalf("upstream handlers are not called, acked %d nacked %d", acked, nacked)
+	}
+}
+
+func TestDedupSnapshot(t *testing.T) {
+	o, d := newOperator(t, StoreLRU)
+	o.emit(event("a"))
+	o.emit(event("b"))
+	d.ack(0, true)
+	snapshot, err := o.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//only acked keys are restored
+	restored, rd := newOperator(t, StoreLRU)
+	if err = restored.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	restored.emit(event("a"))
+	restored.emit(event("b"))
+	if len(rd.events) != 1 || rd.events[0].Message.(map[string]any)["id"] != "b" {
+		t.Fatalf("unexpected passed events %d", len(rd.events))
+	}
+	//snapshot of other store is discarded
+	bloom, bd := newOperator(t, StoreBloom)
+	if err = bloom.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	bloom.emit(event("a"))
+	if len(bd.events) != 1 {
+		t.Fatal("snapshot of other store is restored")
+	}
+	if err = bloom.Restore([]byte("broken")); err == nil {
+		t.Fatal("broken snapshot is restored")
+	}
+}
+
+//checkpoint pauses emits while snapshotting, but events are still acked concurrently
+func TestDedupSnapshotWhileAcked(t *testing.T) {
+	o, d := newOperator(t, StoreBloom)
+	a := &acks{}
+	for i := 0; i < 1000; i++ {
+		o.emit(event(fmt.Sprint(i)))
+		o.emit(a.event(fmt.Sprint(i)))
+	}
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for i := range d.events {
+			d.ack(i, true)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if _, err := o.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait.Wait()
+	if acked, nacked := a.get(); len(d.events) != 1000 || len(o.pending) != 0 || acked != 1000 || nacked != 0 {
+		t.Fatalf("unexpected events %d pending %d acked %d nacked %d", len(d.events), len(o.pending), acked, nacked)
+	}
+}
@@ -0,0 +1,190 @@
+package dedup
+
+import (
+	"container/list"
+	"encoding/gob"
+	"math"
+	"time"
+)
+
+//store remember the seen key hashes, it's not thread safety
+type store interface {
+	//contains return true if the hash is remembered in ttl
+	contains(hash uint64, now time.Time) bool
+	//add remember the hash for ttl
+	add(hash uint64, now time.Time)
+	encode(encoder *gob.Encoder) error
+	decode(decoder *gob.Decoder) error
+}
+
+//entry is one key of lru store
+type entry struct {
+	Hash   uint64
+	Expire time.Time
+}
+
+//lru keep at most size keys, the least recently seen key is evicted first
+type lru struct {
+	ttl   time.Duration
+	size  int
+	list  *list.List
+	index map[uint64]*list.Element
+}
+
+func newLRU(ttl time.Duration, size int) *lru {
+	return &lru{ttl: ttl, size: size, list: list.New(), index: map[uint64]*list.Element{}}
+}
+
+func (l *lru) contains(hash uint64, now time.Time) bool {
+	element, ok := l.index[hash]
+	if !ok {
+		return false
+	}
+	if !now.Before(element.Value.(*entry).Expire) {
+		l.remove(element)
+		return false
+	}
+	l.list.MoveToFront(element)
+	return true
+}
+
+func (l *lru) add(hash uint64, now time.Time) {
+	if element, ok := l.index[hash]; ok {
+		element.Value.(*entry).Expire = now.Add(l.ttl)
+		l.list.MoveToFront(element)
+	} else {
+		l.index[hash] = l.list.PushFront(&entry{Hash: hash, Expire: now.Add(l.ttl)})
+	}
+	for back := l.list.Back(); back != nil; back = l.list.Back() {
+		if l.list.Len() <= l.size && now.Before(back.Value.(*entry).Expire) {
+			break
+		}
+		l.remove(back)
+	}
+}
+
+func (l *lru) remove(element *list.Element) {
+	l.list.Remove(element)
+	delete(l.index, element.Value.(*entry).Hash)
+}
+
+//encode the unexpired entries from the least recently seen
+func (l *lru) encode(encoder *gob.Encoder) error {
+	now := time.Now()
+	entries := make([]entry, 0, l.list.Len())
+	for element := l.list.Back(); element != nil; element = element.Prev() {
+		if e := element.Value.(*entry); now.Before(e.Expire) {
+			entries = append(entries, *e)
+		}
+	}
+	return encoder.Encode(entries)
+}
+
+func (l *lru) decode(decoder *gob.Decoder) error {
+	var entries []entry
+	if err := decoder.Decode(&entries); err != nil {
+		return err
+	}
+	for i := range entries {
+		if element, ok := l.index[entries[i].Hash]; ok {
+			l.remove(element)
+		}
+		l.index[entries[i].Hash] = l.list.PushFront(&entries[i])
+	}
+	for l.list.Len() > l.size {
+		l.remove(l.list.Back())
+	}
+	return nil
+}
+
+//bucket is the bloom filter of keys seen in one period
+type bucket struct {
+	Start time.Time
+	Bits  []uint64
+}
+
+//bloom is time bucketed bloom filters, keys are remembered for ttl to ttl plus one period, false positives drop unique events
+type bloom struct {
+	ttl     time.Duration
+	period  time.Duration
+	bits    uint64
+	hashes  int
+	buckets []*bucket
+}
+
+//newBloom size each filter for size keys with the false positive rate, so bursts in one period are tolerated
+func newBloom(ttl time.Duration, size int, falsePositive float64, buckets int) *bloom {
+	n := float64(size)
+	bits := uint64(math.Ceil(-n*math.Log(falsePositive)/(math.Ln2*math.Ln2)+63)) / 64 * 64
+	hashes := int(math.Round(float64(bits) / n * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+	return &bloom{ttl: ttl, period: ttl / time.Duration(buckets), bits: bits, hashes: hashes}
+}
+
+//rotate expire the old buckets and add the new bucket of period
+func (b *bloom) rotate(now time.Time) {
+	expired := 0
+	for expired < len(b.buckets) && now.Sub(b.buckets[expired].Start) >= b.ttl+b.period {
+		expired++
+	}
+	b.buckets = b.buckets[expired:]
+	if len(b.buckets) == 0 || now.Sub(b.buckets[len(b.buckets)-1].Start) >= b.period {
+		b.buckets = append(b.buckets, &bucket{Start: now, Bits: make([]uint64, b.bits/64)})
+	}
+}
+
+//index return the bit index of the ith hash, double hashing the two halves
+func (b *bloom) index(hash uint64, i int) uint64 {
+	h1, h2 := hash&math.MaxUint32, hash>>32|1
+	return (h1 + uint64(i)*h2) % b.bits
+}
+
+func (b *bloom) contains(hash uint64, now time.Time) bool {
+	b.rotate(now)
+	for _, bk := range b.buckets {
+		found := true
+		for i := 0; i < b.hashes && found; i++ {
+			index := b.index(hash, i)
+			found = bk.Bits[index/64]&(1<<(index%64)) != 0
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+//add set the bits in the current bucket, keys can't be removed from bloom filters
+func (b *bloom) add(hash uint64, now time.Time) {
+	b.rotate(now)
+	current := b.buckets[len(b.buckets)-1]
+	for i := 0; i < b.hashes; i++ {
+		index := b.index(hash, i)
+		current.Bits[index/64] |= 1 << (index % 64)
+	}
+}
+
+func (b *bloom) encode(encoder *gob.Encoder) error {
+	if err := encoder.Encode([2]uint64{b.bits, uint64(b.hashes)}); err != nil {
+		return err
+	}
+	return encoder.Encode(b.buckets)
+}
+
+func (b *bloom) decode(decoder *gob.Decoder) error {
+	var size [2]uint64
+	if err := decoder.Decode(&size); err != nil {
+		return err
+	}
+	if size != [2]uint64{b.bits, uint64(b.hashes)} {
+		return ErrIncompatibleSnapshot
+	}
+	var buckets []*bucket
+	if err := decoder.Decode(&buckets); err != nil {
+		return err
+	}
+	b.buckets = buckets
+	return nil
+}
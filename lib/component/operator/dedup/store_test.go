@@ -0,0 +1,121 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Now()
+	l := newLRU(time.Minute, 2)
+	l.add(1, now)
+	l.add(2, now)
+	//1 is recently seen, 2 is evicted by 3
+	if !l.contains(1, now) {
+		t.Fatal("1 is not remembered")
+	}
+	l.add(3, now)
+	if l.contains(2, now) || !l.contains(1, now) || !l.contains(3, now) || l.list.Len() != 2 {
+		t.Fatalf("least recently seen key is not evicted, len %d", l.list.Len())
+	}
+	//keys expire after ttl, add extends the expiry
+	l.add(3, now.Add(30*time.Second))
+	if l.contains(1, now.Add(time.Minute)) || !l.contains(3, now.Add(time.Minute)) {
+		t.Fatal("key is not expired by ttl")
+	}
+	if _, ok := l.index[1]; ok {
+		t.Fatal("expired key is not removed")
+	}
+	//expired keys are evicted before size is exceeded
+	l.add(4, now.Add(2*time.Minute))
+	if l.list.Len() != 1 || !l.contains(4, now.Add(2*time.Minute)) {
+		t.Fatalf("expired keys are kept, len %d", l.list.Len())
+	}
+}
+
+func TestLRUSnapshot(t *testing.T) {
+	now := time.Now()
+	l := newLRU(time.Minute, 3)
+	l.add(1, now.Add(-2*time.Minute))
+	l.add(2, now)
+	l.add(3, now)
+	var buffer bytes.Buffer
+	if err := l.encode(gob.NewEncoder(&buffer)); err != nil {
+		t.Fatal(err)
+	}
+	//restored into smaller store, the least recently seen is dropped
+	restored := newLRU(time.Minute, 1)
+	if err := restored.decode(gob.NewDecoder(&buffer)); err != nil {
+		t.Fatal(err)
+	}
+	if restored.list.Len() != 1 || !restored.contains(3, now) {
+		t.Fatalf("unexpected restored keys, len %d", restored.list.Len())
+	}
+}
+
+func TestBloom(t *testing.T) {
+	now := time.Now()
+	b := newBloom(time.Minute, 1000, 0.001, 2)
+	if b.period != 30*time.Second || b.bits%64 != 0 || b.hashes < 1 {
+		t.Fatalf("unexpected bloom sizes, period %v bits %d hashes %d", b.period, b.bits, b.hashes)
+	}
+	b.add(1, now)
+	if !b.contains(1, now) || b.contains(2, now) {
+		t.Fatal("bloom doesn't contain the added key")
+	}
+	//a bucket is added every period
+	b.add(2, now.Add(30*time.Second))
+	if len(b.buckets) != 2 || !b.contains(1, now.Add(45*time.Second)) {
+		t.Fatalf("bucket is not rotated, buckets %d", len(b.buckets))
+	}
+	//keys expire after ttl plus one period at most
+	if b.contains(1, now.Add(90*time.Second)) || !b.contains(2, now.Add(90*time.Second)) {
+		t.Fatal("expired bucket is kept")
+	}
+	if len(b.buckets) != 2 || !b.buckets[0].Start.Equal(now.Add(30*time.Second)) {
+		t.Fatalf("unexpected buckets %d", len(b.buckets))
+	}
+	if b.contains(2, now.Add(5*time.Minute)) || len(b.buckets) != 1 {
+		t.Fatalf("all buckets should be expired, buckets %d", len(b.buckets))
+	}
+}
+
+func TestBloomFalsePositive(t *testing.T) {
+	now := time.Now()
+	b := newBloom(time.Minute, 10000, 0.01, 1)
+	for i := uint64(0); i < 10000; i++ {
+		b.add(i*0x9E3779B97F4A7C15, now)
+	}
+	positives := 0
+	for i := uint64(10000); i < 20000; i++ {
+		if b.contains(i*0x9E3779B97F4A7C15, now) {
+			positives++
+		}
+	}
+	if positives > 300 {
+		t.Fatalf("false positives %d exceed the rate", positives)
+	}
+}
+
+func TestBloomSnapshot(t *testing.T) {
+	now := time.Now()
+	b := newBloom(time.Minute, 100, 0.01, 2)
+	b.add(1, now)
+	var buffer bytes.Buffer
+	if err := b.encode(gob.NewEncoder(&buffer)); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+	restored := newBloom(time.Minute, 100, 0.01, 2)
+	if err := restored.decode(gob.NewDecoder(bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	if !restored.contains(1, now) || restored.contains(2, now) {
+		t.Fatal("bloom is not restored")
+	}
+	if err := newBloom(time.Minute, 1000, 0.01, 2).decode(gob.NewDecoder(bytes.NewReader(data))); err != ErrIncompatibleSnapshot {
+		t.Fatalf("snapshot of other size is restored, err %v", err)
+	}
+}
@@ -0,0 +1,355 @@
+package grok
+
+import (
+	"athena/athena"
+	"athena/lib/component"
+	"athena/lib/deadletter"
+	"athena/lib/log"
+	"athena/lib/metrics"
+	"athena/lib/properties"
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+
+	maxDepth = 32
+)
+
+var (
+	FieldProperty = properties.NewProperty[string]("field", "message key of the line, captures are merged into message, the whole message is the line and replaced if empty", "")
+	//PatternsProperty is grok patterns of grok operator and regexps of regex operator
+	PatternsProperty           = properties.NewRequiredProperty[[]string]("patterns", "patterns tried in order, grok like %{IP:client} or regex with named groups")
+	PatternDefinitionsProperty = properties.NewProperty[[]string]("pattern-definitions", "custom grok patterns, each is NAME regex", []string{})
+	TypesProperty              = properties.NewProperty[[]string]("types", "type hints name:type, type is string int float or bool, grok can also use %{NUMBER:name:int}", []string{})
+	BreakOnMatchProperty       = properties.NewProperty[bool]("break-on-match", "stop at the first matched pattern, or apply all patterns and merge captures if false", true)
+	KeepEmptyProperty          = properties.NewProperty[bool]("keep-empty", "keep empty captures", false)
+
+	ErrUnknownPattern    = fmt.Errorf("unknown grok pattern")
+	ErrPatternRecursion  = fmt.Errorf("grok pattern recursion too deep")
+	ErrInvalidDefinition = fmt.Errorf("invalid pattern definition")
+	ErrUnknownType       = fmt.Errorf("unknown capture type")
+	ErrNoMatch           = fmt.Errorf("no pattern matched")
+	ErrNotString         = deadletter.ErrNotString
+	ErrNotMap            = fmt.Errorf("message is not map")
+
+	referenceRegexp = regexp.MustCompile(`%\{(\w+)(?::([\w.@\[\]-]+))?(?::(\w+))?\}`)
+)
+
+//capture is the field of a regexp group
+type capture struct {
+	name string
+	typ  string
+}
+
+//matcher is one compiled pattern
+type matcher struct {
+	re       *regexp.Regexp
+	captures map[int]capture
+}
+
+//compiler expand grok references to named groups, groups are named g<n> as field names may not be identifiers
+type compiler struct {
+	definitions map[string]string
+	groups      map[string]capture
+}
+
+func (c *compiler) expand(expr string, depth int) (string, error) {
+	if depth > maxDepth {
+		return "", ErrPatternRecursion
+	}
+	builder := &strings.Builder{}
+	last := 0
+	for _, loc := range referenceRegexp.FindAllStringSubmatchIndex(expr, -1) {
+		builder.WriteString(expr[last:loc[0]])
+		last = loc[1]
+		name := expr[loc[2]:loc[3]]
+		definition, ok := c.definitions[name]
+		if !ok {
+			if definition, ok = patterns[name]; !ok {
+				return "", errors.WithMessage(ErrUnknownPattern, name)
+			}
+		}
+		expanded, err := c.expand(definition, depth+1)
+		if err != nil {
+			return "", err
+		}
+		if loc[4] < 0 {
+			builder.WriteString("(?:" + expanded + ")")
+			continue
+		}
+		group := capture{name: expr[loc[4]:loc[5]], typ: TypeString}
+		if loc[6] >= 0 {
+			group.typ = expr[loc[6]:loc[7]]
+		}
+		groupName := "g" + strconv.Itoa(len(c.groups))
+		c.groups[groupName] = group
+		builder.WriteString("(?P<" + groupName + ">" + expanded + ")")
+	}
+	builder.WriteString(expr[last:])
+	return builder.String(), nil
+}
+
+//compileGrok compile the grok pattern with custom definitions
+func compileGrok(pattern string, definitions map[string]string, types map[string]string) (*matcher, error) {
+	c := &compiler{definitions: definitions, groups: map[string]capture{}}
+	expanded, err := c.expand(pattern, 0)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, err
+	}
+	m := &matcher{re: re, captures: map[int]capture{}}
+	for i, groupName := range re.SubexpNames() {
+		if group, ok := c.groups[groupName]; ok {
+			if typ, ok := types[group.name]; ok {
+				group.typ = typ
+			}
+			m.captures[i] = group
+		}
+	}
+	return m, m.check()
+}
+
+//compileRegex compile the regexp, named groups are the fields
+func compileRegex(pattern string, types map[string]string) (*matcher, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	m := &matcher{re: re, captures: map[int]capture{}}
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		group := capture{name: name, typ: TypeString}
+		if typ, ok := types[name]; ok {
+			group.typ = typ
+		}
+		m.captures[i] = group
+	}
+	return m, m.check()
+}
+
+func (m *matcher) check() error {
+	for _, group := range m.captures {
+		switch group.typ {
+		case TypeString, TypeInt, TypeFloat, TypeBool:
+		default:
+			return errors.WithMessagef(ErrUnknownType, "%s:%s", group.name, group.typ)
+		}
+	}
+	return nil
+}
+
+//match the line and set captures to fields, return false if not matched
+func (m *matcher) match(line string, fields map[string]any, keepEmpty bool) (bool, error) {
+	loc := m.re.FindStringSubmatchIndex(line)
+	if loc == nil {
+		return false, nil
+	}
+	for i, group := range m.captures {
+		//optional group not participating
+		if loc[2*i] < 0 {
+			continue
+		}
+		value := line[loc[2*i]:loc[2*i+1]]
+		if value == "" && !keepEmpty {
+			continue
+		}
+		converted, err := convert(value, group.typ)
+		if err != nil {
+			return true, errors.WithMessagef(err, "capture %s", group.name)
+		}
+		fields[group.name] = converted
+	}
+	return true, nil
+}
+
+func convert(value string, typ string) (any, error) {
+	switch typ {
+	case TypeInt:
+		return strconv.ParseInt(value, 10, 64)
+	case TypeFloat:
+		return strconv.ParseFloat(value, 64)
+	case TypeBool:
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
+
+func parseTypes(specs []string) (map[string]string, error) {
+	types := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		index := strings.LastIndex(spec, ":")
+		if index <= 0 {
+			return nil, errors.WithMessage(ErrUnknownType, spec)
+		}
+		types[spec[:index]] = spec[index+1:]
+	}
+	return types, nil
+}
+
+func parseDefinitions(specs []string) (map[string]string, error) {
+	definitions := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		parts := strings.SplitN(strings.TrimSpace(spec), " ", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, errors.WithMessage(ErrInvalidDefinition, spec)
+		}
+		definitions[parts[0]] = strings.TrimSpace(parts[1])
+	}
+	return definitions, nil
+}
+
+type operator struct {
+	ctx          athena.Context
+	logger       athena.Logger
+	metrics      *metrics.Metrics
+	acker        athena.ACKer
+	emitNext     athena.EmitNext
+	grok         bool
+	matchers     []*matcher
+	field        string
+	breakOnMatch bool
+	keepEmpty    bool
+	deadLetter   *deadletter.Writer
+}
+
+func (o *operator) Open(ctx athena.Context) (err error) {
+	o.ctx = ctx
+	o.logger = log.Ctx(o.ctx)
+	o.metrics = metrics.Ctx(o.ctx)
+	o.acker = athena.NewACKer(ctx)
+	types, err := parseTypes(ctx.Properties().GetStringSlice(TypesProperty))
+	if err != nil {
+		return err
+	}
+	var definitions map[string]string
+	if o.grok {
+		if definitions, err = parseDefinitions(ctx.Properties().GetStringSlice(PatternDefinitionsProperty)); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range ctx.Properties().GetStringSlice(PatternsProperty) {
+		var m *matcher
+		if o.grok {
+			m, err = compileGrok(pattern, definitions, types)
+		} else {
+			m, err = compileRegex(pattern, types)
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "can't compile pattern %s", pattern)
+		}
+		o.matchers = append(o.matchers, m)
+	}
+	o.field = ctx.Properties().GetString(FieldProperty)
+	o.breakOnMatch = ctx.Properties().GetBool(BreakOnMatchProperty)
+	o.keepEmpty = ctx.Properties().GetBool(KeepEmptyProperty)
+	o.deadLetter, err = deadletter.New(ctx)
+	return err
+}
+
+func (o *operator) Close() error {
+	o.acker.Close()
+	return o.deadLetter.Close()
+}
+
+func (o *operator) PropertiesDef() athena.PropertiesDef {
+	if o.grok {
+		return athena.PropertiesDef{FieldProperty, PatternsProperty, PatternDefinitionsProperty, TypesProperty,
+			BreakOnMatchProperty, KeepEmptyProperty, deadletter.PathProperty}
+	}
+	return athena.PropertiesDef{FieldProperty, PatternsProperty, TypesProperty,
+		BreakOnMatchProperty, KeepEmptyProperty, deadletter.PathProperty}
+}
+
+func (o *operator) Collect(emitNext athena.EmitNext) error {
+	o.emitNext = emitNext
+	<-o.ctx.Done()
+	return nil
+}
+
+func (o *operator) GenerateEmit(_ athena.Context) athena.Emit {
+	return o.emit
+}
+
+func (o *operator) emit(event *athena.Event) {
+	message, err := o.extract(event)
+	if err != nil {
+		o.fail(event, err)
+		return
+	}
+	o.emitNext(&athena.Event{Meta: event.Meta, Message: message, Time: event.Time, Private: event.Private}, nil)
+}
+
+func (o *operator) extract(event *athena.Event) (any, error) {
+	var (
+		line    string
+		message map[string]any
+		err     error
+	)
+	if o.field == "" {
+		if line, err = deadletter.Line(event.Message); err != nil {
+			return nil, err
+		}
+	} else {
+		var ok bool
+		if message, ok = event.Message.(map[string]any); !ok {
+			return nil, ErrNotMap
+		}
+		if line, err = deadletter.Line(message[o.field]); err != nil {
+			return nil, errors.WithMessage(err, o.field)
+		}
+	}
+	fields := make(map[string]any, len(message))
+	for key, value := range message {
+		fields[key] = value
+	}
+	matched := false
+	for _, m := range o.matchers {
+		ok, err := m.match(line, fields, o.keepEmpty)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = true
+			if o.breakOnMatch {
+				break
+			}
+		}
+	}
+	if !matched {
+		return nil, ErrNoMatch
+	}
+	return fields, nil
+}
+
+//fail drop the event to dead letter
+func (o *operator) fail(event *athena.Event, cause error) {
+	o.metrics.Drop.Inc()
+	o.logger.Debugw("can't extract event.", "err", cause)
+	o.deadLetter.Fail(o.acker, event, cause)
+}
+
+func NewGrok() athena.Operator {
+	return &operator{grok: true}
+}
+
+func NewRegex() athena.Operator {
+	return &operator{}
+}
+
+func init() {
+	component.RegisterNewOperatorFunc("grok", NewGrok)
+	component.RegisterNewOperatorFunc("regex", NewRegex)
+}
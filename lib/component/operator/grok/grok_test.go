@@ -0,0 +1,242 @@
+package grok
+
+import (
+	"athena/athena"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPatternsCompile(t *testing.T) {
+	for name := range patterns {
+		if _, err := compileGrok("%{"+name+"}", nil, nil); err != nil {
+			t.Fatalf("pattern %s doesn't compile, %v", name, err)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	definitions := map[string]string{
+		"ID":      `[a-z]+-%{INT}`,
+		"REQUEST": `%{ID:id} %{WORD:action}`,
+		"SELF":    `a%{SELF}`,
+		"WORD":    `[A-Z]+`,
+	}
+	tests := []struct {
+		pattern string
+		line    string
+		fields  map[string]any
+		err     error
+	}{
+		{pattern: `%{REQUEST}`, line: "req-42 GET", fields: map[string]any{"id": "req-42", "action": "GET"}},
+		//custom definitions shadow the library
+		{pattern: `%{REQUEST}`, line: "req-42 get", fields: map[string]any{}},
+		{pattern: `^%{INT:a} %{INT:b}$`, line: "1 2", fields: map[string]any{"a": "1", "b": "2"}},
+		{pattern: `%{IP:[client][ip]}`, line: "from 10.0.0.1", fields: map[string]any{"[client][ip]": "10.0.0.1"}},
+		{pattern: `%{MISSING}`, err: ErrUnknownPattern},
+		{pattern: `%{SELF}`, err: ErrPatternRecursion},
+	}
+	for _, test := range tests {
+		m, err := compileGrok(test.pattern, definitions, nil)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Fatalf("pattern %s, expect %v, got %v", test.pattern, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("pattern %s, %v", test.pattern, err)
+		}
+		fields := map[string]any{}
+		if _, err = m.match(test.line, fields, false); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Fatalf("pattern %s line %s, expect %v, got %v", test.pattern, test.line, test.fields, fields)
+		}
+	}
+}
+
+func TestTypes(t *testing.T) {
+	tests := []struct {
+		pattern string
+		types   map[string]string
+		line    string
+		fields  map[string]any
+		err     bool
+	}{
+		{pattern: `%{NUMBER:x:int}`, line: "x=42", fields: map[string]any{"x": int64(42)}},
+		{pattern: `%{NUMBER:x:float}`, line: "x=4.5", fields: map[string]any{"x": 4.5}},
+		{pattern: `%{WORD:x:bool}`, line: "true", fields: map[string]any{"x": true}},
+		{pattern: `%{NUMBER:x}`, line: "42", fields: map[string]any{"x": "42"}},
+		//types override the hints
+		{pattern: `%{NUMBER:x:int}`, types: map[string]string{"x": "float"}, line: "42", fields: map[string]any{"x": 42.0}},
+		{pattern: `%{NUMBER:x}`, types: map[string]string{"x": "int"}, line: "42", fields: map[string]any{"x": int64(42)}},
+		{pattern: `%{NUMBER:x:int}`, line: "4.5", err: true},
+	}
+	for _, test := range tests {
+		m, err := compileGrok(test.pattern, nil, test.types)
+		if err != nil {
+			t.Fatalf("pattern %s, %v", test.pattern, err)
+		}
+		fields := map[string]any{}
+		if _, err = m.match(test.line, fields, false); (err != nil) != test.err {
+			t.Fatalf("pattern %s line %s, expect error %v, got %v", test.pattern, test.line, test.err, err)
+		}
+		if !test.err && !reflect.DeepEqual(fields, test.fields) {
+			t.Fatalf("pattern %s line %s, expect %v, got %v", test.pattern, test.line, test.fields, fields)
+		}
+	}
+	for _, pattern := range []string{`%{NUMBER:x:long}`, `(?P<x>\d+)`} {
+		var err error
+		if pattern[0] == '%' {
+			_, err = compileGrok(pattern, nil, nil)
+		} else {
+			_, err = compileRegex(pattern, map[string]string{"x": "long"})
+		}
+		if !errors.Is(err, ErrUnknownType) {
+			t.Fatalf("pattern %s, expect %v, got %v", pattern, ErrUnknownType, err)
+		}
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	tests := []struct {
+		pattern string
+		line    string
+		fields  map[string]any
+	}{
+		{
+			pattern: `%{COMBINEDAPACHELOG}`,
+			line: `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 ` +
+				`"http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			fields: map[string]any{
+				"clientip":    "127.0.0.1",
+				"ident":       "-",
+				"auth":        "frank",
+				"timestamp":   "10/Oct/2000:13:55:36 -0700",
+				"verb":        "GET",
+				"request":     "/apache_pb.gif",
+				"httpversion": "1.0",
+				"response":    int64(200),
+				"bytes":       int64(2326),
+				"referrer":    `"http://www.example.com/start.html"`,
+				"agent":       `"Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			},
+		},
+		{
+			pattern: `%{SYSLOGBASE} %{GREEDYDATA:message}`,
+			line:    "Oct 11 22:14:15 mymachine sshd[4123]: Accepted publickey for root",
+			fields: map[string]any{
+				"timestamp": "Oct 11 22:14:15",
+				"logsource": "mymachine",
+				"program":   "sshd",
+				"pid":       "4123",
+				"message":   "Accepted publickey for root",
+			},
+		},
+		{
+			pattern: `%{SYSLOGBASE}`,
+			line:    "Feb  3 04:05:06 10.0.0.1 cron:",
+			fields: map[string]any{
+				"timestamp": "Feb  3 04:05:06",
+				"logsource": "10.0.0.1",
+				"program":   "cron",
+			},
+		},
+	}
+	for _, test := range tests {
+		m, err := compileGrok(test.pattern, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := map[string]any{}
+		matched, err := m.match(test.line, fields, false)
+		if err != nil || !matched {
+			t.Fatalf("%s doesn't match %s, %v", test.pattern, test.line, err)
+		}
+		for key, value := range test.fields {
+			if !reflect.DeepEqual(fields[key], value) {
+				t.Fatalf("%s field %s, expect %v, got %v", test.pattern, key, value, fields[key])
+			}
+		}
+	}
+}
+
+func TestBreakOnMatch(t *testing.T) {
+	var matchers []*matcher
+	for _, pattern := range []string{`^%{WORD:verb} %{NOTSPACE:path}`, `%{INT:status:int}$`, `^%{WORD:first}`} {
+		m, err := compileGrok(pattern, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchers = append(matchers, m)
+	}
+	event := &athena.Event{Message: map[string]any{"line": "GET /index 200", "host": "a"}}
+	tests := []struct {
+		breakOnMatch bool
+		fields       map[string]any
+	}{
+		{breakOnMatch: true, fields: map[string]any{"line": "GET /index 200", "host": "a", "verb": "GET", "path": "/index"}},
+		{breakOnMatch: false, fields: map[string]any{"line": "GET /index 200", "host": "a", "verb": "GET", "path": "/index",
+			"status": int64(200), "first": "GET"}},
+	}
+	for _, test := range tests {
+		o := &operator{grok: true, matchers: matchers, field: "line", breakOnMatch: test.breakOnMatch}
+		fields, err := o.extract(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Fatalf("break on match %v, expect %v, got %v", test.breakOnMatch, test.fields, fields)
+		}
+	}
+	if _, ok := event.Message.(map[string]any)["verb"]; ok {
+		t.Fatalf("input message is modified")
+	}
+
+	//later matches override the earlier captures when merging
+	override, err := compileGrok(`%{INT:verb:int}`, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &operator{grok: true, matchers: []*matcher{matchers[0], override}, field: "line"}
+	fields, err := o.extract(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verb := fields.(map[string]any)["verb"]; verb != int64(200) {
+		t.Fatalf("later match doesn't override, verb %v", verb)
+	}
+
+	o = &operator{grok: true, matchers: matchers, breakOnMatch: true}
+	if _, err = o.extract(&athena.Event{Message: "--"}); !errors.Is(err, ErrNoMatch) {
+		t.Fatalf("expect %v, got %v", ErrNoMatch, err)
+	}
+	o.field = "line"
+	if _, err = o.extract(&athena.Event{Message: "GET /index 200"}); !errors.Is(err, ErrNotMap) {
+		t.Fatalf("expect %v, got %v", ErrNotMap, err)
+	}
+}
+
+func TestParseDefinitions(t *testing.T) {
+	definitions, err := parseDefinitions([]string{"ID  [a-z]+-%{INT} ", "EMPTY_OK x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := map[string]string{"ID": "[a-z]+-%{INT}", "EMPTY_OK": "x"}; !reflect.DeepEqual(definitions, expect) {
+		t.Fatalf("expect %v, got %v", expect, definitions)
+	}
+	for _, spec := range []string{"ID", "ID  ", ""} {
+		if _, err = parseDefinitions([]string{spec}); !errors.Is(err, ErrInvalidDefinition) {
+			t.Fatalf("definition %q, expect %v, got %v", spec, ErrInvalidDefinition, err)
+		}
+	}
+	types, err := parseTypes([]string{"[a][b]:int", "x:float"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := map[string]string{"[a][b]": "int", "x": "float"}; !reflect.DeepEqual(types, expect) {
+		t.Fatalf("expect %v, got %v", expect, types)
+	}
+}
@@ -0,0 +1,97 @@
+package mutate
+
+import (
+	"athena/athena"
+	"athena/lib/component"
+	"athena/lib/deadletter"
+	"athena/lib/log"
+	"athena/lib/metrics"
+	"athena/lib/properties"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+var (
+	OperationsProperty = properties.NewRequiredProperty[[]string]("operations",
+		"ordered operations: rename FROM TO, copy FROM TO, remove PATH, set PATH VALUE, convert PATH string|int|float|bool, "+
+			"flatten PATH [SEPARATOR], unflatten PATH [SEPARATOR], time PATH [LAYOUT|unix|unix_ms|unix_us|unix_ns]; "+
+			"path is dotted like message.a.b or json pointer like /meta/a~1b, rename between meta and message moves the field")
+
+	ErrUnknownOperation = fmt.Errorf("unknown operation")
+	ErrMissingArgument  = fmt.Errorf("missing argument")
+	ErrInvalidPath      = fmt.Errorf("path should start with meta or message")
+	ErrUnknownType      = fmt.Errorf("unknown type")
+	ErrNotMap           = fmt.Errorf("value is not map")
+	ErrConvert          = fmt.Errorf("can't convert")
+)
+
+type operator struct {
+	ctx        athena.Context
+	logger     athena.Logger
+	metrics    *metrics.Metrics
+	acker      athena.ACKer
+	emitNext   athena.EmitNext
+	operations []operation
+	deadLetter *deadletter.Writer
+}
+
+func (o *operator) Open(ctx athena.Context) (err error) {
+	o.ctx = ctx
+	o.logger = log.Ctx(o.ctx)
+	o.metrics = metrics.Ctx(o.ctx)
+	o.acker = athena.NewACKer(ctx)
+	for _, spec := range ctx.Properties().GetStringSlice(OperationsProperty) {
+		op, err := compile(spec)
+		if err != nil {
+			return errors.WithMessagef(err, "invalid operation %s", spec)
+		}
+		o.operations = append(o.operations, op)
+	}
+	o.deadLetter, err = deadletter.New(ctx)
+	return err
+}
+
+func (o *operator) Close() error {
+	o.acker.Close()
+	return o.deadLetter.Close()
+}
+
+func (o *operator) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{OperationsProperty, deadletter.PathProperty}
+}
+
+func (o *operator) Collect(emitNext athena.EmitNext) error {
+	o.emitNext = emitNext
+	<-o.ctx.Done()
+	return nil
+}
+
+func (o *operator) GenerateEmit(_ athena.Context) athena.Emit {
+	return o.emit
+}
+
+func (o *operator) emit(event *athena.Event) {
+	d := newDocument(event)
+	for _, op := range o.operations {
+		if err := op(d); err != nil {
+			o.fail(event, err)
+			return
+		}
+	}
+	o.emitNext(d.event(event), nil)
+}
+
+//fail drop the event to dead letter
+func (o *operator) fail(event *athena.Event, cause error) {
+	o.metrics.Drop.Inc()
+	o.logger.Debugw("can't mutate event.", "err", cause)
+	o.deadLetter.Fail(o.acker, event, cause)
+}
+
+func New() athena.Operator {
+	return &operator{}
+}
+
+func init() {
+	component.RegisterNewOperatorFunc("mutate", New)
+}
@@ -0,0 +1,331 @@
+package mutate
+
+import (
+	"athena/athena"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+
+	LayoutUnix      = "unix"
+	LayoutUnixMilli = "unix_ms"
+	LayoutUnixMicro = "unix_us"
+	LayoutUnixNano  = "unix_ns"
+
+	defaultSeparator = "."
+)
+
+//operation mutate the document, missing source path is ignored
+type operation func(d *document) error
+
+//arity is the min and max arguments of operations
+var arity = map[string][2]int{
+	"rename":    {2, 2},
+	"copy":      {2, 2},
+	"remove":    {1, 1},
+	"set":       {2, 2},
+	"convert":   {2, 2},
+	"flatten":   {1, 2},
+	"unflatten": {1, 2},
+	"time":      {1, 2},
+}
+
+//compile the operation spec like rename message.a meta.a, the last argument takes the rest of spec
+func compile(spec string) (operation, error) {
+	name, rest := next(spec)
+	n, ok := arity[name]
+	if !ok {
+		return nil, errors.WithMessage(ErrUnknownOperation, name)
+	}
+	var args []string
+	for rest != "" {
+		if len(args) == n[1]-1 {
+			args = append(args, rest)
+			break
+		}
+		var arg string
+		arg, rest = next(rest)
+		args = append(args, arg)
+	}
+	if len(args) < n[0] {
+		return nil, errors.WithMessagef(ErrMissingArgument, "%s needs %d", name, n[0])
+	}
+	p, err := parsePath(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var arg string
+	if len(args) > 1 {
+		arg = args[1]
+	}
+	switch name {
+	case "rename", "copy":
+		to, err := parsePath(arg)
+		if err != nil {
+			return nil, err
+		}
+		return move(p, to, name == "copy"), nil
+	case "remove":
+		return func(d *document) error {
+			return d.remove(p)
+		}, nil
+	case "set":
+		return set(p, arg)
+	case "convert":
+		switch arg {
+		case TypeString, TypeInt, TypeFloat, TypeBool:
+		default:
+			return nil, errors.WithMessage(ErrUnknownType, arg)
+		}
+		return update(p, func(value any) (any, error) {
+			return convert(value, arg)
+		}), nil
+	case "flatten", "unflatten":
+		if arg == "" {
+			arg = defaultSeparator
+		}
+		return update(p, func(value any) (any, error) {
+			m, ok := value.(map[string]any)
+			if !ok {
+				return nil, errors.WithMessage(ErrNotMap, p.String())
+			}
+			if name == "flatten" {
+				return flatten(m, arg), nil
+			}
+			return unflatten(m, arg), nil
+		}), nil
+	case "time":
+		if arg == "" {
+			arg = time.RFC3339
+		}
+		return func(d *document) error {
+			value, ok := d.get(p)
+			if !ok {
+				return nil
+			}
+			t, err := parseTime(value, arg)
+			if err != nil {
+				return errors.WithMessage(err, p.String())
+			}
+			d.time = t
+			return nil
+		}, nil
+	}
+	return nil, errors.WithMessage(ErrUnknownOperation, name)
+}
+
+//next split the first word of text
+func next(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	index := strings.IndexAny(text, " \t")
+	if index < 0 {
+		return text, ""
+	}
+	return text[:index], strings.TrimSpace(text[index:])
+}
+
+func move(from path, to path, keep bool) operation {
+	return func(d *document) error {
+		value, ok := d.get(from)
+		if !ok {
+			return nil
+		}
+		if keep {
+			value = deepCopy(value)
+		} else if err := d.remove(from); err != nil {
+			return err
+		}
+		return d.set(to, value)
+	}
+}
+
+func update(p path, fn func(value any) (any, error)) operation {
+	return func(d *document) error {
+		value, ok := d.get(p)
+		if !ok {
+			return nil
+		}
+		updated, err := fn(value)
+		if err != nil {
+			return errors.WithMessage(err, p.String())
+		}
+		return d.set(p, updated)
+	}
+}
+
+//set the value, value is json literal like 1, true or {"a":1}, text/template of event if it has {{, or the string as is
+func set(p path, text string) (operation, error) {
+	if strings.Contains(text, "{{") {
+		t, err := template.New(p.String()).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		return func(d *document) error {
+			builder := &strings.Builder{}
+			if err := t.Execute(builder, d.event(&athena.Event{})); err != nil {
+				return err
+			}
+			return d.set(p, builder.String())
+		}, nil
+	}
+	var value any = text
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		value = i
+	} else if err = json.Unmarshal([]byte(text), &value); err != nil {
+		value = text
+	}
+	return func(d *document) error {
+		return d.set(p, deepCopy(value))
+	}, nil
+}
+
+func convert(value any, typ string) (any, error) {
+	switch typ {
+	case TypeString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			return string(v), nil
+		case time.Time:
+			return v.Format(time.RFC3339Nano), nil
+		case map[string]any, []any:
+			text, err := json.Marshal(v)
+			return string(text), err
+		}
+		return fmt.Sprint(value), nil
+	case TypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(strings.TrimSpace(v))
+		}
+		f, err := toFloat(value)
+		return f != 0, err
+	case TypeInt:
+		if text, ok := value.(string); ok {
+			return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		}
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return rv.Int(), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int64(rv.Uint()), nil
+		}
+		f, err := toFloat(value)
+		return int64(f), err
+	}
+	return toFloat(value)
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case json.Number:
+		return v.Float64()
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+	return 0, errors.WithMessagef(ErrConvert, "%T", value)
+}
+
+//flatten nested maps to separated keys, like {a: {b: 1}} to {a.b: 1}
+func flatten(m map[string]any, separator string) map[string]any {
+	flat := make(map[string]any, len(m))
+	var walk func(prefix string, m map[string]any)
+	walk = func(prefix string, m map[string]any) {
+		for key, value := range m {
+			if nested, ok := value.(map[string]any); ok && len(nested) > 0 {
+				walk(prefix+key+separator, nested)
+			} else {
+				flat[prefix+key] = value
+			}
+		}
+	}
+	walk("", m)
+	return flat
+}
+
+//unflatten separated keys to nested maps, keys are sorted so a.b overrides a
+func unflatten(m map[string]any, separator string) map[string]any {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	nested := make(map[string]any, len(m))
+	for _, key := range keys {
+		current := nested
+		parts := strings.Split(key, separator)
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := current[part].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				current[part] = child
+			}
+			current = child
+		}
+		current[parts[len(parts)-1]] = m[key]
+	}
+	return nested
+}
+
+//units is the unit of unix time layouts
+var units = map[string]time.Duration{
+	LayoutUnix:      time.Second,
+	LayoutUnixMilli: time.Millisecond,
+	LayoutUnixMicro: time.Microsecond,
+	LayoutUnixNano:  time.Nanosecond,
+}
+
+//parseTime parse the value with time layout, or unix unix_ms unix_us unix_ns of number
+func parseTime(value any, layout string) (time.Time, error) {
+	if t, ok := value.(time.Time); ok {
+		return t, nil
+	}
+	if unit, ok := units[layout]; ok {
+		//integers keep the precision of nanoseconds
+		if i, err := convert(value, TypeInt); err == nil {
+			if f, err := toFloat(value); err == nil && float64(i.(int64)) == f {
+				return time.Unix(0, i.(int64)*int64(unit)), nil
+			}
+		}
+		f, err := toFloat(value)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, int64(f*float64(unit))), nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return time.Time{}, errors.WithMessagef(ErrConvert, "%T", value)
+	}
+	return time.Parse(layout, text)
+}
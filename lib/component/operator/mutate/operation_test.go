@@ -0,0 +1,182 @@
+package mutate
+
+import (
+	"athena/athena"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//newEvent return the event with nested maps, a new one each call so tests can compare with the input
+func newEvent() *athena.Event {
+	return &athena.Event{
+		Meta: map[string]any{"file": "a.log"},
+		Message: map[string]any{
+			"user": map[string]any{"name": "frank", "id": "42", "tags": []any{"a"}},
+			"a/b":  map[string]any{"c~d": 1},
+			"ts":   "2024-01-02T03:04:05Z",
+		},
+		Time: time.Unix(1, 0),
+	}
+}
+
+//run the operations on the event
+func run(t *testing.T, event *athena.Event, specs ...string) (*athena.Event, error) {
+	d := newDocument(event)
+	for _, spec := range specs {
+		op, err := compile(spec)
+		if err != nil {
+			t.Fatalf("spec %s, %v", spec, err)
+		}
+		if err = op(d); err != nil {
+			return nil, err
+		}
+	}
+	return d.event(event), nil
+}
+
+func TestOperations(t *testing.T) {
+	tests := []struct {
+		specs   []string
+		meta    map[string]any
+		message map[string]any
+	}{
+		{
+			specs: []string{"rename message.user.name message.user.login"},
+			message: map[string]any{
+				"user": map[string]any{"login": "frank", "id": "42", "tags": []any{"a"}},
+				"a/b":  map[string]any{"c~d": 1},
+				"ts":   "2024-01-02T03:04:05Z",
+			},
+		},
+		{
+			specs: []string{"rename /message/a~1b/c~0d meta.cd", "remove message.user.tags", "remove message.ts"},
+			meta:  map[string]any{"file": "a.log", "cd": 1},
+			message: map[string]any{
+				"user": map[string]any{"name": "frank", "id": "42"},
+				"a/b":  map[string]any{},
+			},
+		},
+		{
+			specs: []string{"copy message.user meta.user", "set meta.user.name {{ .Meta.file }}", "convert message.user.id int",
+				"remove message.a/b", "remove message.ts", "set message.missing.key x y"},
+			meta: map[string]any{"file": "a.log", "user": map[string]any{"name": "a.log", "id": "42", "tags": []any{"a"}}},
+			message: map[string]any{
+				"user":    map[string]any{"name": "frank", "id": int64(42), "tags": []any{"a"}},
+				"missing": map[string]any{"key": "x y"},
+			},
+		},
+		{
+			specs:   []string{"flatten message _", "remove message.ts", "remove /message/a~1b_c~0d"},
+			message: map[string]any{"user_name": "frank", "user_id": "42", "user_tags": []any{"a"}},
+		},
+		{
+			specs: []string{"flatten message.user", "unflatten message.user"},
+			message: map[string]any{
+				"user": map[string]any{"name": "frank", "id": "42", "tags": []any{"a"}},
+				"a/b":  map[string]any{"c~d": 1},
+				"ts":   "2024-01-02T03:04:05Z",
+			},
+		},
+	}
+	for _, test := range tests {
+		event := newEvent()
+		out, err := run(t, event, test.specs...)
+		if err != nil {
+			t.Fatalf("specs %v, %v", test.specs, err)
+		}
+		if test.meta == nil {
+			test.meta = map[string]any{"file": "a.log"}
+		}
+		if !reflect.DeepEqual(out.Meta, test.meta) {
+			t.Fatalf("specs %v, expect meta %v, got %v", test.specs, test.meta, out.Meta)
+		}
+		if !reflect.DeepEqual(out.Message, test.message) {
+			t.Fatalf("specs %v, expect message %v, got %v", test.specs, test.message, out.Message)
+		}
+		//the input event is shared by outputs and must be unchanged
+		if expect := newEvent(); !reflect.DeepEqual(event, expect) {
+			t.Fatalf("specs %v, input event is modified, %v", test.specs, event)
+		}
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	event := newEvent()
+	out, err := run(t, event, "set message.user.age 7", `set message.user.extra {"f": [1, true]}`, "set message.user.name null",
+		"set message.user.note hello world", "copy message.user.extra message.copied", "set message.copied.f 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := out.Message.(map[string]any)["user"].(map[string]any)
+	expect := map[string]any{"name": nil, "id": "42", "tags": []any{"a"}, "age": int64(7),
+		"extra": map[string]any{"f": []any{float64(1), true}}, "note": "hello world"}
+	if !reflect.DeepEqual(user, expect) {
+		t.Fatalf("expect %v, got %v", expect, user)
+	}
+	//copied values are deep copies
+	if copied := out.Message.(map[string]any)["copied"]; !reflect.DeepEqual(copied, map[string]any{"f": int64(0)}) {
+		t.Fatalf("copy is not deep, %v", copied)
+	}
+	if !reflect.DeepEqual(event, newEvent()) {
+		t.Fatalf("input event is modified, %v", event)
+	}
+}
+
+func TestTime(t *testing.T) {
+	tests := []struct {
+		spec  string
+		value any
+		time  time.Time
+	}{
+		{spec: "time message.ts", value: "2024-01-02T03:04:05Z", time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{spec: "time message.ts 2006-01-02 15:04", value: "2024-01-02 03:04", time: time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)},
+		{spec: "time message.ts unix", value: int64(1700000000), time: time.Unix(1700000000, 0)},
+		{spec: "time message.ts unix", value: 1.5, time: time.Unix(1, 5e8)},
+		{spec: "time message.ts unix_ms", value: "1700000000123", time: time.UnixMilli(1700000000123)},
+		{spec: "time message.ts unix_ns", value: int64(1700000000123456789), time: time.Unix(0, 1700000000123456789)},
+		{spec: "time message.missing", time: time.Unix(1, 0)},
+	}
+	for _, test := range tests {
+		event := &athena.Event{Message: map[string]any{"ts": test.value}, Time: time.Unix(1, 0)}
+		out, err := run(t, event, test.spec)
+		if err != nil {
+			t.Fatalf("spec %s, %v", test.spec, err)
+		}
+		if !out.Time.Equal(test.time) {
+			t.Fatalf("spec %s, expect %v, got %v", test.spec, test.time, out.Time)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  error
+	}{
+		{spec: "move message.a message.b", err: ErrUnknownOperation},
+		{spec: "rename message.a", err: ErrMissingArgument},
+		{spec: "remove", err: ErrMissingArgument},
+		{spec: "remove a.b", err: ErrInvalidPath},
+		{spec: "rename message.a b", err: ErrInvalidPath},
+		{spec: "convert message.a long", err: ErrUnknownType},
+	}
+	for _, test := range tests {
+		if _, err := compile(test.spec); !errors.Is(err, test.err) {
+			t.Fatalf("spec %s, expect %v, got %v", test.spec, test.err, err)
+		}
+	}
+	if _, err := run(t, newEvent(), "convert message.user.name int"); err == nil {
+		t.Fatalf("convert illegal int is accepted")
+	}
+	for _, spec := range []string{"flatten message.ts", "set message.user.tags.x 1", "rename message.ts message.user.name.x"} {
+		event := newEvent()
+		if _, err := run(t, event, spec); !errors.Is(err, ErrNotMap) {
+			t.Fatalf("spec %s, expect %v, got %v", spec, ErrNotMap, err)
+		}
+		if !reflect.DeepEqual(event, newEvent()) {
+			t.Fatalf("spec %s, input event is modified, %v", spec, event)
+		}
+	}
+}
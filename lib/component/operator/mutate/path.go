@@ -0,0 +1,182 @@
+package mutate
+
+import (
+	"athena/athena"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	RootMeta    = "meta"
+	RootMessage = "message"
+)
+
+//path is the keys from the root, the first key is meta or message
+type path []string
+
+//parsePath parse dotted path like message.a.b or json pointer like /message/a~1b
+func parsePath(text string) (path, error) {
+	var p path
+	if strings.HasPrefix(text, "/") {
+		replacer := strings.NewReplacer("~1", "/", "~0", "~")
+		for _, key := range strings.Split(text[1:], "/") {
+			p = append(p, replacer.Replace(key))
+		}
+	} else {
+		p = strings.Split(text, ".")
+	}
+	if p[0] != RootMeta && p[0] != RootMessage {
+		return nil, errors.WithMessage(ErrInvalidPath, text)
+	}
+	return p, nil
+}
+
+func (p path) String() string {
+	return strings.Join(p, ".")
+}
+
+//document is the mutable copy of event, maps are copied on first write as events are shared by outputs
+type document struct {
+	meta    map[string]any
+	message any
+	time    time.Time
+	owned   map[uintptr]struct{}
+}
+
+func newDocument(event *athena.Event) *document {
+	return &document{meta: event.Meta, message: event.Message, time: event.Time, owned: map[uintptr]struct{}{}}
+}
+
+func (d *document) event(event *athena.Event) *athena.Event {
+	return &athena.Event{Meta: d.meta, Message: d.message, Time: d.time, Private: event.Private}
+}
+
+//own return the writable copy of the map
+func (d *document) own(m map[string]any) map[string]any {
+	if m != nil {
+		if _, ok := d.owned[reflect.ValueOf(m).Pointer()]; ok {
+			return m
+		}
+	}
+	owned := make(map[string]any, len(m)+1)
+	for key, value := range m {
+		owned[key] = value
+	}
+	d.owned[reflect.ValueOf(owned).Pointer()] = struct{}{}
+	return owned
+}
+
+func (d *document) root(p path) any {
+	if p[0] == RootMeta {
+		return d.meta
+	}
+	return d.message
+}
+
+//get the value of path, return false if missing
+func (d *document) get(p path) (any, bool) {
+	current := d.root(p)
+	if p[0] == RootMeta && d.meta == nil {
+		return nil, false
+	}
+	for _, key := range p[1:] {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+//container return the writable map of path, missing maps are created
+func (d *document) container(p path) (map[string]any, error) {
+	var current map[string]any
+	if p[0] == RootMeta {
+		d.meta = d.own(d.meta)
+		current = d.meta
+	} else {
+		m, ok := d.message.(map[string]any)
+		if !ok && d.message != nil {
+			return nil, errors.WithMessage(ErrNotMap, RootMessage)
+		}
+		current = d.own(m)
+		d.message = current
+	}
+	for i, key := range p[1:] {
+		m, ok := current[key].(map[string]any)
+		if !ok && current[key] != nil {
+			return nil, errors.WithMessage(ErrNotMap, p[:i+2].String())
+		}
+		m = d.own(m)
+		current[key] = m
+		current = m
+	}
+	return current, nil
+}
+
+//set the value of path, the whole meta or message is replaced if path is root
+func (d *document) set(p path, value any) error {
+	if len(p) == 1 {
+		if p[0] == RootMessage {
+			d.message = value
+			return nil
+		}
+		m, ok := value.(map[string]any)
+		if !ok {
+			return errors.WithMessage(ErrNotMap, RootMeta)
+		}
+		d.meta = m
+		return nil
+	}
+	m, err := d.container(p[:len(p)-1])
+	if err != nil {
+		return err
+	}
+	m[p[len(p)-1]] = value
+	return nil
+}
+
+//remove the path, missing path is ignored
+func (d *document) remove(p path) error {
+	if len(p) == 1 {
+		if p[0] == RootMessage {
+			d.message = nil
+		} else {
+			d.meta = map[string]any{}
+		}
+		return nil
+	}
+	if _, ok := d.get(p); !ok {
+		return nil
+	}
+	m, err := d.container(p[:len(p)-1])
+	if err != nil {
+		return err
+	}
+	delete(m, p[len(p)-1])
+	return nil
+}
+
+//deepCopy copy nested maps and slices
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, item := range v {
+			copied[key] = deepCopy(item)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, item := range v {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	}
+	return value
+}
@@ -0,0 +1,142 @@
+package mutate
+
+import (
+	"athena/athena"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		text string
+		path path
+		err  error
+	}{
+		{text: "message", path: path{"message"}},
+		{text: "message.a.b", path: path{"message", "a", "b"}},
+		{text: "meta.file", path: path{"meta", "file"}},
+		{text: "/message/a~1b", path: path{"message", "a/b"}},
+		{text: "/message/a~0b", path: path{"message", "a~b"}},
+		//~01 is ~1 not /
+		{text: "/message/a~01", path: path{"message", "a~1"}},
+		{text: "/meta/a.b/c", path: path{"meta", "a.b", "c"}},
+		{text: "/message/", path: path{"message", ""}},
+		{text: "event.a", err: ErrInvalidPath},
+		{text: "/a/b", err: ErrInvalidPath},
+		{text: "", err: ErrInvalidPath},
+	}
+	for _, test := range tests {
+		p, err := parsePath(test.text)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Fatalf("path %q, expect %v, got %v", test.text, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("path %q, %v", test.text, err)
+		}
+		if !reflect.DeepEqual(p, test.path) {
+			t.Fatalf("path %q, expect %v, got %v", test.text, test.path, p)
+		}
+	}
+}
+
+//pointer return the address of map to check whether it's copied
+func pointer(value any) uintptr {
+	return reflect.ValueOf(value).Pointer()
+}
+
+func TestDocumentCopyOnWrite(t *testing.T) {
+	nested := map[string]any{"b": 1}
+	sibling := map[string]any{"d": 2}
+	message := map[string]any{"a": nested, "c": sibling}
+	meta := map[string]any{"file": "a.log"}
+	event := &athena.Event{Meta: meta, Message: message}
+
+	d := newDocument(event)
+	if err := d.set(path{"message", "a", "x"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	out := d.message.(map[string]any)
+	if pointer(out) == pointer(message) || pointer(out["a"]) == pointer(nested) {
+		t.Fatalf("written maps are not copied")
+	}
+	if pointer(out["c"]) != pointer(sibling) || pointer(d.meta) != pointer(meta) {
+		t.Fatalf("untouched maps are copied")
+	}
+
+	//owned maps are written in place
+	owned := out["a"]
+	if err := d.set(path{"message", "a", "y"}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if pointer(d.message) != pointer(out) || pointer(d.message.(map[string]any)["a"]) != pointer(owned) {
+		t.Fatalf("owned maps are copied again")
+	}
+	if err := d.remove(path{"message", "c", "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.set(path{"meta", "offset"}, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]any{"a": map[string]any{"b": 1, "x": 1, "y": 2}, "c": map[string]any{}}
+	if !reflect.DeepEqual(d.message, expect) {
+		t.Fatalf("expect %v, got %v", expect, d.message)
+	}
+	if expect := map[string]any{"file": "a.log", "offset": 10}; !reflect.DeepEqual(d.meta, expect) {
+		t.Fatalf("expect %v, got %v", expect, d.meta)
+	}
+	//the input event is unchanged
+	if !reflect.DeepEqual(message, map[string]any{"a": map[string]any{"b": 1}, "c": map[string]any{"d": 2}}) {
+		t.Fatalf("input message is modified, %v", message)
+	}
+	if !reflect.DeepEqual(meta, map[string]any{"file": "a.log"}) {
+		t.Fatalf("input meta is modified, %v", meta)
+	}
+
+	//documents of the same event don't share the owned maps
+	other := newDocument(event)
+	if err := other.set(path{"message", "a", "z"}, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.message.(map[string]any)["a"].(map[string]any)["z"]; ok {
+		t.Fatalf("documents share owned maps")
+	}
+}
+
+func TestDocument(t *testing.T) {
+	d := newDocument(&athena.Event{Message: "line"})
+	if err := d.set(path{"message", "a"}, 1); !errors.Is(err, ErrNotMap) {
+		t.Fatalf("expect %v, got %v", ErrNotMap, err)
+	}
+	if _, ok := d.get(path{"meta", "a"}); ok {
+		t.Fatalf("nil meta has key")
+	}
+	if err := d.set(path{"meta"}, "line"); !errors.Is(err, ErrNotMap) {
+		t.Fatalf("expect %v, got %v", ErrNotMap, err)
+	}
+
+	d = newDocument(&athena.Event{Message: map[string]any{"a": "b"}})
+	if err := d.set(path{"message", "a", "c"}, 1); !errors.Is(err, ErrNotMap) {
+		t.Fatalf("expect %v, got %v", ErrNotMap, err)
+	}
+	//missing maps are created
+	if err := d.set(path{"message", "x", "y", "z"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := d.get(path{"message", "x", "y", "z"}); !ok || value != 1 {
+		t.Fatalf("expect 1, got %v", value)
+	}
+	if err := d.remove(path{"message", "missing", "key"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.get(path{"message", "missing"}); ok {
+		t.Fatalf("remove missing path creates maps")
+	}
+	if err := d.remove(path{"message"}); err != nil || d.message != nil {
+		t.Fatalf("message is not removed, %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package parse
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeTime   = "time"
+	TypeList   = "list"
+	TypeSplit  = "split"
+
+	//skipName is the field not kept
+	skipName = "-"
+	//restSuffix mark the field taking the rest of line
+	restSuffix = "..."
+	//empty is the placeholder of empty value in access logs
+	empty = "-"
+)
+
+var (
+	ErrUnknownType     = fmt.Errorf("unknown field type")
+	ErrRestNotLast     = fmt.Errorf("rest field should be the last")
+	ErrEmptyLayout     = fmt.Errorf("layout is empty")
+	ErrUnknownPreset   = fmt.Errorf("unknown preset")
+	ErrMissingField    = fmt.Errorf("missing field")
+	ErrUnclosedQuote   = fmt.Errorf("unclosed quote")
+	ErrUnclosedBracket = fmt.Errorf("unclosed bracket")
+
+	//Presets is the layouts of known access logs
+	Presets = map[string][]string{
+		"nginx-combined": {"remote_addr", "-", "remote_user", "time_local:time:02/Jan/2006:15:04:05 -0700",
+			"method|path|protocol:split: ", "status:int", "body_bytes_sent:int", "http_referer", "http_user_agent"},
+		"apache-common": {"host", "ident", "user", "time:time:02/Jan/2006:15:04:05 -0700",
+			"method|path|protocol:split: ", "status:int", "bytes:int"},
+		"edge":   edgeLayout,
+		"origin": append([]string{"host"}, edgeLayout...),
+	}
+	edgeLayout = []string{"client_ip", "domain", "content_type", "request_time",
+		"http_method|url|http_version:split: ", "http_code:int", "bytes_sent:int", "refer", "ua",
+		"response_time:int", "body_bytes_sent:int", "content_length:int", "range", "x_forwarded_for",
+		"complex_field0:list:@", "complex_field1:list:@", "x_peer", "unnamed", "hit", "hierarchy", "ext...:list:@_@"}
+)
+
+//field is one compiled field spec name[:type[:arg]]
+type field struct {
+	spec  string
+	names []string
+	typ   string
+	arg   string
+	rest  bool
+}
+
+//Layout parse a line to named and typed fields
+type Layout struct {
+	fields []field
+}
+
+//Compile the field specs, spec is name[:type[:arg]], arg is time layout for time, separator for list and split,
+//name - skips the field, name a|b|c of split assigns the parts, name suffix ... takes the rest of line
+func Compile(specs []string) (*Layout, error) {
+	if len(specs) == 0 {
+		return nil, ErrEmptyLayout
+	}
+	layout := &Layout{}
+	for i, spec := range specs {
+		parts := strings.SplitN(spec, ":", 3)
+		f := field{spec: spec, typ: TypeString}
+		name := parts[0]
+		if strings.HasSuffix(name, restSuffix) {
+			if i != len(specs)-1 {
+				return nil, errors.WithMessage(ErrRestNotLast, spec)
+			}
+			f.rest = true
+			name = strings.TrimSuffix(name, restSuffix)
+		}
+		if len(parts) > 1 && parts[1] != "" {
+			f.typ = parts[1]
+		}
+		if len(parts) > 2 {
+			f.arg = parts[2]
+		}
+		switch f.typ {
+		case TypeString, TypeInt, TypeFloat:
+		case TypeTime:
+			if f.arg == "" {
+				f.arg = time.RFC3339
+			}
+		case TypeList:
+			if f.arg == "" {
+				f.arg = ","
+			}
+		case TypeSplit:
+			if f.arg == "" {
+				f.arg = " "
+			}
+		default:
+			return nil, errors.WithMessage(ErrUnknownType, spec)
+		}
+		if f.typ == TypeSplit {
+			f.names = strings.Split(name, "|")
+		} else {
+			f.names = []string{name}
+		}
+		layout.fields = append(layout.fields, f)
+	}
+	return layout, nil
+}
+
+//Preset return the compiled layout of preset
+func Preset(name string) (*Layout, error) {
+	specs, ok := Presets[name]
+	if !ok {
+		return nil, errors.WithMessage(ErrUnknownPreset, name)
+	}
+	return Compile(specs)
+}
+
+//Parse the line, tokens beyond the layout are ignored
+func (l *Layout) Parse(line string) (map[string]any, error) {
+	t := &tokenizer{line: strings.TrimSpace(line)}
+	parsed := make(map[string]any, len(l.fields))
+	for _, f := range l.fields {
+		var (
+			token string
+			err   error
+		)
+		if f.rest {
+			token = t.rest()
+		} else if token, err = t.next(); err != nil {
+			return nil, errors.WithMessage(err, f.spec)
+		}
+		if f.rest && token == "" || !f.rest && t.eof && token == "" {
+			return nil, errors.WithMessage(ErrMissingField, f.spec)
+		}
+		if err = f.set(parsed, token); err != nil {
+			return nil, errors.WithMessagef(err, "field %s", f.spec)
+		}
+	}
+	return parsed, nil
+}
+
+func (f *field) set(parsed map[string]any, token string) error {
+	if f.names[0] == skipName {
+		return nil
+	}
+	switch f.typ {
+	case TypeString:
+		parsed[f.names[0]] = token
+	case TypeList:
+		parsed[f.names[0]] = strings.Split(token, f.arg)
+	case TypeSplit:
+		parts := strings.SplitN(token, f.arg, len(f.names))
+		for i, part := range parts {
+			if f.names[i] != skipName {
+				parsed[f.names[i]] = part
+			}
+		}
+	default:
+		//typed empty value is omitted
+		if token == empty {
+			return nil
+		}
+		value, err := f.convert(token)
+		if err != nil {
+			return err
+		}
+		parsed[f.names[0]] = value
+	}
+	return nil
+}
+
+func (f *field) convert(token string) (any, error) {
+	switch f.typ {
+	case TypeInt:
+		return strconv.ParseInt(token, 10, 64)
+	case TypeFloat:
+		return strconv.ParseFloat(token, 64)
+	case TypeTime:
+		return time.Parse(f.arg, token)
+	}
+	return token, nil
+}
+
+//tokenizer split line on spaces, "quoted" and [bracketed] tokens may contain spaces
+type tokenizer struct {
+	line string
+	pos  int
+	eof  bool
+}
+
+func (t *tokenizer) skipSpaces() {
+	for t.pos < len(t.line) && (t.line[t.pos] == ' ' || t.line[t.pos] == '\t') {
+		t.pos++
+	}
+}
+
+//next return the next token without quotes or brackets
+func (t *tokenizer) next() (string, error) {
+	t.skipSpaces()
+	if t.pos >= len(t.line) {
+		t.eof = true
+		return "", nil
+	}
+	switch t.line[t.pos] {
+	case '"':
+		builder := &strings.Builder{}
+		for i := t.pos + 1; i < len(t.line); i++ {
+			switch c := t.line[i]; c {
+			case '\\':
+				if i+1 < len(t.line) && (t.line[i+1] == '"' || t.line[i+1] == '\\') {
+					i++
+					builder.WriteByte(t.line[i])
+				} else {
+					builder.WriteByte(c)
+				}
+			case '"':
+				t.pos = i + 1
+				return builder.String(), nil
+			default:
+				builder.WriteByte(c)
+			}
+		}
+		return "", ErrUnclosedQuote
+	case '[':
+		end := strings.IndexByte(t.line[t.pos:], ']')
+		if end < 0 {
+			return "", ErrUnclosedBracket
+		}
+		token := t.line[t.pos+1 : t.pos+end]
+		t.pos += end + 1
+		return token, nil
+	}
+	start := t.pos
+	for t.pos < len(t.line) && t.line[t.pos] != ' ' && t.line[t.pos] != '\t' {
+		t.pos++
+	}
+	return t.line[start:t.pos], nil
+}
+
+//rest return the rest of line as is
+func (t *tokenizer) rest() string {
+	t.skipSpaces()
+	token := t.line[t.pos:]
+	t.pos = len(t.line)
+	return token
+}
@@ -0,0 +1,136 @@
+package parse
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTokenizer(t *testing.T) {
+	tests := []struct {
+		line   string
+		tokens []string
+		err    error
+	}{
+		{"a  b\tc", []string{"a", "b", "c"}, nil},
+		{`"a b" c`, []string{"a b", "c"}, nil},
+		{`"say \"hi\"" "back\\slash" "keep \n"`, []string{`say "hi"`, `back\slash`, `keep \n`}, nil},
+		{`"" -`, []string{"", "-"}, nil},
+		{"[10/Oct/2022:13:55:36 +0800] x", []string{"10/Oct/2022:13:55:36 +0800", "x"}, nil},
+		{`["quoted" in bracket]`, []string{`"quoted" in bracket`}, nil},
+		{`a"b c`, []string{`a"b`, "c"}, nil},
+		{`a "unclosed`, []string{"a"}, ErrUnclosedQuote},
+		{`a "escaped\"`, []string{"a"}, ErrUnclosedQuote},
+		{"a [unclosed", []string{"a"}, ErrUnclosedBracket},
+	}
+	for _, test := range tests {
+		tk := &tokenizer{line: test.line}
+		var tokens []string
+		var err error
+		for {
+			var token string
+			if token, err = tk.next(); err != nil || tk.eof {
+				break
+			}
+			tokens = append(tokens, token)
+		}
+		if err != test.err || !reflect.DeepEqual(tokens, test.tokens) {
+			t.Fatalf("%s: expected %q %v, got %q %v", test.line, test.tokens, test.err, tokens, err)
+		}
+	}
+	tk := &tokenizer{line: `a   rest of "line`}
+	if token, _ := tk.next(); token != "a" || tk.rest() != `rest of "line` || tk.rest() != "" {
+		t.Fatal("rest is not the rest of line")
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		specs []string
+		err   error
+	}{
+		{nil, ErrEmptyLayout},
+		{[]string{"a:bool"}, ErrUnknownType},
+		{[]string{"a...", "b"}, ErrRestNotLast},
+		{[]string{"a::", "b:time", "c:list", "d|e:split", "f...:list:;"}, nil},
+	}
+	for _, test := range tests {
+		if _, err := Compile(test.specs); !errors.Is(err, test.err) {
+			t.Fatalf("%v: expected %v, got %v", test.specs, test.err, err)
+		}
+	}
+	if _, err := Preset("unknown"); !errors.Is(err, ErrUnknownPreset) {
+		t.Fatalf("unknown preset is found, err %v", err)
+	}
+}
+
+func mustTime(layout string, value string) time.Time {
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+const (
+	accessTime = "02/Jan/2006:15:04:05 -0700"
+	edgeLine   = `1.2.3.4 example.com "text/html" [10/Oct/2022:13:55:36 +0800] "GET /a?b=1 HTTP/1.1" 200 512 "-" "curl/7.68.0" 15 256 - "bytes=0-" "5.6.7.8, 9.9.9.9" a@b c 10.0.0.1 - HIT L1 x@_@y@_@z`
+)
+
+var edgeParsed = map[string]any{
+	"client_ip": "1.2.3.4", "domain": "example.com", "content_type": "text/html", "request_time": "10/Oct/2022:13:55:36 +0800",
+	"http_method": "GET", "url": "/a?b=1", "http_version": "HTTP/1.1", "http_code": int64(200), "bytes_sent": int64(512),
+	"refer": "-", "ua": "curl/7.68.0", "response_time": int64(15), "body_bytes_sent": int64(256),
+	"range": "bytes=0-", "x_forwarded_for": "5.6.7.8, 9.9.9.9", "complex_field0": []string{"a", "b"}, "complex_field1": []string{"c"},
+	"x_peer": "10.0.0.1", "unnamed": "-", "hit": "HIT", "hierarchy": "L1", "ext": []string{"x", "y", "z"},
+}
+
+func TestPresets(t *testing.T) {
+	origin := map[string]any{"host": "origin-1"}
+	for key, value := range edgeParsed {
+		origin[key] = value
+	}
+	tests := []struct {
+		preset   string
+		line     string
+		expected map[string]any
+		err      error
+	}{
+		{"nginx-combined", `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://x.com/" "Mozilla/5.0 (X11)"`,
+			map[string]any{"remote_addr": "127.0.0.1", "remote_user": "frank", "time_local": mustTime(accessTime, "10/Oct/2000:13:55:36 -0700"),
+				"method": "GET", "path": "/a.gif", "protocol": "HTTP/1.0", "status": int64(200), "body_bytes_sent": int64(2326),
+				"http_referer": "http://x.com/", "http_user_agent": "Mozilla/5.0 (X11)"}, nil},
+		//empty typed value is omitted
+		{"nginx-combined", `::1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 304 - "-" "-"`,
+			map[string]any{"remote_addr": "::1", "remote_user": "-", "time_local": mustTime(accessTime, "10/Oct/2000:13:55:36 -0700"),
+				"method": "GET", "path": "/", "protocol": "HTTP/1.1", "status": int64(304),
+				"http_referer": "-", "http_user_agent": "-"}, nil},
+		{"nginx-combined", `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200`, nil, ErrMissingField},
+		{"nginx-combined", `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://x.com/" "Mozilla`, nil, ErrUnclosedQuote},
+		{"apache-common", `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326`,
+			map[string]any{"host": "127.0.0.1", "ident": "-", "user": "frank", "time": mustTime(accessTime, "10/Oct/2000:13:55:36 -0700"),
+				"method": "GET", "path": "/a.gif", "protocol": "HTTP/1.0", "status": int64(200), "bytes": int64(2326)}, nil},
+		{"apache-common", `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700`, nil, ErrUnclosedBracket},
+		{"apache-common", `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" ok 1`, nil, strconv.ErrSyntax},
+		{"edge", edgeLine, edgeParsed, nil},
+		{"edge", edgeLine[:len(edgeLine)-len(" L1 x@_@y@_@z")], nil, ErrMissingField},
+		{"edge", `1.2.3.4 example.com "text/html" [10/Oct/2022:13:55:36 +0800] "GET / HTTP/1.1" x`, nil, strconv.ErrSyntax},
+		{"origin", "origin-1 " + edgeLine, origin, nil},
+		{"origin", "origin-1", nil, ErrMissingField},
+	}
+	for i, test := range tests {
+		layout, err := Preset(test.preset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := layout.Parse(test.line)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%d %s: expected %v, got %v", i, test.preset, test.err, err)
+		}
+		if test.expected != nil && !reflect.DeepEqual(parsed, test.expected) {
+			t.Fatalf("%d %s: expected %v, got %v", i, test.preset, test.expected, parsed)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package parse
+
+import (
+	"athena/athena"
+	"athena/lib/component"
+	"athena/lib/deadletter"
+	"athena/lib/log"
+	"athena/lib/metrics"
+	"athena/lib/properties"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+var (
+	PresetProperty = properties.NewProperty[string]("preset", "layout preset, nginx-combined apache-common origin or edge, layout is used if empty", "")
+	LayoutProperty = properties.NewProperty[[]string]("layout",
+		"field specs name[:type[:arg]], type is string int float time(arg layout) list(arg separator) or split(arg separator, name a|b|c), name - is skipped, name... takes the rest", []string{})
+	FieldProperty = properties.NewProperty[string]("field", "message key of the line, parsed fields are merged into message, the whole message is the line and replaced if empty", "")
+
+	ErrNotString = deadletter.ErrNotString
+	ErrNotMap    = fmt.Errorf("message is not map")
+)
+
+type operator struct {
+	ctx        athena.Context
+	logger     athena.Logger
+	metrics    *metrics.Metrics
+	acker      athena.ACKer
+	emitNext   athena.EmitNext
+	layout     *Layout
+	field      string
+	deadLetter *deadletter.Writer
+}
+
+func (o *operator) Open(ctx athena.Context) (err error) {
+	o.ctx = ctx
+	o.logger = log.Ctx(o.ctx)
+	o.metrics = metrics.Ctx(o.ctx)
+	o.acker = athena.NewACKer(ctx)
+	if preset := ctx.Properties().GetString(PresetProperty); preset != "" {
+		o.layout, err = Preset(preset)
+	} else {
+		o.layout, err = Compile(ctx.Properties().GetStringSlice(LayoutProperty))
+	}
+	if err != nil {
+		return errors.WithMessage(err, "invalid layout")
+	}
+	o.field = ctx.Properties().GetString(FieldProperty)
+	o.deadLetter, err = deadletter.New(ctx)
+	return err
+}
+
+func (o *operator) Close() error {
+	o.acker.Close()
+	return o.deadLetter.Close()
+}
+
+func (o *operator) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{PresetProperty, LayoutProperty, FieldProperty, deadletter.PathProperty}
+}
+
+func (o *operator) Collect(emitNext athena.EmitNext) error {
+	o.emitNext = emitNext
+	<-o.ctx.Done()
+	return nil
+}
+
+func (o *operator) GenerateEmit(_ athena.Context) athena.Emit {
+	return o.emit
+}
+
+func (o *operator) emit(event *athena.Event) {
+	message, err := o.parse(event)
+	if err != nil {
+		o.fail(event, err)
+		return
+	}
+	o.emitNext(&athena.Event{Meta: event.Meta, Message: message, Time: event.Time, Private: event.Private}, nil)
+}
+
+func (o *operator) parse(event *athena.Event) (any, error) {
+	if o.field == "" {
+		line, err := deadletter.Line(event.Message)
+		if err != nil {
+			return nil, err
+		}
+		return o.layout.Parse(line)
+	}
+	message, ok := event.Message.(map[string]any)
+	if !ok {
+		return nil, ErrNotMap
+	}
+	line, err := deadletter.Line(message[o.field])
+	if err != nil {
+		return nil, errors.WithMessage(err, o.field)
+	}
+	parsed, err := o.layout.Parse(line)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]any, len(message)+len(parsed))
+	for key, value := range message {
+		merged[key] = value
+	}
+	for key, value := range parsed {
+		merged[key] = value
+	}
+	return merged, nil
+}
+
+//fail drop the event to dead letter
+func (o *operator) fail(event *athena.Event, cause error) {
+	o.metrics.Drop.Inc()
+	o.logger.Debugw("can't parse event.", "err", cause)
+	o.deadLetter.Fail(o.acker, event, cause)
+}
+
+func New() athena.Operator {
+	return &operator{}
+}
+
+func init() {
+	component.RegisterNewOperatorFunc("parse", New)
+}
@@ -3,6 +3,7 @@ package sample
 import (
 	"athena/athena"
 	"athena/lib/component"
+	"athena/lib/metrics"
 	"athena/lib/properties"
 	"sync/atomic"
 )
@@ -12,7 +13,8 @@ var (
 )
 
 type operator struct {
-	ctx athena.Context
+	ctx     athena.Context
+	metrics *metrics.Metrics
 
 	rate     uint64
 	ops      uint64
@@ -21,6 +23,7 @@ type operator struct {
 
 func (o *operator) Open(ctx athena.Context) error {
 	o.ctx = ctx
+	o.metrics = metrics.Ctx(ctx)
 	o.rate = ctx.Properties().GetUint64(RateProperty)
 
 	return nil
@@ -45,6 +48,8 @@ func (o *operator) GenerateEmit(_ athena.Context) athena.Emit {
 		if atomic.AddUint64(&o.ops, 1) == o.rate {
 			atomic.AddUint64(&o.ops, -o.rate)
 			o.emitNext(event, nil)
+		} else {
+			o.metrics.Drop.Inc()
 		}
 
 	}
@@ -43,7 +43,7 @@ type aggregateOperator struct {
 func (a *aggregateOperator) Open(ctx athena.Context) error {
 	a.ctx = ctx
 	a.logger = log.Ctx(a.ctx)
-	a.acker = athena.NewACKer()
+	a.acker = athena.NewACKer(ctx)
 	//init intermediate state
 	a.mPool = map[string]*tengo.Map{}
 	a.ackHandlers = make([]athena.ACKHandler, 0)
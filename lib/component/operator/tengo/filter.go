@@ -26,7 +26,7 @@ type filterOperator struct {
 func (f *filterOperator) Open(ctx athena.Context) error {
 	f.ctx = ctx
 	f.logger = log.Ctx(f.ctx)
-	f.acker = athena.NewACKer()
+	f.acker = athena.NewACKer(ctx)
 	conditionStr := f.ctx.Properties().GetString(ConditionProperty)
 	script := tengo.NewScript([]byte(fmt.Sprintf("__res__ := (%s)", strings.TrimSpace(conditionStr))))
 	if err := script.Add("event", emptyEvent); err != nil {
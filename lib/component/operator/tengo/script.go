@@ -24,7 +24,7 @@ type scriptOperator struct {
 func (o *scriptOperator) Open(ctx athena.Context) error {
 	o.ctx = ctx
 	o.logger = log.Ctx(o.ctx)
-	o.acker = athena.NewACKer()
+	o.acker = athena.NewACKer(ctx)
 	scriptStr := o.ctx.Properties().GetString(ScriptProperty)
 	script := tengo.NewScript([]byte(scriptStr))
 	script.SetImports(stdlib.GetModuleMap(stdlib.AllModuleNames()...))
@@ -25,6 +25,7 @@ type filter struct {
 func (o *filter) Open(ctx athena.Context) error {
 	o.ctx = ctx
 	o.logger = log.Ctx(o.ctx)
+	o.acker = athena.NewACKer(ctx)
 	o.properties = ctx.Properties()
 	o.properties.GetString(FilterProperty)
 	return nil
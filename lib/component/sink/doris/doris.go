@@ -8,10 +8,10 @@ import (
 )
 
 var (
-	FrontendsProperty = properties.NewProperty("frontends", "doris stream load frontends", []string{})
-	UserProperty      = properties.NewProperty("user", "doris db user", nil)
-	PasswordProperty  = properties.NewProperty("password", "doris db password", nil)
-	BatchProperty     = properties.NewProperty("batch", "doris stream load batch", 10000000)
+	FrontendsProperty = properties.NewProperty[[]string]("frontends", "doris stream load frontends", []string{})
+	UserProperty      = properties.NewProperty[string]("user", "doris db user", "")
+	PasswordProperty  = properties.NewProperty[string]("password", "doris db password", "")
+	BatchProperty     = properties.NewProperty[int]("batch", "doris stream load batch", 10000000)
 )
 
 type sink struct {
@@ -1,6 +1,7 @@
 package doris
 
 import (
+	"athena/pkg/httpclient"
 	"errors"
 	"fmt"
 	"io"
@@ -104,8 +105,6 @@ func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return t.RoundTripper.RoundTrip(req)
 }
 
-var defaultTrans = http.DefaultTransport.(*http.Transport)
-
 func (rq *request) getHttpClient() *http.Client {
 	i, ok := pool.Load(rq.config)
 	if ok {
@@ -113,19 +112,13 @@ func (rq *request) getHttpClient() *http.Client {
 	}
 	mtx.Lock()
 	defer mtx.Unlock()
-	trans := defaultTrans.Clone()
-	trans.DisableKeepAlives = true
-	c := &http.Client{
-		Transport: &transport{RoundTripper: trans, Reqs: new(sync.Map)},
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 10 {
-				return errors.New("stopped after 10 redirects")
-			}
-			req.SetBasicAuth(rq.config.User, rq.config.Password)
-			return nil
-		},
-		Timeout: rq.config.Timeout,
+	options := httpclient.Options{
+		Timeout:           rq.config.Timeout,
+		DisableKeepAlives: true,
+		User:              rq.config.User,
+		Password:          rq.config.Password,
 	}
+	c := httpclient.New(options, &transport{RoundTripper: httpclient.Transport(options), Reqs: new(sync.Map)})
 	pool.Store(rq.config, c)
 	return c
 }
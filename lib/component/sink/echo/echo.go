@@ -2,26 +2,55 @@ package echo
 
 import (
 	"athena/athena"
+	"athena/lib/codec"
 	"athena/lib/component"
 	"athena/lib/log"
+	"athena/lib/metrics"
 	"athena/lib/properties"
 	"athena/pkg/queue"
+	"bytes"
 	"sync"
 )
 
 var (
 	BatchSizeProperty = properties.NewProperty[int]("batch", "echo sink echo batch size", 100)
 	TypeProperty      = properties.NewProperty[string]("echo", "echo type, like info debug", "info")
+	CodecProperty     = codec.Property("")
+	PayloadProperty   = codec.PayloadProperty(codec.PayloadEvent)
 )
 
 type sink struct {
 	ctx       athena.Context
 	logger    athena.Logger
+	metrics   *metrics.Metrics
 	acker     athena.ACKer
 	batch     int
 	buffer    *queue.Queue
 	bufferMux sync.Mutex
 	echoFunc  func(format string, args ...interface{})
+	//codec is nil if event is echoed by %+v
+	codec   athena.Codec
+	payload string
+}
+
+func (s *sink) echo(event *athena.Event) {
+	if s.codec == nil {
+		s.echoFunc("%+v", event)
+		return
+	}
+	buffer := &bytes.Buffer{}
+	encoder, err := s.codec.NewEncoder(s.ctx.Properties(), buffer)
+	if err == nil {
+		if err = encoder.Encode(codec.Value(event, s.payload)); err == nil {
+			err = encoder.Flush()
+		}
+	}
+	if err != nil {
+		s.logger.Warnw("can't encode event, echo it by %+v.", "err", err)
+		s.echoFunc("%+v", event)
+		return
+	}
+	s.echoFunc("%s", bytes.TrimRight(buffer.Bytes(), "\n"))
 }
 
 func (s *sink) GenerateEmit(_ athena.Context) athena.Emit {
@@ -32,18 +61,30 @@ func (s *sink) GenerateEmit(_ athena.Context) athena.Emit {
 		if s.buffer.Length() >= s.batch {
 			for i := 0; i < s.batch; i++ {
 				_event := s.buffer.Remove().(*athena.Event)
-				s.echoFunc("%+v", _event)
+				s.echo(_event)
 				s.acker.OnACK(_event, true)
 			}
 		}
+		s.metrics.BufferDepth.Set(float64(s.buffer.Length()))
 	}
 }
 
 func (s *sink) Open(ctx athena.Context) error {
 	s.ctx = ctx
 	s.logger = log.Ctx(s.ctx)
-	s.acker = athena.NewACKer()
+	s.metrics = metrics.Ctx(s.ctx)
+	s.acker = athena.NewACKer(ctx)
 	s.batch = ctx.Properties().GetInt(BatchSizeProperty)
+	if name := ctx.Properties().GetString(CodecProperty); name != "" {
+		var err error
+		if s.codec, err = codec.Load(ctx.Properties(), name); err != nil {
+			return err
+		}
+		s.payload = ctx.Properties().GetString(PayloadProperty)
+		if err = codec.CheckPayload(s.payload); err != nil {
+			return err
+		}
+	}
 	echoType := ctx.Properties().GetString(TypeProperty)
 	if s.buffer == nil {
 		s.buffer = queue.New()
@@ -61,16 +102,24 @@ func (s *sink) Open(ctx athena.Context) error {
 		s.logger.Warnf("unknown echo type %s, use info", echoType)
 		s.echoFunc = s.logger.Infof
 	}
-	<-s.ctx.Done()
 	return nil
 }
 
+//Close flush events below batch size
 func (s *sink) Close() error {
+	s.bufferMux.Lock()
+	defer s.bufferMux.Unlock()
+	for s.buffer.Length() > 0 {
+		_event := s.buffer.Remove().(*athena.Event)
+		s.echo(_event)
+		s.acker.OnACK(_event, true)
+	}
+	s.metrics.BufferDepth.Set(0)
 	return nil
 }
 
 func (s *sink) PropertiesDef() athena.PropertiesDef {
-	return athena.PropertiesDef{BatchSizeProperty, TypeProperty}
+	return athena.PropertiesDef{BatchSizeProperty, TypeProperty, PayloadProperty, CodecProperty}
 }
 
 //New uses for test only
@@ -0,0 +1,249 @@
+package file
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"athena/lib/component"
+	"athena/lib/log"
+	"athena/lib/metrics"
+	"athena/lib/properties"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	PathProperty         = properties.NewRequiredProperty[string]("path", "file path template, like /data/{{.Time.Format \"20060102\"}}/{{.Meta.host}}.log")
+	CodecProperty        = codec.Property("lines")
+	PayloadProperty      = codec.PayloadProperty(codec.PayloadMessage)
+	CompressionProperty  = properties.NewProperty[string]("compression", "file compression, none gzip or zstd", CompressionNone)
+	RollSizeProperty     = properties.NewProperty[int]("roll-size", "roll file when bytes exceed, 0 is disabled", 128<<20)
+	RollIntervalProperty = properties.NewProperty[time.Duration]("roll-interval", "roll file when opened longer than, 0 is disabled", time.Hour)
+	RollCountProperty    = properties.NewProperty[int]("roll-count", "roll file when events exceed, 0 is disabled", 0)
+	SyncIntervalProperty = properties.NewProperty[time.Duration]("sync-interval", "fsync interval, events are acked after fsync", time.Second)
+	MaxFailuresProperty  = properties.NewProperty[int]("max-failures", "fail the sink after consecutive file failures, so it is restarted by restart policy, 0 is disabled", 3)
+)
+
+type sink struct {
+	*athena.Failures
+	ctx          athena.Context
+	logger       athena.Logger
+	metrics      *metrics.Metrics
+	acker        athena.ACKer
+	path         *template.Template
+	codec        athena.Codec
+	payload      string
+	compression  string
+	extension    string
+	rollSize     int64
+	rollInterval time.Duration
+	rollCount    int
+
+	parts    map[string]*part
+	mutex    sync.Mutex
+	sequence int64
+	done     chan struct{}
+	wait     sync.WaitGroup
+}
+
+func (s *sink) GenerateEmit(_ athena.Context) athena.Emit {
+	return func(event *athena.Event) {
+		buffer := &bytes.Buffer{}
+		if err := s.path.Execute(buffer, event); err != nil {
+			s.logger.Errorw("can't render file path.", "err", err)
+			s.acker.OnACK(event, false)
+			return
+		}
+		path := buffer.String()
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		p, ok := s.parts[path]
+		if !ok {
+			var err error
+			if p, err = openPart(s.partName(path), s.compression, s.newEncoder); err != nil {
+				s.logger.Errorw("can't open file.", "path", path, "err", err)
+				s.acker.OnACK(event, false)
+				s.Fail(err)
+				return
+			}
+			s.parts[path] = p
+		}
+		if err := p.write(event, codec.Value(event, s.payload)); err != nil {
+			s.logger.Errorw("can't write file.", "file", p.name, "err", err)
+			//the failed event is not pending in the part
+			s.abort(path, p)
+			s.acker.OnACK(event, false)
+			s.updateBufferDepth()
+			s.Fail(err)
+			return
+		}
+		s.Succeed()
+		if s.shouldRoll(p) {
+			s.commit(path, p)
+		}
+		s.updateBufferDepth()
+	}
+}
+
+func (s *sink) newEncoder(w io.Writer) (athena.Encoder, error) {
+	return s.codec.NewEncoder(s.ctx.Properties(), w)
+}
+
+//partName return the final name of a new file of path, like path.20060102150405-1.gz
+func (s *sink) partName(path string) string {
+	s.sequence++
+	return path + "." + time.Now().Format(partTimeLayout) + "-" + strconv.FormatInt(s.sequence, 10) + s.extension
+}
+
+func (s *sink) shouldRoll(p *part) bool {
+	return (s.rollSize > 0 && p.size() >= s.rollSize) ||
+		(s.rollCount > 0 && p.count >= s.rollCount) ||
+		(s.rollInterval > 0 && time.Since(p.opened) >= s.rollInterval)
+}
+
+func (s *sink) commit(path string, p *part) {
+	delete(s.parts, path)
+	events, err := p.commit()
+	if err != nil {
+		s.logger.Errorw("can't commit file.", "file", p.name, "err", err)
+		s.nack(p.abort())
+		s.Fail(err)
+		return
+	}
+	s.logger.Debugw("file committed.", "file", p.name, "count", p.count)
+	s.ack(events)
+}
+
+func (s *sink) abort(path string, p *part) {
+	delete(s.parts, path)
+	s.logger.Warnw("file aborted, in progress file is kept.", "file", p.file.Name())
+	s.nack(p.abort())
+}
+
+func (s *sink) ack(events []*athena.Event) {
+	for _, event := range events {
+		s.acker.OnACK(event, true)
+	}
+}
+
+func (s *sink) nack(events []*athena.Event) {
+	for _, event := range events {
+		s.acker.OnACK(event, false)
+	}
+}
+
+func (s *sink) updateBufferDepth() {
+	depth := 0
+	for _, p := range s.parts {
+		depth += len(p.pending)
+	}
+	s.metrics.BufferDepth.Set(float64(depth))
+}
+
+//sync fsync pending events and roll expired files
+func (s *sink) sync() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for path, p := range s.parts {
+		if s.shouldRoll(p) {
+			s.commit(path, p)
+			continue
+		}
+		if len(p.pending) == 0 {
+			continue
+		}
+		events, err := p.sync()
+		if err != nil {
+			s.logger.Errorw("can't sync file.", "file", p.name, "err", err)
+			s.abort(path, p)
+			s.Fail(err)
+			continue
+		}
+		s.Succeed()
+		s.ack(events)
+	}
+	s.updateBufferDepth()
+}
+
+func (s *sink) Open(ctx athena.Context) (err error) {
+	s.ctx = ctx
+	s.logger = log.Ctx(s.ctx)
+	s.metrics = metrics.Ctx(s.ctx)
+	s.acker = athena.NewACKer(ctx)
+	if s.path, err = template.New(ctx.Name()).Parse(ctx.Properties().GetString(PathProperty)); err != nil {
+		return err
+	}
+	if s.codec, err = codec.New(ctx.Properties(), CodecProperty); err != nil {
+		return err
+	}
+	s.payload = ctx.Properties().GetString(PayloadProperty)
+	if err = codec.CheckPayload(s.payload); err != nil {
+		return err
+	}
+	//fail fast on invalid codec properties
+	if _, err = s.codec.NewEncoder(ctx.Properties(), io.Discard); err != nil {
+		return err
+	}
+	s.compression = ctx.Properties().GetString(CompressionProperty)
+	if s.extension, err = extension(s.compression); err != nil {
+		return err
+	}
+	s.rollSize = int64(ctx.Properties().GetInt(RollSizeProperty))
+	s.rollInterval = ctx.Properties().GetDuration(RollIntervalProperty)
+	s.rollCount = ctx.Properties().GetInt(RollCountProperty)
+	syncInterval := ctx.Properties().GetDuration(SyncIntervalProperty)
+	if syncInterval <= 0 {
+		return fmt.Errorf("sync-interval must be positive")
+	}
+	s.Failures = athena.NewFailures(ctx.Properties().GetInt(MaxFailuresProperty))
+	s.parts = map[string]*part{}
+	s.done = make(chan struct{})
+	s.wait.Add(1)
+	go func() {
+		defer s.wait.Done()
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				s.sync()
+			}
+		}
+	}()
+	return nil
+}
+
+//Close commit all in progress files
+func (s *sink) Close() error {
+	if s.done != nil {
+		close(s.done)
+		s.wait.Wait()
+		s.done = nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for path, p := range s.parts {
+		s.commit(path, p)
+	}
+	s.updateBufferDepth()
+	return nil
+}
+
+func (s *sink) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{PathProperty, PayloadProperty, CompressionProperty,
+		RollSizeProperty, RollIntervalProperty, RollCountProperty, SyncIntervalProperty, MaxFailuresProperty, CodecProperty}
+}
+
+func New() athena.Sink {
+	return &sink{}
+}
+
+func init() {
+	component.RegisterNewSinkFunc("file", New)
+}
@@ -0,0 +1,192 @@
+package file
+
+import (
+	"athena/athena"
+	_ "athena/lib/codec/json"
+	"athena/lib/context"
+	"athena/lib/log"
+	"athena/lib/properties"
+	_c "context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+//acks count the ack handler calls and the nacks, ack handler is called for nacked events too
+type acks struct {
+	acked  int
+	nacked int
+}
+
+func (a *acks) event(message any) *athena.Event {
+	return &athena.Event{Meta: map[string]any{"name": "a"}, Message: message, Private: map[string]any{
+		athena.PrivateACKHandler:  athena.ACKHandler(func() { a.acked++ }),
+		athena.PrivateNACKHandler: athena.ACKHandler(func() { a.nacked++ }),
+	}}
+}
+
+//newSink open the file sink writing ndjson to dir, config is appended to the sink section
+func newSink(t *testing.T, config string) (*sink, string) {
+	log.Setup(log.DefaultOptions())
+	dir := t.TempDir()
+	file := filepath.Join(dir, "athena.toml")
+	config = "[sink.file]\npath = '" + filepath.Join(dir, "out", "{{.Meta.name}}.log") + "'\ncodec = \"ndjson\"\n" +
+		"sync-interval = \"1h\"\n" + config
+	if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := properties.New(file, properties.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.New(_c.Background(), p).Named("sink.file")
+	s := New().(*sink)
+	if _, err = properties.InitAndRender(ctx.Properties(), s.PropertiesDef()); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return s, filepath.Join(dir, "out")
+}
+
+//files return the names and contents of files in dir
+func files(t *testing.T, dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[entry.Name()] = string(data)
+	}
+	return contents
+}
+
+//names return the sorted names of files with suffix
+func names(contents map[string]string, suffix string) []string {
+	var matched []string
+	for name := range contents {
+		if strings.HasSuffix(name, suffix) {
+			matched = append(matched, name)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+func TestAckAfterSync(t *testing.T) {
+	s, dir := newSink(t, "")
+	a := &acks{}
+	emit := s.GenerateEmit(nil)
+	emit(a.event(1))
+	emit(a.event(2))
+	if a.acked != 0 {
+		t.Fatalf("events are acked before fsync, acked %d", a.acked)
+	}
+	s.sync()
+	if a.acked != 2 || a.nacked != 0 {
+		t.Fatalf("synced events are not acked, acked %d nacked %d", a.acked, a.nacked)
+	}
+	//the file is in progress until committed
+	contents := files(t, dir)
+	if inProgress := names(contents, inProgressSuffix); len(inProgress) != 1 || len(contents) != 1 ||
+		contents[inProgress[0]] != "1\n2\n" {
+		t.Fatalf("expect one in progress file, got %v", contents)
+	}
+	emit(a.event(3))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if a.acked != 3 {
+		t.Fatalf("committed events are not acked, acked %d", a.acked)
+	}
+	contents = files(t, dir)
+	//the final name is path.time-sequence
+	committed := names(contents, "-1")
+	if len(contents) != 1 || len(committed) != 1 || !strings.HasPrefix(committed[0], "a.log.") ||
+		contents[committed[0]] != "1\n2\n3\n" {
+		t.Fatalf("expect one committed file, got %v", contents)
+	}
+}
+
+func TestRoll(t *testing.T) {
+	s, dir := newSink(t, "roll-count = 2\ncompression = \"gzip\"")
+	a := &acks{}
+	emit := s.GenerateEmit(nil)
+	for i := 0; i < 5; i++ {
+		emit(a.event(i))
+	}
+	//two files are rolled and committed atomically, the last one is in progress
+	contents := files(t, dir)
+	if committed := names(contents, ".gz"); len(committed) != 2 || len(names(contents, ".gz"+inProgressSuffix)) != 1 {
+		t.Fatalf("expect two committed files and one in progress, got %v", names(contents, ""))
+	}
+	if a.acked != 4 || a.nacked != 0 {
+		t.Fatalf("events of rolled files are not acked, acked %d nacked %d", a.acked, a.nacked)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	contents = files(t, dir)
+	if len(names(contents, ".gz")) != 3 || len(names(contents, inProgressSuffix)) != 0 || a.acked != 5 {
+		t.Fatalf("in progress file is not committed on close, files %v acked %d", names(contents, ""), a.acked)
+	}
+}
+
+func TestAbortOnWriteError(t *testing.T) {
+	s, dir := newSink(t, "")
+	a := &acks{}
+	emit := s.GenerateEmit(nil)
+	emit(a.event(1))
+	//channels can't be encoded to json
+	emit(a.event(make(chan int)))
+	if a.acked != 2 || a.nacked != 2 {
+		t.Fatalf("pending and failed events are not nacked, acked %d nacked %d", a.acked, a.nacked)
+	}
+	if depth := len(s.parts); depth != 0 {
+		t.Fatalf("aborted file is not removed, %d parts", depth)
+	}
+	//the aborted file is kept, and a new file is opened
+	emit(a.event(2))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	contents := files(t, dir)
+	if len(names(contents, inProgressSuffix)) != 1 || len(contents) != 2 || a.acked != 3 || a.nacked != 2 {
+		t.Fatalf("expect aborted and committed files, got %v acked %d nacked %d", names(contents, ""), a.acked, a.nacked)
+	}
+}
+
+func TestFailed(t *testing.T) {
+	s, _ := newSink(t, "max-failures = 2")
+	a := &acks{}
+	emit := s.GenerateEmit(nil)
+	emit(a.event(make(chan int)))
+	emit(a.event(1))
+	//successful writes reset the consecutive failures
+	emit(a.event(make(chan int)))
+	select {
+	case err := <-s.Failed():
+		t.Fatalf("sink fails before consecutive failures reach max, %v", err)
+	default:
+	}
+	emit(a.event(make(chan int)))
+	select {
+	case err := <-s.Failed():
+		if err == nil {
+			t.Fatal("failure has no error")
+		}
+	default:
+		t.Fatal("sink doesn't fail after consecutive failures")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,167 @@
+package file
+
+import (
+	"athena/athena"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+
+	inProgressSuffix = ".inprogress"
+	partTimeLayout   = "20060102150405"
+)
+
+var ErrUnknownCompression = fmt.Errorf("unknown file compression")
+
+//compressor is the flushable compress writer, like gzip and zstd
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func extension(compression string) (string, error) {
+	switch compression {
+	case CompressionNone, "":
+		return "", nil
+	case CompressionGzip:
+		return ".gz", nil
+	case CompressionZstd:
+		return ".zst", nil
+	default:
+		return "", errors.WithMessage(ErrUnknownCompression, compression)
+	}
+}
+
+//countWriter count bytes written to the file
+type countWriter struct {
+	w    io.Writer
+	size int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.size += int64(n)
+	return n, err
+}
+
+//part is the in progress file of one path, it is renamed to the final name on commit
+type part struct {
+	name       string
+	file       *os.File
+	counter    *countWriter
+	buffer     *bufio.Writer
+	compressor compressor
+	encoder    athena.Encoder
+	opened     time.Time
+	count      int
+	//pending events are acked after fsync
+	pending []*athena.Event
+}
+
+func openPart(name string, compression string, newEncoder func(w io.Writer) (athena.Encoder, error)) (*part, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(name+inProgressSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	p := &part{name: name, file: file, opened: time.Now()}
+	p.counter = &countWriter{w: file}
+	p.buffer = bufio.NewWriter(p.counter)
+	var w io.Writer = p.buffer
+	switch compression {
+	case CompressionGzip:
+		p.compressor = gzip.NewWriter(p.buffer)
+		w = p.compressor
+	case CompressionZstd:
+		if p.compressor, err = zstd.NewWriter(p.buffer); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		w = p.compressor
+	}
+	if p.encoder, err = newEncoder(w); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *part) write(event *athena.Event, value any) error {
+	if err := p.encoder.Encode(value); err != nil {
+		return err
+	}
+	p.count++
+	p.pending = append(p.pending, event)
+	return nil
+}
+
+//size is the bytes flushed to file, compressed data may be buffered in compressor
+func (p *part) size() int64 {
+	return p.counter.size + int64(p.buffer.Buffered())
+}
+
+//sync flush all buffered data to disk and return the events persisted
+func (p *part) sync() ([]*athena.Event, error) {
+	if p.compressor != nil {
+		if err := p.compressor.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.buffer.Flush(); err != nil {
+		return nil, err
+	}
+	if err := p.file.Sync(); err != nil {
+		return nil, err
+	}
+	pending := p.pending
+	p.pending = nil
+	return pending, nil
+}
+
+//commit finish the file and rename it to the final name
+func (p *part) commit() ([]*athena.Event, error) {
+	if err := p.encoder.Flush(); err != nil {
+		return nil, err
+	}
+	if p.compressor != nil {
+		if err := p.compressor.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.buffer.Flush(); err != nil {
+		return nil, err
+	}
+	if err := p.file.Sync(); err != nil {
+		return nil, err
+	}
+	if err := p.file.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(p.file.Name(), p.name); err != nil {
+		return nil, err
+	}
+	pending := p.pending
+	p.pending = nil
+	return pending, nil
+}
+
+//abort close the in progress file and keep it, as synced events in it may be acked, return the events not persisted
+func (p *part) abort() []*athena.Event {
+	_ = p.file.Close()
+	pending := p.pending
+	p.pending = nil
+	return pending
+}
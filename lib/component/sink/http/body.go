@@ -0,0 +1,137 @@
+package http
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"bytes"
+	"fmt"
+	"github.com/d5/tengo/v2"
+	"github.com/d5/tengo/v2/stdlib"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"io"
+)
+
+const (
+	BodyCodec = "codec"
+	BodyTengo = "tengo"
+
+	eventsVariable = "events"
+	bodyVariable   = "body"
+)
+
+var (
+	ErrUnknownBody   = fmt.Errorf("unknown http body")
+	ErrScriptNoBody  = fmt.Errorf("body script doesn't set body")
+	ErrScriptIsEmpty = fmt.Errorf("body script is empty")
+	ErrEncodeBody    = fmt.Errorf("can't encode request body")
+)
+
+//bodyEncoder encode a batch of events to request body
+type bodyEncoder interface {
+	Encode(events []*athena.Event) ([]byte, error)
+	ContentType() string
+}
+
+//codecBody encode the payload of events by codec
+type codecBody struct {
+	codec   athena.Codec
+	ps      athena.Properties
+	payload string
+}
+
+func (b *codecBody) Encode(events []*athena.Event) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder, err := b.codec.NewEncoder(b.ps, buffer)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		if err = encoder.Encode(codec.Value(event, b.payload)); err != nil {
+			return nil, err
+		}
+	}
+	if err = encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (b *codecBody) ContentType() string {
+	return b.codec.ContentType()
+}
+
+//tengoBody run the script with events, the script set body as string or bytes
+type tengoBody struct {
+	compiled *tengo.Compiled
+}
+
+func (b *tengoBody) Encode(events []*athena.Event) ([]byte, error) {
+	values := make([]any, 0, len(events))
+	for _, event := range events {
+		values = append(values, map[string]any{
+			"meta":    event.Meta,
+			"message": event.Message,
+			"time":    event.Time,
+		})
+	}
+	//compiled is not thread safe, bodies are encoded concurrently
+	compiled := b.compiled.Clone()
+	if err := compiled.Set(eventsVariable, values); err != nil {
+		return nil, err
+	}
+	if err := compiled.Run(); err != nil {
+		return nil, err
+	}
+	body := compiled.Get(bodyVariable)
+	switch value := body.Value().(type) {
+	case nil:
+		return nil, ErrScriptNoBody
+	case []byte:
+		return value, nil
+	default:
+		return []byte(cast.ToString(value)), nil
+	}
+}
+
+func (b *tengoBody) ContentType() string {
+	return "text/plain"
+}
+
+func newBodyEncoder(ps athena.Properties, body string, script string) (bodyEncoder, error) {
+	switch body {
+	case BodyCodec:
+		c, err := codec.New(ps, CodecProperty)
+		if err != nil {
+			return nil, err
+		}
+		payload := ps.GetString(PayloadProperty)
+		if err = codec.CheckPayload(payload); err != nil {
+			return nil, err
+		}
+		//fail fast on invalid codec properties
+		if _, err = c.NewEncoder(ps, io.Discard); err != nil {
+			return nil, err
+		}
+		return &codecBody{codec: c, ps: ps, payload: payload}, nil
+	case BodyTengo:
+		if script == "" {
+			return nil, ErrScriptIsEmpty
+		}
+		s := tengo.NewScript([]byte(script))
+		s.SetImports(stdlib.GetModuleMap(stdlib.AllModuleNames()...))
+		if err := s.Add(eventsVariable, []any{}); err != nil {
+			return nil, err
+		}
+		if err := s.Add(bodyVariable, nil); err != nil {
+			return nil, err
+		}
+		compiled, err := s.Compile()
+		if err != nil {
+			return nil, errors.WithMessage(err, "can't compile body script")
+		}
+		return &tengoBody{compiled: compiled}, nil
+	default:
+		return nil, errors.WithMessage(ErrUnknownBody, body)
+	}
+}
@@ -0,0 +1,324 @@
+package http
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"athena/lib/component"
+	"athena/lib/log"
+	"athena/lib/metrics"
+	"athena/lib/properties"
+	"athena/pkg/httpclient"
+	"bytes"
+	_c "context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"net/http"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	URLProperty              = properties.NewRequiredProperty[string]("url", "request url template, like http://host/{{.Meta.index}}/_bulk")
+	MethodProperty           = properties.NewProperty[string]("method", "request method", http.MethodPost)
+	HeadersProperty          = properties.NewProperty[map[string]any]("headers", "request headers", map[string]any{})
+	BodyProperty             = properties.NewProperty[string]("body", "request body, codec or tengo", BodyCodec)
+	CodecProperty            = codec.Property("json")
+	PayloadProperty          = codec.PayloadProperty(codec.PayloadEvent)
+	ScriptProperty           = properties.NewProperty[string]("script", "tengo body script, events is the batch, set body as string or bytes", "")
+	BatchCountProperty       = properties.NewProperty[int]("batch-count", "send batch when events reach, 0 is disabled", 500)
+	BatchBytesProperty       = properties.NewProperty[int]("batch-bytes", "send batch when approximate message bytes reach, 0 is disabled", 1<<20)
+	BatchIntervalProperty    = properties.NewProperty[time.Duration]("batch-interval", "send batch when it is older than", time.Second)
+	TimeoutProperty          = properties.NewProperty[time.Duration]("timeout", "request timeout", 30*time.Second)
+	ConcurrencyProperty      = properties.NewProperty[int]("concurrency", "max in flight requests", 4)
+	RetryMaxProperty         = properties.NewProperty[int]("retry-max", "max retries of a batch, nack after retries exhausted", 3)
+	RetryBackoffProperty     = properties.NewProperty[time.Duration]("retry-backoff", "initial retry backoff, doubled on every retry", time.Second)
+	RetryMaxBackoffProperty  = properties.NewProperty[time.Duration]("retry-max-backoff", "max retry backoff", 30*time.Second)
+	RetryStatusCodesProperty = properties.NewProperty[[]int]("retry-status-codes", "retriable status codes, transport errors are always retried",
+		[]int{http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout})
+	FlushTimeoutProperty = properties.NewProperty[time.Duration]("flush-timeout", "max duration of sending the last batches on close, requests and retries are canceled after it", 30*time.Second)
+	MaxFailuresProperty  = properties.NewProperty[int]("max-failures", "fail the sink after consecutive batches failed with retriable errors, so it is restarted by restart policy, 0 is disabled", 3)
+)
+
+//batch is the events to send to one url
+type batch struct {
+	url     string
+	events  []*athena.Event
+	bytes   int
+	created time.Time
+}
+
+type sink struct {
+	*athena.Failures
+	ctx         athena.Context
+	logger      athena.Logger
+	metrics     *metrics.Metrics
+	acker       athena.ACKer
+	client      *http.Client
+	url         *template.Template
+	method      string
+	headers     map[string]string
+	body        bodyEncoder
+	batchCount  int
+	batchBytes  int
+	interval    time.Duration
+	timeout     time.Duration
+	retryMax    int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	retryStatus map[int]bool
+	flush       time.Duration
+
+	//sendCtx is canceled by Close after flush timeout, not by sink ctx, so in flight batches are sent on shutdown
+	sendCtx  _c.Context
+	cancel   _c.CancelFunc
+	batches  map[string]*batch
+	mutex    sync.Mutex
+	inflight chan struct{}
+	done     chan struct{}
+	ticker   sync.WaitGroup
+	sending  sync.WaitGroup
+}
+
+func (s *sink) GenerateEmit(_ athena.Context) athena.Emit {
+	return func(event *athena.Event) {
+		buffer := &bytes.Buffer{}
+		if err := s.url.Execute(buffer, event); err != nil {
+			s.logger.Errorw("can't render request url.", "err", err)
+			s.acker.OnACK(event, false)
+			return
+		}
+		url := buffer.String()
+		s.mutex.Lock()
+		b, ok := s.batches[url]
+		if !ok {
+			b = &batch{url: url, created: time.Now()}
+			s.batches[url] = b
+		}
+		b.events = append(b.events, event)
+		b.bytes += size(event)
+		full := (s.batchCount > 0 && len(b.events) >= s.batchCount) || (s.batchBytes > 0 && b.bytes >= s.batchBytes)
+		if full {
+			delete(s.batches, url)
+		}
+		s.updateBufferDepth()
+		s.mutex.Unlock()
+		if full {
+			s.send(b)
+		}
+	}
+}
+
+//size is the approximate bytes of event message
+func size(event *athena.Event) int {
+	switch message := event.Message.(type) {
+	case []byte:
+		return len(message)
+	case string:
+		return len(message)
+	default:
+		data, _ := json.Marshal(message)
+		return len(data)
+	}
+}
+
+func (s *sink) updateBufferDepth() {
+	depth := 0
+	for _, b := range s.batches {
+		depth += len(b.events)
+	}
+	s.metrics.BufferDepth.Set(float64(depth))
+}
+
+//send the batch asynchronously, block if in flight requests reach concurrency
+func (s *sink) send(b *batch) {
+	s.inflight <- struct{}{}
+	s.sending.Add(1)
+	go func() {
+		defer func() {
+			<-s.inflight
+			s.sending.Done()
+		}()
+		err := s.request(s.sendCtx, b)
+		switch {
+		case err == nil:
+			s.Succeed()
+		//the server is unavailable after retries, errors of the batch itself and canceled requests on close are not counted
+		case s.retriable(err) && s.sendCtx.Err() == nil:
+			s.Fail(err)
+		}
+		for _, event := range b.events {
+			s.acker.OnACK(event, err == nil)
+		}
+	}()
+}
+
+//request send the batch with retries, return nil if response is 2xx
+func (s *sink) request(ctx _c.Context, b *batch) error {
+	body, err := s.body.Encode(b.events)
+	if err != nil {
+		s.logger.Errorw("can't encode request body.", "url", b.url, "err", err)
+		return errors.WithMessage(ErrEncodeBody, err.Error())
+	}
+	backoff := s.backoff
+	for retries := 0; ; retries++ {
+		err = s.do(ctx, b.url, body)
+		if err == nil {
+			return nil
+		}
+		if !s.retriable(err) || retries >= s.retryMax {
+			s.logger.Errorw("request failed.", "url", b.url, "events", len(b.events), "retries", retries, "err", err)
+			return err
+		}
+		s.logger.Warnw("request failed, retry later.", "url", b.url, "backoff", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			s.logger.Errorw("request canceled.", "url", b.url, "events", len(b.events), "retries", retries, "err", err)
+			return err
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+func (s *sink) do(ctx _c.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, s.method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.body.ContentType())
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+	_, err = httpclient.Do(s.client, req)
+	return err
+}
+
+func (s *sink) retriable(err error) bool {
+	if errors.Is(err, ErrEncodeBody) {
+		return false
+	}
+	if statusErr, ok := err.(*httpclient.StatusError); ok {
+		return s.retryStatus[statusErr.StatusCode]
+	}
+	return true
+}
+
+//flushExpired send batches older than interval
+func (s *sink) flushExpired() {
+	var expired []*batch
+	s.mutex.Lock()
+	for url, b := range s.batches {
+		if time.Since(b.created) >= s.interval {
+			delete(s.batches, url)
+			expired = append(expired, b)
+		}
+	}
+	s.updateBufferDepth()
+	s.mutex.Unlock()
+	for _, b := range expired {
+		s.send(b)
+	}
+}
+
+func (s *sink) Open(ctx athena.Context) (err error) {
+	s.ctx = ctx
+	s.logger = log.Ctx(s.ctx)
+	s.metrics = metrics.Ctx(s.ctx)
+	s.acker = athena.NewACKer(ctx)
+	if s.url, err = template.New(ctx.Name()).Parse(ctx.Properties().GetString(URLProperty)); err != nil {
+		return err
+	}
+	if s.body, err = newBodyEncoder(ctx.Properties(), ctx.Properties().GetString(BodyProperty), ctx.Properties().GetString(ScriptProperty)); err != nil {
+		return err
+	}
+	s.method = ctx.Properties().GetString(MethodProperty)
+	s.headers = map[string]string{}
+	for key, value := range ctx.Properties().GetStringMap(HeadersProperty) {
+		s.headers[key] = cast.ToString(value)
+	}
+	s.batchCount = ctx.Properties().GetInt(BatchCountProperty)
+	s.batchBytes = ctx.Properties().GetInt(BatchBytesProperty)
+	s.interval = ctx.Properties().GetDuration(BatchIntervalProperty)
+	s.retryMax = ctx.Properties().GetInt(RetryMaxProperty)
+	s.backoff = ctx.Properties().GetDuration(RetryBackoffProperty)
+	s.maxBackoff = ctx.Properties().GetDuration(RetryMaxBackoffProperty)
+	s.retryStatus = map[int]bool{}
+	for _, code := range ctx.Properties().GetStringSlice(RetryStatusCodesProperty) {
+		statusCode, err := strconv.Atoi(code)
+		if err != nil {
+			return err
+		}
+		s.retryStatus[statusCode] = true
+	}
+	concurrency := ctx.Properties().GetInt(ConcurrencyProperty)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	s.timeout = ctx.Properties().GetDuration(TimeoutProperty)
+	s.flush = ctx.Properties().GetDuration(FlushTimeoutProperty)
+	s.Failures = athena.NewFailures(ctx.Properties().GetInt(MaxFailuresProperty))
+	s.sendCtx, s.cancel = _c.WithCancel(_c.Background())
+	s.client = httpclient.New(httpclient.Options{Timeout: s.timeout, MaxConnsPerHost: concurrency}, nil)
+	s.inflight = make(chan struct{}, concurrency)
+	s.batches = map[string]*batch{}
+	s.done = make(chan struct{})
+	if s.interval > 0 {
+		s.ticker.Add(1)
+		go func() {
+			defer s.ticker.Done()
+			ticker := time.NewTicker(s.interval / 2)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-s.done:
+					return
+				case <-ticker.C:
+					s.flushExpired()
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+//Close send all batches and wait for in flight requests, requests and retries are canceled after flush timeout
+func (s *sink) Close() error {
+	if s.done != nil {
+		close(s.done)
+		s.ticker.Wait()
+		s.done = nil
+	}
+	s.mutex.Lock()
+	batches := s.batches
+	s.batches = map[string]*batch{}
+	s.updateBufferDepth()
+	s.mutex.Unlock()
+	timer := time.AfterFunc(s.flush, s.cancel)
+	defer timer.Stop()
+	for _, b := range batches {
+		s.send(b)
+	}
+	s.sending.Wait()
+	s.cancel()
+	return nil
+}
+
+func (s *sink) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{URLProperty, MethodProperty, HeadersProperty, BodyProperty, ScriptProperty, PayloadProperty,
+		BatchCountProperty, BatchBytesProperty, BatchIntervalProperty, TimeoutProperty, ConcurrencyProperty,
+		RetryMaxProperty, RetryBackoffProperty, RetryMaxBackoffProperty, RetryStatusCodesProperty, FlushTimeoutProperty, MaxFailuresProperty, CodecProperty}
+}
+
+func New() athena.Sink {
+	return &sink{}
+}
+
+func init() {
+	component.RegisterNewSinkFunc("http", New)
+}
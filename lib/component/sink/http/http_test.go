@@ -0,0 +1,292 @@
+package http
+
+import (
+	"athena/athena"
+	_ "athena/lib/codec/json"
+	"athena/lib/context"
+	"athena/lib/log"
+	"athena/lib/properties"
+	_c "context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//server record the request bodies, respond the status codes in turn, the last one is repeated
+type server struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	bodies   map[string][]string
+	statuses map[string][]int
+	delay    time.Duration
+}
+
+func newServer(t *testing.T, statuses map[string][]int) *server {
+	s := &server{bodies: map[string][]string{}, statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mutex.Lock()
+		s.bodies[r.URL.Path] = append(s.bodies[r.URL.Path], string(body))
+		status := http.StatusOK
+		if codes := s.statuses[r.URL.Path]; len(codes) > 0 {
+			status = codes[0]
+			if len(codes) > 1 {
+				s.statuses[r.URL.Path] = codes[1:]
+			}
+		}
+		delay := s.delay
+		s.mutex.Unlock()
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *server) setDelay(delay time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.delay = delay
+}
+
+func (s *server) requests(path string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.bodies[path]...)
+}
+
+//acks count the acked and nacked events of paths, ack handlers are called in sending goroutines
+type acks struct {
+	mutex  sync.Mutex
+	acked  map[string]int
+	nacked map[string]int
+	done   int32
+}
+
+func newAcks() *acks {
+	return &acks{acked: map[string]int{}, nacked: map[string]int{}}
+}
+
+func (a *acks) event(path string, message any) *athena.Event {
+	nacked := int32(0)
+	return &athena.Event{Meta: map[string]any{"path": path}, Message: message, Private: map[string]any{
+		athena.PrivateNACKHandler: athena.ACKHandler(func() { atomic.StoreInt32(&nacked, 1) }),
+		athena.PrivateACKHandler: athena.ACKHandler(func() {
+			a.mutex.Lock()
+			defer a.mutex.Unlock()
+			if atomic.LoadInt32(&nacked) == 1 {
+				a.nacked[path]++
+			} else {
+				a.acked[path]++
+			}
+			atomic.AddInt32(&a.done, 1)
+		}),
+	}}
+}
+
+func (a *acks) get(path string) (int, int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.acked[path], a.nacked[path]
+}
+
+//wait until n events are acked or nacked
+func (a *acks) wait(t *testing.T, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&a.done) < int32(n) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d events done, got %d", n, atomic.LoadInt32(&a.done))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+//newSink open the http sink sending ndjson messages to url/{{.Meta.path}}, config is appended to the sink section
+func newSink(t *testing.T, url string, config string) (*sink, athena.Context) {
+	log.Setup(log.DefaultOptions())
+	file := filepath.Join(t.TempDir(), "athena.toml")
+	config = "[sink.http]\nurl = '" + url + "/{{.Meta.path}}'\ncodec = \"ndjson\"\npayload = \"message\"\n" +
+		"batch-interval = \"0s\"\nretry-backoff = \"1ms\"\n" + config
+	if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := properties.New(file, properties.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.New(_c.Background(), p).Named("sink.http")
+	s := New().(*sink)
+	if _, err = properties.InitAndRender(ctx.Properties(), s.PropertiesDef()); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return s, ctx
+}
+
+func TestBatch(t *testing.T) {
+	server := newServer(t, nil)
+	s, _ := newSink(t, server.URL, "batch-count = 2")
+	a := newAcks()
+	emit := s.GenerateEmit(nil)
+	for i := 0; i < 5; i++ {
+		emit(a.event("a", i))
+	}
+	emit(a.event("b", 5))
+	a.wait(t, 4)
+	//batches are sent concurrently, in any order
+	requests := server.requests("/a")
+	sort.Strings(requests)
+	if len(requests) != 2 || requests[0] != "0\n1\n" || requests[1] != "2\n3\n" {
+		t.Fatalf("expect two full batches, got %q", requests)
+	}
+	//the last batches are sent on close
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if requests := server.requests("/a"); len(requests) != 3 || requests[2] != "4\n" {
+		t.Fatalf("last batch is not sent on close, got %q", requests)
+	}
+	if requests := server.requests("/b"); len(requests) != 1 || requests[0] != "5\n" {
+		t.Fatalf("batches are not separated by url, got %q", requests)
+	}
+	if acked, nacked := a.get("a"); acked != 5 || nacked != 0 {
+		t.Fatalf("expect 5 acked, got acked %d nacked %d", acked, nacked)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	server := newServer(t, map[string][]int{
+		"/unavailable": {http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+		"/teapot":      {http.StatusTeapot, http.StatusOK},
+		"/bad":         {http.StatusBadRequest, http.StatusOK},
+		"/down":        {http.StatusServiceUnavailable},
+	})
+	s, _ := newSink(t, server.URL, "batch-count = 1\nretry-max = 2\nretry-status-codes = [503, 418]")
+	a := newAcks()
+	emit := s.GenerateEmit(nil)
+	for _, path := range []string{"unavailable", "teapot", "bad", "down"} {
+		emit(a.event(path, path))
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path     string
+		requests int
+		acked    bool
+	}{
+		{path: "unavailable", requests: 3, acked: true},
+		//configured codes are retried
+		{path: "teapot", requests: 2, acked: true},
+		//other codes are not retried
+		{path: "bad", requests: 1, acked: false},
+		//nacked after retries exhausted
+		{path: "down", requests: 3, acked: false},
+	}
+	for _, test := range tests {
+		if requests := server.requests("/" + test.path); len(requests) != test.requests {
+			t.Fatalf("%s: expect %d requests, got %d", test.path, test.requests, len(requests))
+		}
+		if acked, nacked := a.get(test.path); (acked == 1) != test.acked || acked+nacked != 1 {
+			t.Fatalf("%s: expect acked %v, got acked %d nacked %d", test.path, test.acked, acked, nacked)
+		}
+	}
+}
+
+func TestAckPerBatch(t *testing.T) {
+	server := newServer(t, map[string][]int{"/fail": {http.StatusBadRequest}})
+	s, _ := newSink(t, server.URL, "batch-count = 3")
+	a := newAcks()
+	emit := s.GenerateEmit(nil)
+	for i := 0; i < 3; i++ {
+		emit(a.event("ok", i))
+		emit(a.event("fail", i))
+	}
+	a.wait(t, 6)
+	if acked, nacked := a.get("ok"); acked != 3 || nacked != 0 {
+		t.Fatalf("batch of 2xx is not acked, acked %d nacked %d", acked, nacked)
+	}
+	if acked, nacked := a.get("fail"); acked != 0 || nacked != 3 {
+		t.Fatalf("batch of 4xx is not nacked, acked %d nacked %d", acked, nacked)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//drain cancels the sink ctx before Close, in flight batches are still sent
+func TestCloseAfterCancel(t *testing.T) {
+	server := newServer(t, nil)
+	server.setDelay(100 * time.Millisecond)
+	s, ctx := newSink(t, server.URL, "batch-count = 1")
+	a := newAcks()
+	emit := s.GenerateEmit(nil)
+	emit(a.event("a", 1))
+	ctx.Cancel()
+	emit(a.event("a", 2))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if acked, nacked := a.get("a"); acked != 2 || nacked != 0 {
+		t.Fatalf("in flight batches are canceled, acked %d nacked %d", acked, nacked)
+	}
+
+	//requests are canceled after flush timeout
+	server.setDelay(time.Hour)
+	s, _ = newSink(t, server.URL, "batch-count = 1\nflush-timeout = \"50ms\"")
+	a = newAcks()
+	s.GenerateEmit(nil)(a.event("a", 1))
+	start := time.Now()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("close is not bounded by flush timeout, %v", elapsed)
+	}
+	if acked, nacked := a.get("a"); acked != 0 || nacked != 1 {
+		t.Fatalf("canceled batch is not nacked, acked %d nacked %d", acked, nacked)
+	}
+}
+
+func TestFailed(t *testing.T) {
+	server := newServer(t, map[string][]int{"/bad": {http.StatusBadRequest}, "/down": {http.StatusServiceUnavailable}})
+	s, _ := newSink(t, server.URL, "batch-count = 1\nretry-max = 0\nmax-failures = 2")
+	a := newAcks()
+	emit := s.GenerateEmit(nil)
+	//errors of the batch itself don't fail the sink
+	for i := 0; i < 3; i++ {
+		emit(a.event("bad", i))
+	}
+	a.wait(t, 3)
+	emit(a.event("down", 0))
+	a.wait(t, 4)
+	select {
+	case err := <-s.Failed():
+		t.Fatalf("sink fails before consecutive failures reach max, %v", err)
+	default:
+	}
+	emit(a.event("down", 1))
+	select {
+	case err := <-s.Failed():
+		if err == nil {
+			t.Fatal("failure has no error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sink doesn't fail after consecutive failures")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
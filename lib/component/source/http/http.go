@@ -0,0 +1,265 @@
+package http
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"athena/lib/component"
+	"athena/lib/log"
+	"athena/lib/properties"
+	_c "context"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//CodecAuto choose codec by content type, lines if unknown
+	CodecAuto = "auto"
+
+	MetaHeaders = "headers"
+	MetaRemote  = "remote"
+	MetaPath    = "path"
+)
+
+var (
+	AddressProperty     = properties.NewProperty[string]("address", "listen address", ":8080")
+	PathProperty        = properties.NewProperty[string]("path", "ingest path", "/")
+	CodecProperty       = codec.Property(CodecAuto)
+	MaxBodySizeProperty = properties.NewProperty[int]("max-body-size", "max request body bytes", 10<<20)
+	ACKTimeoutProperty  = properties.NewProperty[time.Duration]("ack-timeout", "max wait for events acked, respond 503 after timeout", 30*time.Second)
+	UserProperty        = properties.NewProperty[string]("user", "basic auth user, auth is disabled if user and token are empty", "")
+	PasswordProperty    = properties.NewProperty[string]("password", "basic auth password", "")
+	TokenProperty       = properties.NewProperty[string]("token", "bearer auth token", "")
+	TLSCertProperty     = properties.NewProperty[string]("tls-cert", "tls cert file, tls is enabled if cert and key are set", "")
+	TLSKeyProperty      = properties.NewProperty[string]("tls-key", "tls key file", "")
+
+	//autoCodecs is the codec of content type in auto mode
+	autoCodecs = map[string]string{
+		"application/json":          "json",
+		"application/x-ndjson":      "ndjson",
+		"application/ndjson":        "ndjson",
+		"application/jsonlines":     "ndjson",
+		"text/csv":                  "csv",
+		"text/tab-separated-values": "tsv",
+		"application/msgpack":       "msgpack",
+		"application/x-msgpack":     "msgpack",
+	}
+	defaultAutoCodec = "lines"
+)
+
+type source struct {
+	ctx      athena.Context
+	logger   athena.Logger
+	emitNext athena.EmitNext
+	server   *http.Server
+	path     string
+	//decoders is keyed by codec name
+	decoders    map[string]athena.Decoder
+	codec       string
+	maxBodySize int64
+	ackTimeout  time.Duration
+	user        string
+	password    string
+	token       string
+	tlsCert     string
+	tlsKey      string
+}
+
+func (s *source) Open(ctx athena.Context) error {
+	s.ctx = ctx
+	s.logger = log.Ctx(s.ctx)
+	s.path = ctx.Properties().GetString(PathProperty)
+	s.codec = ctx.Properties().GetString(CodecProperty)
+	names := []string{s.codec}
+	if s.codec == CodecAuto {
+		names = []string{defaultAutoCodec}
+		for _, name := range autoCodecs {
+			names = append(names, name)
+		}
+	}
+	s.decoders = map[string]athena.Decoder{}
+	for _, name := range names {
+		if _, ok := s.decoders[name]; ok {
+			continue
+		}
+		c, err := codec.Load(ctx.Properties(), name)
+		if err != nil {
+			return err
+		}
+		if s.decoders[name], err = c.NewDecoder(ctx.Properties()); err != nil {
+			return errors.WithMessagef(err, "can't create %s decoder", name)
+		}
+	}
+	s.maxBodySize = int64(ctx.Properties().GetInt(MaxBodySizeProperty))
+	s.ackTimeout = ctx.Properties().GetDuration(ACKTimeoutProperty)
+	s.user = ctx.Properties().GetString(UserProperty)
+	s.password = ctx.Properties().GetString(PasswordProperty)
+	s.token = ctx.Properties().GetString(TokenProperty)
+	s.tlsCert = ctx.Properties().GetString(TLSCertProperty)
+	s.tlsKey = ctx.Properties().GetString(TLSKeyProperty)
+	mux := http.NewServeMux()
+	mux.HandleFunc(s.path, s.handle)
+	s.server = &http.Server{Addr: ctx.Properties().GetString(AddressProperty), Handler: mux}
+	return nil
+}
+
+func (s *source) Close() error {
+	return nil
+}
+
+func (s *source) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{AddressProperty, PathProperty, MaxBodySizeProperty, ACKTimeoutProperty,
+		UserProperty, PasswordProperty, TokenProperty, TLSCertProperty, TLSKeyProperty, CodecProperty}
+}
+
+func (s *source) Collect(emitNext athena.EmitNext) error {
+	s.emitNext = emitNext
+	served := make(chan error, 1)
+	go func() {
+		if s.tlsCert != "" && s.tlsKey != "" {
+			served <- s.server.ListenAndServeTLS(s.tlsCert, s.tlsKey)
+		} else {
+			served <- s.server.ListenAndServe()
+		}
+	}()
+	s.logger.Infof("listen on %s%s", s.server.Addr, s.path)
+	select {
+	case err := <-served:
+		return err
+	case <-s.ctx.Done():
+	}
+	//wait requests in flight for their acks
+	ctx, cancel := _c.WithTimeout(_c.Background(), s.ackTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+func (s *source) authorized(r *http.Request) bool {
+	if s.user == "" && s.token == "" {
+		return true
+	}
+	if s.user != "" {
+		if user, password, ok := r.BasicAuth(); ok &&
+			subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1 {
+			return true
+		}
+	}
+	if s.token != "" {
+		if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *source) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		if s.user != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="athena"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	messages, err := s.decode(r, http.MaxBytesReader(w, r.Body, s.maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	meta := s.meta(r)
+
+	var (
+		pending = int64(len(messages))
+		nacked  int32
+		acked   = make(chan struct{})
+		once    sync.Once
+	)
+	if pending == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	handler := athena.ACKHandler(func() {
+		if atomic.AddInt64(&pending, -1) == 0 {
+			once.Do(func() { close(acked) })
+		}
+	})
+	nackHandler := athena.ACKHandler(func() {
+		atomic.StoreInt32(&nacked, 1)
+	})
+	for _, message := range messages {
+		_meta := make(map[string]any, len(meta))
+		for key, value := range meta {
+			_meta[key] = value
+		}
+		s.emitNext(&athena.Event{
+			Meta:    _meta,
+			Message: message,
+			Time:    time.Now(),
+			Private: map[string]any{athena.PrivateNACKHandler: nackHandler},
+		}, handler)
+	}
+	timer := time.NewTimer(s.ackTimeout)
+	defer timer.Stop()
+	select {
+	case <-acked:
+		if atomic.LoadInt32(&nacked) == 1 {
+			http.Error(w, "events nacked", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]int{"events": len(messages)})
+	case <-timer.C:
+		http.Error(w, "ack timeout", http.StatusServiceUnavailable)
+	}
+}
+
+func (s *source) meta(r *http.Request) map[string]any {
+	headers := make(map[string]any, len(r.Header))
+	for key, values := range r.Header {
+		if key == "Authorization" {
+			continue
+		}
+		headers[key] = strings.Join(values, ",")
+	}
+	return map[string]any{
+		MetaHeaders: headers,
+		MetaRemote:  r.RemoteAddr,
+		MetaPath:    r.URL.Path,
+	}
+}
+
+//decode the body to messages by codec, codec is chosen by content type in auto mode
+func (s *source) decode(r *http.Request, body io.Reader) ([]any, error) {
+	name := s.codec
+	if name == CodecAuto {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if name = autoCodecs[mediaType]; name == "" {
+			name = defaultAutoCodec
+		}
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return s.decoders[name].Decode(data)
+}
+
+func New() athena.Source {
+	return &source{}
+}
+
+func init() {
+	component.RegisterNewSourceFunc("http", New)
+}
@@ -0,0 +1,266 @@
+package kafka
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"athena/pkg/schemaregistry"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/linkedin/goavro/v2"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+const (
+	DecoderRaw      = "raw"
+	DecoderJSON     = "json"
+	DecoderAvro     = "avro"
+	DecoderProtobuf = "protobuf"
+
+	//rootProto is the file name of the registered schema in protobuf parser
+	rootProto = "athena_root.proto"
+)
+
+var (
+	ErrUnknownDecoder  = fmt.Errorf("unknown decoder")
+	ErrSchemaRegistry  = fmt.Errorf("schema registry url is required")
+	ErrMessageIndexes  = fmt.Errorf("invalid protobuf message indexes")
+	ErrNotObject       = fmt.Errorf("decoded value is not an object")
+	ErrUnexpectedType  = fmt.Errorf("unexpected schema type")
+	ErrMessageCount    = fmt.Errorf("codec should decode one message")
+	protobufMarshaller = &jsonpb.Marshaler{OrigName: true}
+)
+
+//decoder decode kafka message value into event message
+type decoder interface {
+	Decode(data []byte) (any, error)
+}
+
+//newDecoder return nil for raw decoder, name can also be a codec
+func newDecoder(ps athena.Properties, name string, registry *schemaregistry.Client) (decoder, error) {
+	switch name {
+	case DecoderRaw:
+		return nil, nil
+	case DecoderJSON:
+		return &jsonDecoder{registry: registry}, nil
+	case DecoderAvro:
+		if registry == nil {
+			return nil, ErrSchemaRegistry
+		}
+		return &avroDecoder{registry: registry, codecs: map[int]*goavro.Codec{}}, nil
+	case DecoderProtobuf:
+		if registry == nil {
+			return nil, ErrSchemaRegistry
+		}
+		return &protobufDecoder{registry: registry, files: map[int]*desc.FileDescriptor{}}, nil
+	}
+	if codec.NewCodecFunc(name) != nil {
+		c, err := codec.Load(ps, name)
+		if err != nil {
+			return nil, err
+		}
+		d, err := c.NewDecoder(ps)
+		if err != nil {
+			return nil, err
+		}
+		return &codecDecoder{d}, nil
+	}
+	return nil, errors.WithMessage(ErrUnknownDecoder, name)
+}
+
+//codecDecoder decode value by codec, the value should be decoded to exactly one message
+type codecDecoder struct {
+	athena.Decoder
+}
+
+func (d *codecDecoder) Decode(data []byte) (any, error) {
+	messages, err := d.Decoder.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) != 1 {
+		return nil, errors.WithMessagef(ErrMessageCount, "%d messages", len(messages))
+	}
+	return messages[0], nil
+}
+
+//jsonDecoder decode json value, the wire format header is stripped if registry is set
+type jsonDecoder struct {
+	registry *schemaregistry.Client
+}
+
+func (d *jsonDecoder) Decode(data []byte) (any, error) {
+	if d.registry != nil {
+		if _, payload, err := schemaregistry.ParseWireFormat(data); err == nil {
+			data = payload
+		}
+	}
+	var message map[string]any
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+//avroDecoder decode avro value of confluent wire format, schema references are not supported
+type avroDecoder struct {
+	registry *schemaregistry.Client
+	mutex    sync.Mutex
+	codecs   map[int]*goavro.Codec
+}
+
+func (d *avroDecoder) codec(id int) (*goavro.Codec, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if codec, ok := d.codecs[id]; ok {
+		return codec, nil
+	}
+	schema, err := d.registry.Schema(id)
+	if err != nil {
+		return nil, err
+	}
+	if schema.Type != "" && schema.Type != schemaregistry.TypeAvro {
+		return nil, errors.WithMessage(ErrUnexpectedType, schema.Type)
+	}
+	codec, err := goavro.NewCodec(schema.Schema)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "can't parse avro schema %d", id)
+	}
+	d.codecs[id] = codec
+	return codec, nil
+}
+
+func (d *avroDecoder) Decode(data []byte) (any, error) {
+	id, payload, err := schemaregistry.ParseWireFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := d.codec(id)
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := codec.NativeFromBinary(payload)
+	if err != nil {
+		return nil, err
+	}
+	message, ok := native.(map[string]any)
+	if !ok {
+		return nil, ErrNotObject
+	}
+	return message, nil
+}
+
+//protobufDecoder decode protobuf value of confluent wire format, message is located by the message indexes
+type protobufDecoder struct {
+	registry *schemaregistry.Client
+	mutex    sync.Mutex
+	files    map[int]*desc.FileDescriptor
+}
+
+func (d *protobufDecoder) file(id int) (*desc.FileDescriptor, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if file, ok := d.files[id]; ok {
+		return file, nil
+	}
+	schema, err := d.registry.Schema(id)
+	if err != nil {
+		return nil, err
+	}
+	if schema.Type != schemaregistry.TypeProtobuf {
+		return nil, errors.WithMessage(ErrUnexpectedType, schema.Type)
+	}
+	contents := map[string]string{rootProto: schema.Schema}
+	if err = d.references(schema.References, contents); err != nil {
+		return nil, err
+	}
+	parser := protoparse.Parser{Accessor: protoparse.FileContentsFromMap(contents)}
+	files, err := parser.ParseFiles(rootProto)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "can't parse protobuf schema %d", id)
+	}
+	d.files[id] = files[0]
+	return files[0], nil
+}
+
+//references collect the imported schemas recursively
+func (d *protobufDecoder) references(references []schemaregistry.Reference, contents map[string]string) error {
+	for _, reference := range references {
+		if _, ok := contents[reference.Name]; ok {
+			continue
+		}
+		schema, err := d.registry.Reference(reference)
+		if err != nil {
+			return err
+		}
+		contents[reference.Name] = schema.Schema
+		if err = d.references(schema.References, contents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//messageIndexes read the zigzag varint encoded indexes, a single 0 is short for [0]
+func messageIndexes(data []byte) ([]int, []byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 {
+		return nil, nil, ErrMessageIndexes
+	}
+	data = data[n:]
+	if count == 0 {
+		return []int{0}, data, nil
+	}
+	indexes := make([]int, count)
+	for i := range indexes {
+		index, n := binary.Varint(data)
+		if n <= 0 || index < 0 {
+			return nil, nil, ErrMessageIndexes
+		}
+		indexes[i] = int(index)
+		data = data[n:]
+	}
+	return indexes, data, nil
+}
+
+func (d *protobufDecoder) Decode(data []byte) (any, error) {
+	id, payload, err := schemaregistry.ParseWireFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	file, err := d.file(id)
+	if err != nil {
+		return nil, err
+	}
+	indexes, payload, err := messageIndexes(payload)
+	if err != nil {
+		return nil, err
+	}
+	var message *desc.MessageDescriptor
+	types := file.GetMessageTypes()
+	for _, index := range indexes {
+		if index >= len(types) {
+			return nil, ErrMessageIndexes
+		}
+		message = types[index]
+		types = message.GetNestedMessageTypes()
+	}
+	dynamicMessage := dynamic.NewMessage(message)
+	if err = dynamicMessage.Unmarshal(payload); err != nil {
+		return nil, err
+	}
+	text, err := dynamicMessage.MarshalJSONPB(protobufMarshaller)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]any
+	if err = json.Unmarshal(text, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
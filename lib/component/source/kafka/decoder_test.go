@@ -0,0 +1,183 @@
+package kafka
+
+import (
+	"athena/pkg/httpclient"
+	"athena/pkg/schemaregistry"
+	"encoding/json"
+	"errors"
+	"github.com/linkedin/goavro/v2"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	avroSchema  = `{"type":"record","name":"r","fields":[{"name":"name","type":"string"},{"name":"n","type":"long"}]}`
+	protoSchema = `syntax = "proto3";
+message A {
+  string name = 1;
+  message B {
+    int32 n = 1;
+  }
+}
+message C {
+  int64 id = 1;
+}`
+	protoImports = `syntax = "proto3";
+import "common.proto";
+message D {
+  E e = 1;
+}`
+	protoCommon = `syntax = "proto3";
+message E {
+  string v = 1;
+}`
+)
+
+//newRegistry serve the schemas of paths, and count the requests
+func newRegistry(t *testing.T, schemas map[string]schemaregistry.Schema) (*schemaregistry.Client, *int32) {
+	requests := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		schema, ok := schemas[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(schema)
+	}))
+	t.Cleanup(server.Close)
+	return schemaregistry.New(server.URL, httpclient.Options{}, nil), requests
+}
+
+//wire prefix the confluent wire format header of schema id
+func wire(id byte, payload ...byte) []byte {
+	return append([]byte{0, 0, 0, 0, id}, payload...)
+}
+
+func TestMessageIndexes(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		indexes []int
+		rest    string
+		err     error
+	}{
+		//a single 0 is short for the first message
+		{data: []byte{0x00, 'x'}, indexes: []int{0}, rest: "x"},
+		//zigzag varints, count 1 and index 1
+		{data: []byte{0x02, 0x02, 'x'}, indexes: []int{1}, rest: "x"},
+		{data: []byte{0x04, 0x02, 0x00}, indexes: []int{1, 0}},
+		//multi bytes varint 150
+		{data: []byte{0x02, 0xac, 0x02}, indexes: []int{150}},
+		{data: []byte{}, err: ErrMessageIndexes},
+		//negative count and index
+		{data: []byte{0x01}, err: ErrMessageIndexes},
+		{data: []byte{0x02, 0x01}, err: ErrMessageIndexes},
+		//less indexes than count
+		{data: []byte{0x04, 0x02}, err: ErrMessageIndexes},
+	}
+	for _, test := range tests {
+		indexes, rest, err := messageIndexes(test.data)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("data %x, expect %v, got %v", test.data, test.err, err)
+		}
+		if test.err == nil && (!reflect.DeepEqual(indexes, test.indexes) || string(rest) != test.rest) {
+			t.Fatalf("data %x, expect %v %q, got %v %q", test.data, test.indexes, test.rest, indexes, rest)
+		}
+	}
+}
+
+func TestAvroDecoder(t *testing.T) {
+	registry, requests := newRegistry(t, map[string]schemaregistry.Schema{
+		"/schemas/ids/1": {Schema: avroSchema},
+		"/schemas/ids/2": {Schema: protoSchema, Type: schemaregistry.TypeProtobuf},
+		"/schemas/ids/3": {Schema: `"string"`},
+	})
+	codec, err := goavro.NewCodec(avroSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := codec.BinaryFromNative(nil, map[string]any{"name": "x", "n": int64(5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data    []byte
+		message any
+		err     error
+	}{
+		{data: wire(1, record...), message: map[string]any{"name": "x", "n": int64(5)}},
+		{data: record, err: schemaregistry.ErrWireFormat},
+		{data: wire(2, record...), err: ErrUnexpectedType},
+		{data: wire(3, 0x02, 'x'), err: ErrNotObject},
+	}
+	d, err := newDecoder(nil, DecoderAvro, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		message, err := d.Decode(test.data)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("data %x, expect %v, got %v", test.data, test.err, err)
+		}
+		if test.err == nil && !reflect.DeepEqual(message, test.message) {
+			t.Fatalf("data %x, expect %v, got %v", test.data, test.message, message)
+		}
+	}
+	//codecs are cached by schema id
+	count := atomic.LoadInt32(requests)
+	if _, err = d.Decode(wire(1, record...)); err != nil || atomic.LoadInt32(requests) != count {
+		t.Fatalf("schema is requested again, err %v", err)
+	}
+	if _, err = newDecoder(nil, DecoderAvro, nil); !errors.Is(err, ErrSchemaRegistry) {
+		t.Fatalf("expect %v, got %v", ErrSchemaRegistry, err)
+	}
+}
+
+func TestProtobufDecoder(t *testing.T) {
+	registry, _ := newRegistry(t, map[string]schemaregistry.Schema{
+		"/schemas/ids/1": {Schema: protoSchema, Type: schemaregistry.TypeProtobuf},
+		"/schemas/ids/2": {Schema: protoImports, Type: schemaregistry.TypeProtobuf,
+			References: []schemaregistry.Reference{{Name: "common.proto", Subject: "common", Version: 1}}},
+		"/subjects/common/versions/1": {Schema: protoCommon, Type: schemaregistry.TypeProtobuf},
+		"/schemas/ids/3":              {Schema: avroSchema},
+	})
+	tests := []struct {
+		data    []byte
+		message any
+		err     error
+	}{
+		//A{name: "x"}
+		{data: wire(1, 0x00, 0x0a, 0x01, 'x'), message: map[string]any{"name": "x"}},
+		//C{id: 5}, int64 is string in json
+		{data: wire(1, 0x02, 0x02, 0x08, 0x05), message: map[string]any{"id": "5"}},
+		//nested A.B{n: 3}
+		{data: wire(1, 0x04, 0x00, 0x00, 0x08, 0x03), message: map[string]any{"n": 3.0}},
+		//D{e: {v: "y"}} of referenced schema
+		{data: wire(2, 0x00, 0x0a, 0x03, 0x0a, 0x01, 'y'), message: map[string]any{"e": map[string]any{"v": "y"}}},
+		{data: wire(1, 0x02, 0x0a), err: ErrMessageIndexes},
+		{data: wire(1, 0x04, 0x00, 0x02), err: ErrMessageIndexes},
+		{data: wire(1), err: ErrMessageIndexes},
+		{data: []byte{1, 0, 0, 0, 1, 0}, err: schemaregistry.ErrWireFormat},
+		{data: wire(3, 0x00), err: ErrUnexpectedType},
+	}
+	d, err := newDecoder(nil, DecoderProtobuf, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		message, err := d.Decode(test.data)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("data %x, expect %v, got %v", test.data, test.err, err)
+		}
+		if test.err == nil && !reflect.DeepEqual(message, test.message) {
+			t.Fatalf("data %x, expect %v, got %v", test.data, test.message, message)
+		}
+	}
+	//a broken payload of valid header fails
+	if _, err = d.Decode(wire(1, 0x00, 0x0a, 0x05, 'x')); err == nil {
+		t.Fatal("truncated message is decoded")
+	}
+}
@@ -2,17 +2,31 @@ package kafka
 
 import (
 	"athena/athena"
+	"athena/lib/codec"
 	"athena/lib/component"
 	"athena/lib/log"
+	"athena/lib/metrics"
 	"athena/lib/properties"
+	"athena/pkg/httpclient"
+	"athena/pkg/schemaregistry"
+	_c "context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"github.com/Shopify/sarama"
 	"github.com/pkg/errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"unsafe"
 )
 
+const MetaDecodeError = codec.MetaDecodeError
+
 var (
-	TopicsProperty                = properties.NewRequiredProperty[[]string]("topics", "")
+	TopicsProperty                = properties.NewProperty[[]string]("topics", "required if assignments is empty", nil)
 	VersionProperty               = properties.NewProperty[string]("version", "", "2.4.0")
 	BrokersProperty               = properties.NewRequiredProperty[[]string]("brokers", "")
 	ClientIdProperty              = properties.NewProperty[string]("client.id", "client id", "")
@@ -20,64 +34,400 @@ var (
 	OffsetsCommitIntervalProperty = properties.NewProperty[int]("offsets.commit.interval", "kafka commit interval sec", 5)
 	OffsetsInitial                = properties.NewProperty[string]("offsets.initial", "newest or oldest", "oldest")
 
-	SASLUserProperty     = properties.NewProperty[string]("sasl-username", "", "")
-	SASLPasswordProperty = properties.NewProperty[string]("sasl-password", "", "")
+	AssignmentsProperty = properties.NewProperty[[]string]("assignments",
+		"manual partition assignments topic:partition[:offset[:end]], offset is number, oldest or newest, end is exclusive number or newest, consumer group is not used if set", nil)
+	StartTimestampProperty = properties.NewProperty[string]("start-timestamp",
+		"RFC3339 time, start from the first offset whose timestamp is not before it, only reset once per partition", "")
+	EndTimestampProperty = properties.NewProperty[string]("end-timestamp",
+		"RFC3339 time, stop partition at the first offset whose timestamp is not before it, source completes when all partitions stopped", "")
+	RebalanceTimeoutProperty = properties.NewProperty[time.Duration]("rebalance-timeout",
+		"max time waiting in flight events acked before partitions revoked", 10*time.Second)
+
+	SASLUserProperty      = properties.NewProperty[string]("sasl-username", "", "")
+	SASLPasswordProperty  = properties.NewProperty[string]("sasl-password", "", "")
+	SASLMechanismProperty = properties.NewProperty[string]("sasl-mechanism", "PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512", sarama.SASLTypePlaintext)
+
+	TLSEnableProperty     = properties.NewProperty[bool]("tls-enable", "", false)
+	TLSCAProperty         = properties.NewProperty[string]("tls-ca", "ca cert file to verify brokers, system roots if empty", "")
+	TLSCertProperty       = properties.NewProperty[string]("tls-cert", "client cert file", "")
+	TLSKeyProperty        = properties.NewProperty[string]("tls-key", "client key file", "")
+	TLSSkipVerifyProperty = properties.NewProperty[bool]("tls-skip-verify", "skip verify broker cert", false)
+
+	FetchMinBytesProperty     = properties.NewProperty[int]("fetch-min-bytes", "min bytes of one fetch request", 1)
+	FetchDefaultBytesProperty = properties.NewProperty[int]("fetch-default-bytes", "default bytes per partition of one fetch request", 1024*1024)
+	FetchMaxBytesProperty     = properties.NewProperty[int]("fetch-max-bytes", "max bytes per partition of one fetch request, 0 is unlimited", 0)
+	MaxWaitProperty           = properties.NewProperty[time.Duration]("max-wait", "max time broker waiting fetch-min-bytes", 250*time.Millisecond)
+	IsolationLevelProperty    = properties.NewProperty[string]("isolation-level", "read_uncommitted or read_committed", "read_uncommitted")
+	SessionTimeoutProperty    = properties.NewProperty[time.Duration]("session-timeout", "consumer group session timeout", 10*time.Second)
+	HeartbeatIntervalProperty = properties.NewProperty[time.Duration]("heartbeat-interval", "consumer group heartbeat interval", 3*time.Second)
+	RebalanceStrategyProperty = properties.NewProperty[string]("rebalance-strategy", "range, roundrobin or sticky", "range")
+
+	DecoderProperty = properties.NewProperty[string]("decoder",
+		"raw, json, avro, protobuf or a codec name, decoded value becomes the message with key and headers in meta, avro and protobuf are confluent wire format", DecoderRaw)
+	//CodecProperty is the alias of decoder like other sources, decoder is ignored if codec is set
+	CodecProperty                  = codec.Property("")
+	KeepRawProperty                = properties.NewProperty[bool]("keep-raw", "keep raw value bytes in raw meta if decoded", false)
+	SchemaRegistryUrlProperty      = properties.NewProperty[string]("schema-registry-url", "required by avro and protobuf decoder", "")
+	SchemaRegistryUserProperty     = properties.NewProperty[string]("schema-registry-username", "", "")
+	SchemaRegistryPasswordProperty = properties.NewProperty[string]("schema-registry-password", "", "")
+	SchemaRegistryTimeoutProperty  = properties.NewProperty[time.Duration]("schema-registry-timeout", "", 10*time.Second)
+
+	ErrInvalidAssignment = fmt.Errorf("invalid assignment")
+	ErrNoTopics          = fmt.Errorf("topics or assignments is required")
+	ErrUnknownOption     = fmt.Errorf("unknown option")
 )
 
+//assignment is a manually assigned partition, consume [offset, end)
+type assignment struct {
+	topic     string
+	partition int32
+	offset    int64
+	//end is -1 if unbounded
+	end int64
+}
+
 type source struct {
 	ctx           athena.Context
 	logger        athena.Logger
+	metrics       *metrics.Metrics
 	emitNext      athena.EmitNext
+	client        sarama.Client
 	consumerGroup sarama.ConsumerGroup
+	consumer      sarama.Consumer
+	assignments   []assignment
+
+	startTimestamp   time.Time
+	endTimestamp     time.Time
+	rebalanceTimeout time.Duration
+
+	//decoder is nil if value is not decoded
+	decoder decoder
+	keepRaw bool
+
+	//cancel stop consuming when all claimed partitions reach end timestamp
+	cancel  _c.CancelFunc
+	mutex   sync.Mutex
+	claimed int
+	ended   int
+	//reset is the partitions already reset by start timestamp
+	reset map[string]bool
+	//ends is the end offsets of partitions resolved by end timestamp
+	ends map[string]int64
+	//inflight is the emitted events not acked of current session
+	inflight *flight
+}
+
+//flight count the in flight events of a consumer group session
+type flight struct {
+	mutex   sync.Mutex
+	count   int
+	closing bool
+	//flushed is closed when the session is closing and all events are acked
+	flushed chan struct{}
+}
+
+func newFlight() *flight {
+	return &flight{flushed: make(chan struct{})}
+}
+
+func (f *flight) add() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.count++
+}
+
+func (f *flight) done() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.count--; f.closing && f.count == 0 {
+		close(f.flushed)
+	}
+}
+
+//close return the channel closed when in flight events are flushed, no event is added after close
+func (f *flight) close() <-chan struct{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.closing = true
+	if f.count == 0 {
+		close(f.flushed)
+	}
+	return f.flushed
 }
 
 func (s *source) Open(ctx athena.Context) error {
 	s.ctx = ctx
 	s.logger = log.Ctx(s.ctx)
-	//TODO all kafka consumer properties
+	s.metrics = metrics.Ctx(s.ctx)
+	s.reset = map[string]bool{}
+	s.ends = map[string]int64{}
+	s.rebalanceTimeout = s.ctx.Properties().GetDuration(RebalanceTimeoutProperty)
+	var err error
+	if s.startTimestamp, err = parseTimestamp(s.ctx.Properties().GetString(StartTimestampProperty)); err != nil {
+		return errors.WithMessage(err, "invalid start timestamp")
+	}
+	if s.endTimestamp, err = parseTimestamp(s.ctx.Properties().GetString(EndTimestampProperty)); err != nil {
+		return errors.WithMessage(err, "invalid end timestamp")
+	}
+	if err = s.initDecoder(); err != nil {
+		return err
+	}
+	config, err := s.config()
+	if err != nil {
+		return err
+	}
 
-	config := sarama.NewConfig()
-	version, err := sarama.ParseKafkaVersion(s.ctx.Properties().GetString(VersionProperty))
+	s.client, err = sarama.NewClient(s.ctx.Properties().GetStringSlice(BrokersProperty), config)
+	if err != nil {
+		return err
+	}
+	if specs := s.ctx.Properties().GetStringSlice(AssignmentsProperty); len(specs) > 0 {
+		if s.assignments, err = s.resolve(specs, config.Consumer.Offsets.Initial); err != nil {
+			_ = s.client.Close()
+			return err
+		}
+		s.consumer, err = sarama.NewConsumerFromClient(s.client)
+		if err != nil {
+			_ = s.client.Close()
+			return err
+		}
+		return nil
+	}
+	if len(s.ctx.Properties().GetStringSlice(TopicsProperty)) == 0 {
+		_ = s.client.Close()
+		return ErrNoTopics
+	}
+	s.consumerGroup, err = sarama.NewConsumerGroupFromClient(s.ctx.Properties().GetString(GroupIdProperty), s.client)
 	if err != nil {
+		_ = s.client.Close()
 		return err
 	}
+	go s.handleErrors()
+	return nil
+}
+
+func (s *source) initDecoder() error {
+	ps := s.ctx.Properties()
+	var registry *schemaregistry.Client
+	if registryUrl := ps.GetString(SchemaRegistryUrlProperty); registryUrl != "" {
+		registry = schemaregistry.New(registryUrl, httpclient.Options{
+			Timeout:  ps.GetDuration(SchemaRegistryTimeoutProperty),
+			User:     ps.GetString(SchemaRegistryUserProperty),
+			Password: ps.GetString(SchemaRegistryPasswordProperty),
+		}, nil)
+	}
+	var err error
+	name := ps.GetString(DecoderProperty)
+	if c := ps.GetString(CodecProperty); c != "" {
+		name = c
+	}
+	s.decoder, err = newDecoder(ps, name, registry)
+	s.keepRaw = ps.GetBool(KeepRawProperty)
+	return err
+}
+
+//config build the sarama config of properties
+func (s *source) config() (*sarama.Config, error) {
+	ps := s.ctx.Properties()
+	config := sarama.NewConfig()
+	version, err := sarama.ParseKafkaVersion(ps.GetString(VersionProperty))
+	if err != nil {
+		return nil, err
+	}
 	config.Version = version
 	//sasl
-	saslUser := s.ctx.Properties().GetString(SASLUserProperty)
-	saslPassword := s.ctx.Properties().GetString(SASLPasswordProperty)
+	saslUser := ps.GetString(SASLUserProperty)
+	saslPassword := ps.GetString(SASLPasswordProperty)
 	if saslUser != "" && saslPassword != "" {
 		config.Net.SASL.User = saslUser
 		config.Net.SASL.Password = saslPassword
 		config.Net.SASL.Enable = true
+		switch mechanism := ps.GetString(SASLMechanismProperty); mechanism {
+		case sarama.SASLTypePlaintext:
+		case sarama.SASLTypeSCRAMSHA256:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{HashGeneratorFcn: sha256Generator} }
+		case sarama.SASLTypeSCRAMSHA512:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{HashGeneratorFcn: sha512Generator} }
+		default:
+			return nil, errors.WithMessagef(ErrUnknownOption, "sasl mechanism %s", mechanism)
+		}
+	}
+	//tls
+	if ps.GetBool(TLSEnableProperty) {
+		config.Net.TLS.Enable = true
+		if config.Net.TLS.Config, err = tlsConfig(ps); err != nil {
+			return nil, errors.WithMessage(err, "can't load tls config")
+		}
 	}
 	config.Consumer.Return.Errors = true
 	//OffsetNewest or OffsetOldest.
-	config.Consumer.Offsets.AutoCommit.Interval = time.Duration(s.ctx.Properties().GetInt(OffsetsCommitIntervalProperty)) * time.Second
-	if s.ctx.Properties().GetString(OffsetsInitial) == "newest" {
+	config.Consumer.Offsets.AutoCommit.Interval = time.Duration(ps.GetInt(OffsetsCommitIntervalProperty)) * time.Second
+	if ps.GetString(OffsetsInitial) == "newest" {
 		config.Consumer.Offsets.Initial = sarama.OffsetNewest
 	}
+	//fetch
+	config.Consumer.Fetch.Min = int32(ps.GetInt(FetchMinBytesProperty))
+	config.Consumer.Fetch.Default = int32(ps.GetInt(FetchDefaultBytesProperty))
+	config.Consumer.Fetch.Max = int32(ps.GetInt(FetchMaxBytesProperty))
+	config.Consumer.MaxWaitTime = ps.GetDuration(MaxWaitProperty)
+	switch level := ps.GetString(IsolationLevelProperty); level {
+	case "read_uncommitted":
+		config.Consumer.IsolationLevel = sarama.ReadUncommitted
+	case "read_committed":
+		config.Consumer.IsolationLevel = sarama.ReadCommitted
+	default:
+		return nil, errors.WithMessagef(ErrUnknownOption, "isolation level %s", level)
+	}
+	//group
+	config.Consumer.Group.Session.Timeout = ps.GetDuration(SessionTimeoutProperty)
+	config.Consumer.Group.Heartbeat.Interval = ps.GetDuration(HeartbeatIntervalProperty)
+	switch strategy := ps.GetString(RebalanceStrategyProperty); strategy {
+	case "range":
+		config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRange
+	case "roundrobin":
+		config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
+	case "sticky":
+		config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategySticky
+	default:
+		return nil, errors.WithMessagef(ErrUnknownOption, "rebalance strategy %s", strategy)
+	}
 	//clientId
-	clientId := s.ctx.Properties().GetString(ClientIdProperty)
+	clientId := ps.GetString(ClientIdProperty)
 	if clientId != "" {
 		config.ClientID = clientId
 	}
+	return config, config.Validate()
+}
+
+func tlsConfig(ps athena.Properties) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: ps.GetBool(TLSSkipVerifyProperty)}
+	if ca := ps.GetString(TLSCAProperty); ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.WithMessage(ErrUnknownOption, "no cert in ca file")
+		}
+	}
+	if cert := ps.GetString(TLSCertProperty); cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, ps.GetString(TLSKeyProperty))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	return config, nil
+}
+
+func parseTimestamp(text string) (time.Time, error) {
+	if text == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, text)
+}
+
+//resolve parse the assignment specs and resolve their offsets by start timestamp or initial offset
+func (s *source) resolve(specs []string, initial int64) ([]assignment, error) {
+	var assignments []assignment
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || len(parts) > 4 {
+			return nil, errors.WithMessage(ErrInvalidAssignment, spec)
+		}
+		partition, err := strconv.ParseInt(parts[1], 10, 32)
+		if err != nil {
+			return nil, errors.WithMessage(ErrInvalidAssignment, spec)
+		}
+		a := assignment{topic: parts[0], partition: int32(partition), offset: initial, end: -1}
+		if len(parts) > 2 && parts[2] != "" {
+			if a.offset, err = parseOffset(parts[2]); err != nil {
+				return nil, errors.WithMessage(err, spec)
+			}
+		} else if !s.startTimestamp.IsZero() {
+			if a.offset, err = s.client.GetOffset(a.topic, a.partition, s.startTimestamp.UnixMilli()); err != nil {
+				return nil, errors.WithMessagef(err, "can't get offset of %s by timestamp", spec)
+			}
+			//no message after start timestamp
+			if a.offset < 0 {
+				a.offset = sarama.OffsetNewest
+			}
+		}
+		if len(parts) > 3 && parts[3] != "" {
+			if a.end, err = parseOffset(parts[3]); err != nil {
+				return nil, errors.WithMessage(err, spec)
+			}
+			if a.end == sarama.OffsetNewest {
+				if a.end, err = s.client.GetOffset(a.topic, a.partition, sarama.OffsetNewest); err != nil {
+					return nil, errors.WithMessagef(err, "can't get newest offset of %s", spec)
+				}
+			}
+		} else if a.end, err = s.endOffset(a.topic, a.partition); err != nil {
+			return nil, errors.WithMessage(err, spec)
+		}
+		//offset of bounded partition is compared with end before consuming, oldest and newest are resolved
+		if a.end >= 0 && a.offset < 0 {
+			if a.offset, err = s.client.GetOffset(a.topic, a.partition, a.offset); err != nil {
+				return nil, errors.WithMessagef(err, "can't get offset of %s", spec)
+			}
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, nil
+}
 
-	s.consumerGroup, err = sarama.NewConsumerGroup(s.ctx.Properties().GetStringSlice(BrokersProperty), s.ctx.Properties().GetString(GroupIdProperty), config)
+//endOffset resolve the end offset of partition by end timestamp, -1 if unbounded.
+//if no message is after end timestamp, the end is newest offset when end timestamp has passed,
+//otherwise it's unbounded and stopped by the timestamp of messages
+func (s *source) endOffset(topic string, partition int32) (int64, error) {
+	if s.endTimestamp.IsZero() {
+		return -1, nil
+	}
+	offset, err := s.client.GetOffset(topic, partition, s.endTimestamp.UnixMilli())
 	if err != nil {
-		return err
+		return 0, errors.WithMessage(err, "can't get offset by end timestamp")
 	}
-	go s.handleErrors()
-	return nil
+	if offset >= 0 || s.endTimestamp.After(time.Now()) {
+		return offset, nil
+	}
+	if offset, err = s.client.GetOffset(topic, partition, sarama.OffsetNewest); err != nil {
+		return 0, errors.WithMessage(err, "can't get newest offset")
+	}
+	return offset, nil
+}
+
+func parseOffset(text string) (int64, error) {
+	switch text {
+	case "oldest":
+		return sarama.OffsetOldest, nil
+	case "newest":
+		return sarama.OffsetNewest, nil
+	}
+	offset, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidAssignment
+	}
+	return offset, nil
 }
 
 func (s *source) Close() error {
 	var err error
 	for i := 1; i < 4; i++ {
-		err = s.consumerGroup.Close()
+		if s.consumer != nil {
+			err = s.consumer.Close()
+		} else {
+			err = s.consumerGroup.Close()
+		}
 		if err != nil {
 			s.logger.Warnw("close kafka consumer error, waiting 1 second.", "time", i, "err", err)
 			time.Sleep(1 * time.Second)
 		} else {
+			if !s.client.Closed() {
+				return s.client.Close()
+			}
 			return nil
 		}
 	}
@@ -85,18 +435,115 @@ func (s *source) Close() error {
 }
 
 func (s *source) PropertiesDef() athena.PropertiesDef {
-	return athena.PropertiesDef{TopicsProperty, VersionProperty, BrokersProperty, GroupIdProperty, OffsetsCommitIntervalProperty, OffsetsInitial}
+	return athena.PropertiesDef{TopicsProperty, VersionProperty, BrokersProperty, ClientIdProperty, GroupIdProperty, OffsetsCommitIntervalProperty, OffsetsInitial,
+		AssignmentsProperty, StartTimestampProperty, EndTimestampProperty, RebalanceTimeoutProperty,
+		SASLUserProperty, SASLPasswordProperty, SASLMechanismProperty,
+		TLSEnableProperty, TLSCAProperty, TLSCertProperty, TLSKeyProperty, TLSSkipVerifyProperty,
+		FetchMinBytesProperty, FetchDefaultBytesProperty, FetchMaxBytesProperty, MaxWaitProperty, IsolationLevelProperty,
+		SessionTimeoutProperty, HeartbeatIntervalProperty, RebalanceStrategyProperty,
+		DecoderProperty, CodecProperty, KeepRawProperty, SchemaRegistryUrlProperty, SchemaRegistryUserProperty, SchemaRegistryPasswordProperty, SchemaRegistryTimeoutProperty}
+}
+
+//collectAssignments consume the manual assigned partitions, complete when all bounded partitions reach end
+func (s *source) collectAssignments() error {
+	var (
+		wg     sync.WaitGroup
+		errs   = make(chan error, len(s.assignments))
+		stopCh = make(chan struct{})
+	)
+	for _, a := range s.assignments {
+		if a.end >= 0 && a.offset >= a.end {
+			s.logger.Infow("partition already reach end offset.", "topic", a.topic, "partition", a.partition)
+			continue
+		}
+		pc, err := s.consumer.ConsumePartition(a.topic, a.partition, a.offset)
+		if err != nil {
+			close(stopCh)
+			wg.Wait()
+			return errors.WithMessagef(err, "can't consume %s:%d", a.topic, a.partition)
+		}
+		wg.Add(1)
+		go func(a assignment, pc sarama.PartitionConsumer) {
+			defer wg.Done()
+			defer pc.AsyncClose()
+			if err := s.consumePartition(a, pc, stopCh); err != nil {
+				errs <- err
+			}
+		}(a, pc)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-s.ctx.Done():
+		close(stopCh)
+		<-done
+		return nil
+	case err := <-errs:
+		close(stopCh)
+		<-done
+		return errors.WithMessage(err, "can't collect kafka")
+	case <-done:
+		select {
+		case err := <-errs:
+			return errors.WithMessage(err, "can't collect kafka")
+		default:
+		}
+		s.logger.Info("all partitions reach end, complete.")
+		return nil
+	}
+}
+
+func (s *source) consumePartition(a assignment, pc sarama.PartitionConsumer, stopCh chan struct{}) error {
+	lag := s.metrics.KafkaLag(a.topic, a.partition)
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case err := <-pc.Errors():
+			return err
+		case message, ok := <-pc.Messages():
+			if !ok {
+				return nil
+			}
+			if a.end >= 0 && message.Offset >= a.end {
+				s.logger.Infow("partition reach end offset.", "topic", a.topic, "partition", a.partition, "end", a.end)
+				return nil
+			}
+			if !s.endTimestamp.IsZero() && !message.Timestamp.Before(s.endTimestamp) {
+				s.logger.Infow("partition reach end timestamp.", "topic", a.topic, "partition", a.partition)
+				return nil
+			}
+			lag.Set(float64(pc.HighWaterMarkOffset() - message.Offset - 1))
+			s.emitNext(s.event(message), nil)
+			if a.end >= 0 && message.Offset+1 >= a.end {
+				s.logger.Infow("partition reach end offset.", "topic", a.topic, "partition", a.partition, "end", a.end)
+				return nil
+			}
+		}
+	}
 }
 
 func (s *source) Collect(emitNext athena.EmitNext) error {
 	s.emitNext = emitNext
+	if s.consumer != nil {
+		return s.collectAssignments()
+	}
+	ctx, cancel := _c.WithCancel(s.ctx.Ctx())
+	defer cancel()
+	s.cancel = cancel
 	for {
 		var err error
 		select {
-		case <-s.ctx.Done():
+		case <-ctx.Done():
+			if s.bounded() {
+				s.logger.Info("all partitions reach end, complete.")
+			}
 			return nil
 		default:
-			err = s.consumerGroup.Consume(s.ctx.Ctx(), s.ctx.Properties().GetStringSlice(TopicsProperty), s)
+			err = s.consumerGroup.Consume(ctx, s.ctx.Properties().GetStringSlice(TopicsProperty), s)
 			if err != nil {
 				return errors.WithMessage(err, "can't collect kafka")
 			}
@@ -105,13 +552,52 @@ func (s *source) Collect(emitNext athena.EmitNext) error {
 
 }
 
-func (s *source) Setup(_ sarama.ConsumerGroupSession) error {
-	s.logger.Infof("set up...")
+//Setup reset the offsets of newly claimed partitions to start timestamp
+func (s *source) Setup(session sarama.ConsumerGroupSession) error {
+	s.logger.Infow("set up...", "claims", session.Claims())
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.claimed = 0
+	for _, partitions := range session.Claims() {
+		s.claimed += len(partitions)
+	}
+	s.ended = 0
+	s.inflight = newFlight()
+	if s.startTimestamp.IsZero() {
+		return nil
+	}
+	for topic, partitions := range session.Claims() {
+		for _, partition := range partitions {
+			key := fmt.Sprintf("%s:%d", topic, partition)
+			if s.reset[key] {
+				continue
+			}
+			offset, err := s.client.GetOffset(topic, partition, s.startTimestamp.UnixMilli())
+			if err != nil {
+				return errors.WithMessagef(err, "can't get offset of %s by timestamp", key)
+			}
+			if offset >= 0 {
+				s.logger.Infow("reset offset by start timestamp.", "topic", topic, "partition", partition, "offset", offset)
+				session.ResetOffset(topic, partition, offset, "")
+			}
+			s.reset[key] = true
+		}
+	}
 	return nil
 }
 
-func (s *source) Cleanup(_ sarama.ConsumerGroupSession) error {
+//Cleanup flush the in flight acks before partitions are revoked
+func (s *source) Cleanup(session sarama.ConsumerGroupSession) error {
 	s.logger.Infof("clean up...")
+	s.mutex.Lock()
+	inflight := s.inflight
+	s.mutex.Unlock()
+	select {
+	case <-inflight.close():
+	case <-time.After(s.rebalanceTimeout):
+		s.logger.Warnw("flush in flight acks timeout, they will be consumed again.", "timeout", s.rebalanceTimeout)
+	}
+	session.Commit()
 	return nil
 }
 
@@ -131,30 +617,120 @@ func (s *source) handleErrors() {
 }
 
 func (s *source) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	s.mutex.Lock()
+	inflight := s.inflight
+	s.mutex.Unlock()
+	end, reached, err := s.claimEnd(claim)
+	if err != nil {
+		return err
+	}
+	if reached {
+		s.end(claim)
+		return nil
+	}
+	lag := s.metrics.KafkaLag(claim.Topic(), claim.Partition())
 	for message := range claim.Messages() {
-		headers := map[string]string{}
-		for _, recordHeader := range message.Headers {
-			headers[string(recordHeader.Key)] = string(recordHeader.Value)
-		}
-		s.emitNext(
-			&athena.Event{
-				Meta: map[string]any{
-					"topic":     message.Topic,
-					"partition": message.Partition,
-					"offset":    message.Offset,
-					"timestamp": message.Timestamp},
-				Message: map[string]any{
-					"value":   *(*string)(unsafe.Pointer(&message.Value)),
-					"key":     *(*string)(unsafe.Pointer(&message.Key)),
-					"headers": headers,
-				},
-				Time: time.Now()}, func() {
-				session.MarkMessage(message, "")
-			})
+		lag.Set(float64(claim.HighWaterMarkOffset() - message.Offset - 1))
+		if end >= 0 && message.Offset >= end || !s.endTimestamp.IsZero() && !message.Timestamp.Before(s.endTimestamp) {
+			s.end(claim)
+			return nil
+		}
+		inflight.add()
+		message := message
+		s.emitNext(s.event(message), func() {
+			session.MarkMessage(message, "")
+			inflight.done()
+		})
+		if end >= 0 && message.Offset+1 >= end {
+			s.end(claim)
+			return nil
+		}
 	}
 	return nil
 }
 
+//claimEnd return the end offset of claimed partition and whether initial offset already reach it
+func (s *source) claimEnd(claim sarama.ConsumerGroupClaim) (int64, bool, error) {
+	key := fmt.Sprintf("%s:%d", claim.Topic(), claim.Partition())
+	s.mutex.Lock()
+	end, ok := s.ends[key]
+	s.mutex.Unlock()
+	if !ok {
+		var err error
+		if end, err = s.endOffset(claim.Topic(), claim.Partition()); err != nil {
+			return 0, false, errors.WithMessage(err, key)
+		}
+		if end < 0 {
+			return end, false, nil
+		}
+		s.mutex.Lock()
+		s.ends[key] = end
+		s.mutex.Unlock()
+	}
+	offset := claim.InitialOffset()
+	if offset < 0 {
+		var err error
+		if offset, err = s.client.GetOffset(claim.Topic(), claim.Partition(), offset); err != nil {
+			return 0, false, errors.WithMessagef(err, "can't get offset of %s", key)
+		}
+	}
+	return end, offset >= end, nil
+}
+
+//end stop the claimed partition and drain its messages until the session ends, sarama ends the session once any claim returns.
+//consuming is canceled when all claimed partitions end
+func (s *source) end(claim sarama.ConsumerGroupClaim) {
+	s.logger.Infow("partition reach end.", "topic", claim.Topic(), "partition", claim.Partition())
+	s.mutex.Lock()
+	if s.ended++; s.ended == s.claimed {
+		s.cancel()
+	}
+	s.mutex.Unlock()
+	for range claim.Messages() {
+	}
+}
+
+func (s *source) bounded() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.claimed > 0 && s.ended == s.claimed
+}
+
+func (s *source) event(message *sarama.ConsumerMessage) *athena.Event {
+	headers := map[string]string{}
+	for _, recordHeader := range message.Headers {
+		headers[string(recordHeader.Key)] = string(recordHeader.Value)
+	}
+	event := &athena.Event{
+		Meta: map[string]any{
+			"topic":     message.Topic,
+			"partition": message.Partition,
+			"offset":    message.Offset,
+			"timestamp": message.Timestamp},
+		Time: time.Now()}
+	if s.decoder != nil {
+		decoded, err := s.decoder.Decode(message.Value)
+		if err == nil {
+			event.Message = decoded
+			event.Meta["key"] = string(message.Key)
+			event.Meta["headers"] = headers
+			if s.keepRaw {
+				event.Meta["raw"] = message.Value
+			}
+			return event
+		}
+		//keep the raw message, downstream can route it by decode_error meta
+		s.logger.Debugw("can't decode message.", "topic", message.Topic, "partition", message.Partition, "offset", message.Offset, "err", err)
+		event.Meta[MetaDecodeError] = err.Error()
+	}
+	event.Message = map[string]any{
+		"value":   *(*string)(unsafe.Pointer(&message.Value)),
+		"key":     *(*string)(unsafe.Pointer(&message.Key)),
+		"headers": headers,
+	}
+	return event
+}
+
 func New() athena.Source {
 	return &source{}
 }
@@ -0,0 +1,81 @@
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("t", 0, broker.BrokerID()).SetLeader("t", 1, broker.BrokerID()),
+		//partition 1 is empty, no message after timestamps
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset("t", 0, sarama.OffsetOldest, 0).SetOffset("t", 0, sarama.OffsetNewest, 10).SetOffset("t", 0, past.UnixMilli(), 5).
+			SetOffset("t", 1, sarama.OffsetOldest, 3).SetOffset("t", 1, sarama.OffsetNewest, 3).SetOffset("t", 1, past.UnixMilli(), -1).
+			SetOffset("t", 1, future.UnixMilli(), -1),
+	})
+	config := sarama.NewConfig()
+	config.Version = sarama.V0_10_1_0
+	client, err := sarama.NewClient([]string{broker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		spec         string
+		endTimestamp time.Time
+		assignment   assignment
+	}{
+		{spec: "t:0:2", assignment: assignment{topic: "t", partition: 0, offset: 2, end: -1}},
+		{spec: "t:0::newest", assignment: assignment{topic: "t", partition: 0, offset: 0, end: 10}},
+		//symbolic offsets of empty bounded partitions are resolved, it reaches end before consuming
+		{spec: "t:1:oldest:newest", assignment: assignment{topic: "t", partition: 1, offset: 3, end: 3}},
+		//end timestamp is resolved to offset, an idle partition reaches it
+		{spec: "t:0", endTimestamp: past, assignment: assignment{topic: "t", partition: 0, offset: 0, end: 5}},
+		{spec: "t:1", endTimestamp: past, assignment: assignment{topic: "t", partition: 1, offset: 3, end: 3}},
+		//no message after future end timestamp yet, stopped by message timestamp
+		{spec: "t:1", endTimestamp: future, assignment: assignment{topic: "t", partition: 1, offset: sarama.OffsetOldest, end: -1}},
+	}
+	for _, test := range tests {
+		s := &source{client: client, endTimestamp: test.endTimestamp}
+		assignments, err := s.resolve([]string{test.spec}, sarama.OffsetOldest)
+		if err != nil {
+			t.Fatalf("spec %s, %v", test.spec, err)
+		}
+		if len(assignments) != 1 || assignments[0] != test.assignment {
+			t.Fatalf("spec %s, expect %v, got %v", test.spec, test.assignment, assignments)
+		}
+	}
+}
+
+func TestFlight(t *testing.T) {
+	f := newFlight()
+	f.add()
+	f.add()
+	f.done()
+	flushed := f.close()
+	select {
+	case <-flushed:
+		t.Fatal("flushed with event in flight")
+	default:
+	}
+	f.done()
+	select {
+	case <-flushed:
+	default:
+		t.Fatal("not flushed after all events acked")
+	}
+	//no event in flight, flushed on close
+	select {
+	case <-newFlight().close():
+	default:
+		t.Fatal("empty session is not flushed")
+	}
+}
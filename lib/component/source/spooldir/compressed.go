@@ -0,0 +1,190 @@
+package spooldir
+
+import (
+	"archive/tar"
+	"athena/athena"
+	"athena/lib/multiline"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	//tarMagic is at offset 257 of tar header
+	tarMagic       = []byte("ustar")
+	tarMagicOffset = 257
+)
+
+//detectCompression detect compression by extension, then by magic bytes, empty if file is plain
+func detectCompression(filePath string) (string, error) {
+	switch {
+	case strings.HasSuffix(filePath, ".gz"), strings.HasSuffix(filePath, ".tgz"):
+		return compressionGzip, nil
+	case strings.HasSuffix(filePath, ".zst"):
+		return compressionZstd, nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	magic := make([]byte, len(zstdMagic))
+	n, _ := io.ReadFull(file, magic)
+	switch {
+	case bytes.HasPrefix(magic[:n], gzipMagic):
+		return compressionGzip, nil
+	case bytes.HasPrefix(magic[:n], zstdMagic):
+		return compressionZstd, nil
+	}
+	return "", nil
+}
+
+func decompress(reader io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case compressionGzip:
+		return gzip.NewReader(reader)
+	case compressionZstd:
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return io.NopCloser(reader), nil
+}
+
+//isTar check the tar magic of decompressed stream
+func isTar(reader *bufio.Reader) bool {
+	header, _ := reader.Peek(tarMagicOffset + len(tarMagic))
+	return len(header) == tarMagicOffset+len(tarMagic) && bytes.Equal(header[tarMagicOffset:], tarMagic)
+}
+
+//combineCompressed stream the decompressed lines, offset is in uncompressed bytes,
+//for tar it is counted over the contents of regular entries
+func (s *source) combineCompressed(filePath string, fileId Identify, offset int64, compression string) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		s.logger.Errorw("can't open, skip file.", "path", filePath, "err", err)
+		return
+	}
+	defer file.Close()
+	decompressed, err := decompress(bufio.NewReader(file), compression)
+	if err != nil {
+		s.logger.Errorw("can't decompress, skip file.", "path", filePath, "compression", compression, "err", err)
+		return
+	}
+	defer decompressed.Close()
+
+	entry := ""
+	fileMeta := s.meta(filePath)
+	joiner, err := multiline.New(s.ctx.Properties(), func(line *multiline.Line) {
+		meta := make(map[string]interface{}, len(fileMeta)+4)
+		for key, value := range fileMeta {
+			meta[key] = value
+		}
+		meta["time"], meta["offset"] = line.Time, line.Offset
+		if entry != "" {
+			meta["entry"] = entry
+		}
+		s.emitNext(&athena.Event{Meta: meta, Message: s.decode(line.Text, meta), Time: time.Now()}, nil)
+		offset = line.Offset
+	})
+	if err != nil {
+		s.logger.Errorw("multiline error, skip this file.", "path", filePath, "err", err)
+		return
+	}
+	var (
+		reader     = bufio.NewReader(decompressed)
+		readOffset int64
+		done       bool
+	)
+	if isTar(reader) {
+		tarReader := tar.NewReader(reader)
+		for !done {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				s.logger.Errorw("read tar error, skip file.", "path", filePath, "err", err)
+				joiner.Flush()
+				return
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			//skip entries before offset
+			if readOffset+header.Size <= offset {
+				readOffset += header.Size
+				continue
+			}
+			joiner.Flush()
+			entry = header.Name
+			done, readOffset, err = s.readLines(bufio.NewReader(tarReader), readOffset, offset, joiner)
+			if err != nil {
+				s.logger.Errorw("read tar entry error, skip file.", "path", filePath, "entry", entry, "err", err)
+				joiner.Flush()
+				return
+			}
+		}
+	} else {
+		done, _, err = s.readLines(reader, 0, offset, joiner)
+		if err != nil {
+			s.logger.Errorw("read compressed file error, skip file.", "path", filePath, "err", err)
+			joiner.Flush()
+			return
+		}
+	}
+	joiner.Flush()
+	if done {
+		s.logger.Info("ctx done, save position to state.")
+		s.state.Store(fileId, offset)
+		return
+	}
+	s.logger.Debugf("combine %s done, start afterCombine.", filePath)
+	s.afterCombine(filePath, fileId)
+}
+
+//readLines add lines after skip offset to joiner, return true if ctx is done
+func (s *source) readLines(reader *bufio.Reader, readOffset int64, skip int64, joiner *multiline.Joiner) (bool, int64, error) {
+	if skip > readOffset {
+		n, err := io.CopyN(io.Discard, reader, skip-readOffset)
+		readOffset += n
+		if err != nil {
+			if err == io.EOF {
+				return false, readOffset, nil
+			}
+			return false, readOffset, err
+		}
+	}
+	for {
+		select {
+		case <-s.ctx.Done():
+			return true, readOffset, nil
+		default:
+		}
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			readOffset += int64(len(line))
+			joiner.Add(strings.TrimRight(line, "\n"), readOffset, time.Now())
+		}
+		if err == io.EOF {
+			return false, readOffset, nil
+		}
+		if err != nil {
+			return false, readOffset, err
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package spooldir
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+//pendingFile is a file waiting to be ready for combine
+type pendingFile struct {
+	path    string
+	id      Identify
+	size    int64
+	modTime time.Time
+	//stable is the time since size and mod time are unchanged
+	stable time.Time
+}
+
+//enqueue add the file to pending queue, its identify is stored to state so that it is recovered after restart
+func (s *source) enqueue(filePath string) {
+	if !s.pattern.MatchString(filePath) ||
+		(s.tempPattern != nil && s.tempPattern.MatchString(filepath.Base(filePath))) ||
+		(s.marker != "" && strings.HasSuffix(filePath, s.marker)) {
+		return
+	}
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		return
+	}
+	id := convertStatToIdentify(info.Sys().(*syscall.Stat_t))
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+	if _, ok := s.pendingPaths[filePath]; ok {
+		return
+	}
+	if _, ok := s.state.Load(id); !ok {
+		s.state.Store(id, int64(0))
+	}
+	pf := &pendingFile{path: filePath, id: id, size: info.Size(), modTime: info.ModTime(), stable: time.Now()}
+	s.pendingPaths[filePath] = pf
+	s.pendingQueue.Add(pf)
+}
+
+//dispatch submit ready files to free workers of combine pool in arrival order
+func (s *source) dispatch() {
+	var ready []*pendingFile
+	free := s.combinePool.Cap() - int(atomic.LoadInt32(&s.combining))
+	s.pendingMutex.Lock()
+	for i, n := 0, s.pendingQueue.Length(); i < n; i++ {
+		pf := s.pendingQueue.Remove().(*pendingFile)
+		info, err := os.Stat(pf.path)
+		if err != nil {
+			s.logger.Warnw("pending file disappeared, skip file.", "path", pf.path, "err", err)
+			delete(s.pendingPaths, pf.path)
+			s.state.Delete(pf.id)
+			continue
+		}
+		if len(ready) < free && s.ready(pf, info) {
+			delete(s.pendingPaths, pf.path)
+			ready = append(ready, pf)
+		} else {
+			s.pendingQueue.Add(pf)
+		}
+	}
+	s.pendingMutex.Unlock()
+	for _, pf := range ready {
+		s.submitCombine(pf.path)
+	}
+}
+
+//ready check the readiness rules, all configured rules must be satisfied
+func (s *source) ready(pf *pendingFile, info os.FileInfo) bool {
+	now := time.Now()
+	if info.Size() != pf.size || !info.ModTime().Equal(pf.modTime) {
+		pf.size, pf.modTime, pf.stable = info.Size(), info.ModTime(), now
+	}
+	if s.marker != "" {
+		if _, err := os.Stat(pf.path + s.marker); err != nil {
+			return false
+		}
+	}
+	if s.minAge > 0 && now.Sub(info.ModTime()) < s.minAge {
+		return false
+	}
+	if s.quiescence > 0 && now.Sub(pf.stable) < s.quiescence {
+		return false
+	}
+	return true
+}
@@ -2,9 +2,12 @@ package spooldir
 
 import (
 	"athena/athena"
+	"athena/lib/codec"
 	"athena/lib/component"
 	"athena/lib/log"
+	"athena/lib/multiline"
 	"athena/lib/properties"
+	"athena/pkg/queue"
 	"bytes"
 	"encoding/gob"
 	"fmt"
@@ -15,10 +18,10 @@ import (
 	"io"
 	"io/fs"
 	"os"
-	"path"
 	"path/filepath"
 	"regexp"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -28,6 +31,16 @@ var (
 	BackupProperty     = properties.NewProperty[string]("backup", "if backup is nil, remove file after combine", "")
 	PatternProperty    = properties.NewProperty[string]("pattern", "regex pattern", ".*")
 	ConcurrentProperty = properties.NewProperty[int]("concurrent", "combine number", 1)
+
+	ReadyQuiescenceProperty = properties.NewProperty[time.Duration]("ready-quiescence", "file is ready when size and mod time are unchanged for the duration, 0 is disabled", time.Duration(0))
+	ReadyMinAgeProperty     = properties.NewProperty[time.Duration]("ready-min-age", "file is ready when mod time is older than the duration, 0 is disabled", time.Duration(0))
+	ReadyMarkerProperty     = properties.NewProperty[string]("ready-marker", "file is ready when <file><marker> exists, like .done, marker is removed after combine", "")
+	TempPatternProperty     = properties.NewProperty[string]("temp-pattern", "regex of temp file names ignored until renamed, like \\.tmp$", "")
+	ReadyIntervalProperty   = properties.NewProperty[time.Duration]("ready-interval", "interval of checking pending files readiness", time.Second)
+	RecursiveProperty       = properties.NewProperty[bool]("recursive", "watch sub directories of scan dir, backup mirrors the sub directory layout", false)
+	PathMetaProperty        = properties.NewProperty[string]("path-meta", "regex with named groups extracting meta from file path, like /(?P<host>[^/]+)/(?P<date>\\d+)/", "")
+	VerifySizeProperty      = properties.NewProperty[bool]("verify-size", "combine is complete only if the whole file size is read, otherwise file is pending again", true)
+	CodecProperty           = codec.Property("lines")
 )
 
 type source struct {
@@ -39,6 +52,23 @@ type source struct {
 	pattern     *regexp.Regexp
 	combinePool *ants.PoolWithFunc
 
+	tempPattern   *regexp.Regexp
+	marker        string
+	minAge        time.Duration
+	quiescence    time.Duration
+	readyInterval time.Duration
+	verifySize    bool
+	recursive     bool
+	pathMeta      *regexp.Regexp
+	decoder       *codec.LineDecoder
+	pendingMutex  sync.Mutex
+	pendingQueue  *queue.Queue
+	pendingPaths  map[string]*pendingFile
+	//combining is the number of files submitted and not finished
+	combining int32
+	//workers wait the combine tasks, so offsets are stored and events are emitted before Collect returns
+	workers sync.WaitGroup
+
 	emitNext athena.EmitNext
 	state    sync.Map
 	mutex    sync.Mutex
@@ -85,12 +115,42 @@ func (s *source) Open(ctx athena.Context) (err error) {
 	if err != nil {
 		return err
 	}
+	if _, err = multiline.New(ctx.Properties(), nil); err != nil {
+		return err
+	}
+	if s.decoder, err = codec.NewLineDecoder(ctx.Properties(), CodecProperty); err != nil {
+		return err
+	}
+	if tempPattern := ctx.Properties().GetString(TempPatternProperty); tempPattern != "" {
+		if s.tempPattern, err = regexp.Compile(tempPattern); err != nil {
+			return err
+		}
+	}
+	s.marker = ctx.Properties().GetString(ReadyMarkerProperty)
+	s.minAge = ctx.Properties().GetDuration(ReadyMinAgeProperty)
+	s.quiescence = ctx.Properties().GetDuration(ReadyQuiescenceProperty)
+	s.readyInterval = ctx.Properties().GetDuration(ReadyIntervalProperty)
+	s.verifySize = ctx.Properties().GetBool(VerifySizeProperty)
+	s.recursive = ctx.Properties().GetBool(RecursiveProperty)
+	if pathMeta := ctx.Properties().GetString(PathMetaProperty); pathMeta != "" {
+		if s.pathMeta, err = regexp.Compile(pathMeta); err != nil {
+			return err
+		}
+	}
+	s.pendingQueue = queue.New()
+	s.pendingPaths = map[string]*pendingFile{}
 
 	s.combinePool, err = ants.NewPoolWithFunc(ctx.Properties().GetInt(ConcurrentProperty),
 		func(arg interface{}) {
+			defer s.workers.Done()
+			defer atomic.AddInt32(&s.combining, -1)
+			//the file is recovered from state after restart
+			if s.ctx.Ctx().Err() != nil {
+				return
+			}
 			s.combine(cast.ToString(arg))
 		},
-		ants.WithLogger(&log.TailLoggerWrapper{s.logger}),
+		ants.WithLogger(&log.TailLoggerWrapper{Logger: s.logger}),
 		ants.WithPanicHandler(func(reason interface{}) {
 			if reason != nil {
 				s.logger.Errorw("combine panic.", "reason", reason)
@@ -108,32 +168,43 @@ func (s *source) Close() error {
 }
 
 func (s *source) PropertiesDef() athena.PropertiesDef {
-	return athena.PropertiesDef{ScanProperty, BackupProperty, PatternProperty, ConcurrentProperty}
+	return append(athena.PropertiesDef{ScanProperty, BackupProperty, PatternProperty, ConcurrentProperty,
+		ReadyQuiescenceProperty, ReadyMinAgeProperty, ReadyMarkerProperty, TempPatternProperty, ReadyIntervalProperty, VerifySizeProperty, RecursiveProperty, PathMetaProperty, CodecProperty},
+		multiline.PropertiesDef()...)
 }
 
 func (s *source) Collect(emitNext athena.EmitNext) error {
 	s.emitNext = emitNext
-	if err := s.recoveryCombine(); err != nil {
-		return err
-	}
+	//downstream is drained and the final snapshot is taken after Collect returns
+	defer s.workers.Wait()
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
 	}
-	if err = watcher.Add(s.scanDir); err != nil {
+	if err := s.recoveryCombine(watcher); err != nil {
 		return err
 	}
+	ticker := time.NewTicker(s.readyInterval)
+	defer ticker.Stop()
+	s.dispatch()
 	for {
 		select {
 		case <-s.ctx.Done():
 			return watcher.Close()
 		case e := <-watcher.Events:
 			if e.Op&fsnotify.Create == fsnotify.Create {
-				s.logger.Infof("scan to new files:%s.", e.Name)
-				if s.pattern.MatchString(e.Name) {
-					s.submitCombine(e.Name)
+				if info, err := os.Stat(e.Name); s.recursive && err == nil && info.IsDir() {
+					s.logger.Infof("scan to new dir:%s.", e.Name)
+					if err = s.watch(watcher, e.Name); err != nil {
+						s.logger.Warnw("watch new dir failed.", "dir", e.Name, "err", err)
+					}
+					continue
 				}
+				s.logger.Infof("scan to new files:%s.", e.Name)
+				s.enqueue(e.Name)
 			}
+		case <-ticker.C:
+			s.dispatch()
 		case err = <-watcher.Errors:
 			s.logger.Warnw("watch file system failed.", "err", err)
 		}
@@ -141,16 +212,46 @@ func (s *source) Collect(emitNext athena.EmitNext) error {
 }
 
 func (s *source) submitCombine(filePath string) {
+	atomic.AddInt32(&s.combining, 1)
+	s.workers.Add(1)
 	err := s.combinePool.Invoke(filePath)
 	if err != nil {
+		s.workers.Done()
+		atomic.AddInt32(&s.combining, -1)
 		s.logger.Errorw(fmt.Sprintf("submit %s combine task error, skin file.", filePath), "err", err)
 	}
 }
 
-func (s *source) recoveryCombine() error {
+//watch add watches of dir and its sub directories, enqueue the files created before watched
+func (s *source) watch(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		s.enqueue(path)
+		return nil
+	})
+}
+
+//recoveryCombine add watches and enqueue files in scan dir, files recorded in state are enqueued first
+func (s *source) recoveryCombine(watcher *fsnotify.Watcher) error {
 	identifyMap := map[Identify]string{}
+	var paths []string
 	err := filepath.Walk(s.scanDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if path != s.scanDir && !s.recursive {
+				return filepath.SkipDir
+			}
+			return watcher.Add(path)
+		}
 		identifyMap[convertStatToIdentify(info.Sys().(*syscall.Stat_t))] = path
+		paths = append(paths, path)
 		return nil
 	})
 	if err != nil {
@@ -158,16 +259,44 @@ func (s *source) recoveryCombine() error {
 	}
 	//recovery combine file
 	s.state.Range(func(key, value any) bool {
-		filePath := identifyMap[key.(Identify)]
-		if filePath != "" && s.pattern.MatchString(filePath) {
-			s.submitCombine(filePath)
+		if filePath := identifyMap[key.(Identify)]; filePath != "" {
+			s.enqueue(filePath)
+		} else {
+			s.state.Delete(key)
 		}
-		s.state.Delete(key)
 		return true
 	})
+	for _, path := range paths {
+		s.enqueue(path)
+	}
 	return nil
 }
 
+//meta return the event meta of file, with the named groups of path meta
+func (s *source) meta(filePath string) map[string]interface{} {
+	meta := map[string]interface{}{"file": filePath}
+	if s.pathMeta == nil {
+		return meta
+	}
+	if match := s.pathMeta.FindStringSubmatch(filePath); match != nil {
+		for i, name := range s.pathMeta.SubexpNames() {
+			if i > 0 && name != "" {
+				meta[name] = match[i]
+			}
+		}
+	}
+	return meta
+}
+
+//decode the line to message, the line is kept with decode error meta if it can't be decoded
+func (s *source) decode(text string, meta map[string]interface{}) any {
+	message, err := s.decoder.Decode(text)
+	if err != nil {
+		meta[codec.MetaDecodeError] = err.Error()
+	}
+	return message
+}
+
 func (s *source) combine(filePath string) {
 	fileId, err := convertPathToIdentify(filePath)
 	if err != nil {
@@ -180,6 +309,15 @@ func (s *source) combine(filePath string) {
 	} else {
 		offset = offsetI.(int64)
 	}
+	compression, err := detectCompression(filePath)
+	if err != nil {
+		s.logger.Errorw("can't detect compression, skip file.", "path", filePath, "err", err)
+		return
+	}
+	if compression != "" {
+		s.combineCompressed(filePath, fileId, offset, compression)
+		return
+	}
 	tailFile, err := tail.TailFile(filePath, tail.Config{
 		Location: &tail.SeekInfo{
 			Offset: offset,
@@ -190,40 +328,56 @@ func (s *source) combine(filePath string) {
 		s.logger.Errorw("tail error, skip this file.", "path", filePath, "err", err)
 		return
 	}
+	//offset of joined event is the end of its last line
+	fileMeta := s.meta(filePath)
+	joiner, err := multiline.New(s.ctx.Properties(), func(line *multiline.Line) {
+		meta := make(map[string]interface{}, len(fileMeta)+3)
+		for key, value := range fileMeta {
+			meta[key] = value
+		}
+		meta["time"], meta["offset"] = line.Time, line.Offset
+		s.emitNext(
+			&athena.Event{
+				Meta:    meta,
+				Message: s.decode(line.Text, meta),
+				Time:    time.Now(),
+			}, nil)
+		offset = line.Offset
+	})
+	if err != nil {
+		s.logger.Errorw("multiline error, skip this file.", "path", filePath, "err", err)
+		return
+	}
+	readOffset := offset
 	for {
 		select {
 		case line, ok := <-tailFile.Lines:
 			if ok {
-				s.emitNext(
-					&athena.Event{
-						Meta:    map[string]interface{}{"file": filePath, "time": line.Time},
-						Message: line.Text,
-						Time:    time.Now(),
-					}, nil)
+				readOffset += int64(len(line.Text)) + 1
+				joiner.Add(line.Text, readOffset, line.Time)
 			} else {
+				joiner.Flush()
+				if info, err := os.Stat(filePath); s.verifySize && err == nil && info.Size() > readOffset {
+					s.logger.Warnw("file is not read completely, pending again.", "path", filePath, "read", readOffset, "size", info.Size())
+					s.state.Store(fileId, offset)
+					s.enqueue(filePath)
+					return
+				}
 				s.logger.Debugf("combine %s done, start afterCombine.", filePath)
 				s.afterCombine(filePath, fileId)
 				return
 			}
 		case <-s.ctx.Done():
 			s.logger.Info("ctx done, stopping tail and save position to state.")
-			if tell, err := tailFile.Tell(); err != nil {
-				s.logger.Errorw("un tell file, state error.", "err", err)
-			} else {
-				s.state.Store(fileId, tell)
-				for {
-					line, ok := <-tailFile.Lines
-					if !ok {
-						break
-					}
-					s.emitNext(
-						&athena.Event{
-							Meta:    map[string]interface{}{"file": filePath, "time": line.Time},
-							Message: line.Text,
-							Time:    time.Now(),
-						}, nil)
-				}
+			//drain lines until tail exits
+			tailFile.Kill(nil)
+			for line := range tailFile.Lines {
+				readOffset += int64(len(line.Text)) + 1
+				joiner.Add(line.Text, readOffset, line.Time)
 			}
+			joiner.Flush()
+			s.state.Store(fileId, offset)
+			return
 		}
 	}
 }
@@ -237,12 +391,26 @@ func (s *source) afterCombine(filePath string, fileId Identify) {
 		}
 	} else {
 		//backup file
-		backupPath := path.Join(s.backupDir, path.Base(filePath)+time.Now().Format(".20060102150405"))
+		//backup mirrors the sub directory layout of scan dir
+		relative, err := filepath.Rel(s.scanDir, filePath)
+		if err != nil {
+			relative = filepath.Base(filePath)
+		}
+		backupPath := filepath.Join(s.backupDir, relative+time.Now().Format(".20060102150405"))
+		if err = os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+			s.logger.Errorw("can't create backup dir", "path", backupPath, "err", err)
+			return
+		}
 		if err := os.Rename(filePath, backupPath); err != nil {
 			s.logger.Errorw("can't rename", "path", filePath, "err", err)
 			return
 		}
 	}
+	if s.marker != "" {
+		if err := os.Remove(filePath + s.marker); err != nil && !os.IsNotExist(err) {
+			s.logger.Warnw("can't remove ready marker.", "path", filePath+s.marker, "err", err)
+		}
+	}
 	s.state.Delete(fileId)
 	s.logger.Debugf("after combine %s.", filePath)
 }
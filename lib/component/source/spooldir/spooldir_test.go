@@ -1,7 +1,18 @@
 package spooldir
 
 import (
+	"athena/athena"
+	"athena/lib/context"
+	"athena/lib/log"
+	"athena/lib/properties"
+	_c "context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestSource(t *testing.T) {
@@ -39,3 +50,122 @@ func TestSource(t *testing.T) {
 	//	fmt.Printf("%+v\n", event)
 	//})
 }
+
+//checkpoint pauses emits while snapshotting, but offsets are still stored by acks and pending files
+func TestSnapshotWhileRunning(t *testing.T) {
+	s := &source{}
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for i := 0; i < 1000; i++ {
+			s.state.Store(Identify{Inode: uint64(i % 10)}, int64(i))
+			if i%3 == 0 {
+				s.state.Delete(Identify{Inode: uint64(i % 10)})
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := s.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait.Wait()
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &source{}
+	if err = restored.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if offset, ok := restored.state.Load(Identify{Inode: 8}); !ok || offset.(int64) != 998 {
+		t.Fatalf("expected restored offset 998, got %v", offset)
+	}
+}
+
+//Collect returns after combine workers, so nothing is emitted or stored while downstream is drained
+func TestCollectWaitsWorkers(t *testing.T) {
+	log.Setup(log.DefaultOptions())
+	dir := t.TempDir()
+	scan := filepath.Join(dir, "scan")
+	if err := os.Mkdir(scan, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(scan, "a.log")
+	if err := os.WriteFile(path, []byte(strings.Repeat("line\n", 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "athena.toml")
+	if err := os.WriteFile(file, []byte("[source.spooldir]\nscan = \""+scan+"\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := properties.New(file, properties.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.New(_c.Background(), p).Named("source.spooldir")
+	s := New().(*source)
+	if _, err = properties.InitAndRender(ctx.Properties(), s.PropertiesDef()); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := convertStatToIdentify(info.Sys().(*syscall.Stat_t))
+
+	var (
+		mutex   sync.Mutex
+		emitted []*athena.Event
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	emitNext := func(event *athena.Event, _ athena.ACKHandler) {
+		mutex.Lock()
+		emitted = append(emitted, event)
+		first := len(emitted) == 1
+		mutex.Unlock()
+		if first {
+			close(started)
+			<-release
+		}
+	}
+	count := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(emitted)
+	}
+	result := make(chan error, 1)
+	go func() { result <- s.Collect(emitNext) }()
+	<-started
+	ctx.Cancel()
+	select {
+	case <-result:
+		t.Fatal("Collect returns while the worker is emitting")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err = <-result; err != nil {
+		t.Fatal(err)
+	}
+	n := count()
+	time.Sleep(50 * time.Millisecond)
+	if count() != n {
+		t.Fatalf("events are emitted after Collect returns, %d then %d", n, count())
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	//the offset of the last emitted event is stored, or the file is combined completely
+	offset, ok := s.state.Load(id)
+	if _, statErr := os.Stat(path); ok != (statErr == nil) {
+		t.Fatalf("state and file don't agree, state %v file %v", offset, statErr)
+	}
+	if last := emitted[n-1].Meta["offset"]; ok && offset != last {
+		t.Fatalf("stored offset %v is not the last emitted offset %v", offset, last)
+	}
+}
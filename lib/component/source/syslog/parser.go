@@ -0,0 +1,287 @@
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatAuto    = "auto"
+	FormatRFC3164 = "rfc3164"
+	FormatRFC5424 = "rfc5424"
+
+	FieldFacility       = "facility"
+	FieldSeverity       = "severity"
+	FieldVersion        = "version"
+	FieldTimestamp      = "timestamp"
+	FieldHostname       = "hostname"
+	FieldAppName        = "app_name"
+	FieldProcId         = "proc_id"
+	FieldMsgId          = "msg_id"
+	FieldStructuredData = "structured_data"
+	FieldMessage        = "message"
+
+	nilValue = "-"
+)
+
+var (
+	ErrUnknownFormat  = fmt.Errorf("unknown syslog format")
+	ErrPriority       = fmt.Errorf("invalid syslog priority")
+	ErrTimestamp      = fmt.Errorf("invalid syslog timestamp")
+	ErrHeader         = fmt.Errorf("invalid syslog header")
+	ErrStructuredData = fmt.Errorf("invalid syslog structured data")
+
+	bom = []byte{0xEF, 0xBB, 0xBF}
+
+	//StampMicro is before Stamp, as Stamp matches its prefix
+	rfc3164Layouts = []string{time.StampMicro, time.Stamp, time.RFC3339Nano}
+)
+
+//message is the parsed syslog, fields are emitted as event message
+type message struct {
+	fields    map[string]any
+	timestamp time.Time
+}
+
+type parser func(data []byte) (*message, error)
+
+func newParser(format string) (parser, error) {
+	switch format {
+	case FormatAuto:
+		return parseAuto, nil
+	case FormatRFC3164:
+		return parseRFC3164, nil
+	case FormatRFC5424:
+		return parseRFC5424, nil
+	default:
+		return nil, errors.WithMessage(ErrUnknownFormat, format)
+	}
+}
+
+//parseAuto detect rfc5424 by the version after priority
+func parseAuto(data []byte) (*message, error) {
+	_, rest, err := parsePriority(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		return parseRFC5424(data)
+	}
+	return parseRFC3164(data)
+}
+
+func parsePriority(data []byte) (int, []byte, error) {
+	if len(data) < 3 || data[0] != '<' {
+		return 0, nil, ErrPriority
+	}
+	end := bytes.IndexByte(data[:min(len(data), 5)], '>')
+	if end < 2 {
+		return 0, nil, ErrPriority
+	}
+	priority, err := strconv.Atoi(string(data[1:end]))
+	if err != nil || priority > 191 {
+		return 0, nil, ErrPriority
+	}
+	return priority, data[end+1:], nil
+}
+
+func newMessage(priority int) *message {
+	return &message{fields: map[string]any{
+		FieldFacility: priority / 8,
+		FieldSeverity: priority % 8,
+	}}
+}
+
+//token split the first space separated token
+func token(data []byte) (string, []byte) {
+	index := bytes.IndexByte(data, ' ')
+	if index < 0 {
+		return string(data), nil
+	}
+	return string(data[:index]), data[index+1:]
+}
+
+//parseRFC5424 parse <PRI>VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP SD [SP MSG]
+func parseRFC5424(data []byte) (*message, error) {
+	priority, rest, err := parsePriority(data)
+	if err != nil {
+		return nil, err
+	}
+	m := newMessage(priority)
+	var headers [6]string
+	for i := range headers {
+		if len(rest) == 0 {
+			return nil, ErrHeader
+		}
+		headers[i], rest = token(rest)
+	}
+	version, err := strconv.Atoi(headers[0])
+	if err != nil {
+		return nil, ErrHeader
+	}
+	m.fields[FieldVersion] = version
+	if headers[1] != nilValue {
+		if m.timestamp, err = time.Parse(time.RFC3339Nano, headers[1]); err != nil {
+			return nil, ErrTimestamp
+		}
+		m.fields[FieldTimestamp] = m.timestamp
+	}
+	for i, field := range []string{FieldHostname, FieldAppName, FieldProcId, FieldMsgId} {
+		if headers[i+2] != nilValue {
+			m.fields[field] = headers[i+2]
+		}
+	}
+	sd, rest, err := parseStructuredData(rest)
+	if err != nil {
+		return nil, err
+	}
+	if sd != nil {
+		m.fields[FieldStructuredData] = sd
+	}
+	if len(rest) > 0 && rest[0] == ' ' {
+		rest = rest[1:]
+	}
+	m.fields[FieldMessage] = string(bytes.TrimPrefix(rest, bom))
+	return m, nil
+}
+
+//parseStructuredData parse "-" or [SD-ID *(SP PARAM-NAME="PARAM-VALUE")]...
+func parseStructuredData(data []byte) (map[string]any, []byte, error) {
+	if len(data) == 0 {
+		return nil, data, ErrStructuredData
+	}
+	if data[0] == '-' {
+		return nil, data[1:], nil
+	}
+	if data[0] != '[' {
+		return nil, nil, ErrStructuredData
+	}
+	sd := map[string]any{}
+	for len(data) > 0 && data[0] == '[' {
+		data = data[1:]
+		end := bytes.IndexAny(data, " ]")
+		if end <= 0 {
+			return nil, nil, ErrStructuredData
+		}
+		id := string(data[:end])
+		data = data[end:]
+		params := map[string]any{}
+		for len(data) > 0 && data[0] == ' ' {
+			data = data[1:]
+			eq := bytes.IndexByte(data, '=')
+			if eq <= 0 || len(data) < eq+2 || data[eq+1] != '"' {
+				return nil, nil, ErrStructuredData
+			}
+			name := string(data[:eq])
+			data = data[eq+2:]
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(data); i++ {
+				switch {
+				case data[i] == '\\' && i+1 < len(data) && (data[i+1] == '"' || data[i+1] == '\\' || data[i+1] == ']'):
+					value.WriteByte(data[i+1])
+					i++
+				case data[i] == '"':
+					data = data[i+1:]
+					closed = true
+				default:
+					value.WriteByte(data[i])
+				}
+				if closed {
+					break
+				}
+			}
+			if !closed {
+				return nil, nil, ErrStructuredData
+			}
+			params[name] = value.String()
+		}
+		if len(data) == 0 || data[0] != ']' {
+			return nil, nil, ErrStructuredData
+		}
+		data = data[1:]
+		sd[id] = params
+	}
+	return sd, data, nil
+}
+
+//parseRFC3164 parse <PRI>TIMESTAMP SP HOSTNAME SP TAG[PID]: MSG, timestamp without year is in the current year
+func parseRFC3164(data []byte) (*message, error) {
+	priority, rest, err := parsePriority(data)
+	if err != nil {
+		return nil, err
+	}
+	m := newMessage(priority)
+	if m.timestamp, rest, err = parseRFC3164Timestamp(rest); err != nil {
+		return nil, err
+	}
+	m.fields[FieldTimestamp] = m.timestamp
+	if len(rest) > 0 && rest[0] == ' ' {
+		rest = rest[1:]
+	}
+	var hostname string
+	hostname, rest = token(rest)
+	if hostname == "" {
+		return nil, ErrHeader
+	}
+	m.fields[FieldHostname] = hostname
+	//tag is alphanumeric chars up to 32, end with [pid]: or :
+	end := 0
+	for end < len(rest) && end < 48 && rest[end] != '[' && rest[end] != ':' && rest[end] != ' ' {
+		end++
+	}
+	if end > 0 && end < len(rest) && (rest[end] == '[' || rest[end] == ':') {
+		m.fields[FieldAppName] = string(rest[:end])
+		rest = rest[end:]
+		if rest[0] == '[' {
+			if pidEnd := bytes.IndexByte(rest, ']'); pidEnd > 0 {
+				m.fields[FieldProcId] = string(rest[1:pidEnd])
+				rest = rest[pidEnd+1:]
+			}
+		}
+		rest = bytes.TrimPrefix(rest, []byte(":"))
+		rest = bytes.TrimPrefix(rest, []byte(" "))
+	}
+	m.fields[FieldMessage] = string(rest)
+	return m, nil
+}
+
+func parseRFC3164Timestamp(data []byte) (time.Time, []byte, error) {
+	for _, layout := range rfc3164Layouts {
+		size := len(layout)
+		if layout == time.RFC3339Nano {
+			size = bytes.IndexByte(data, ' ')
+			if size < 0 {
+				size = len(data)
+			}
+		}
+		if len(data) < size {
+			continue
+		}
+		timestamp, err := time.ParseInLocation(layout, string(data[:size]), time.Local)
+		if err != nil {
+			continue
+		}
+		if timestamp.Year() == 0 {
+			now := time.Now()
+			timestamp = timestamp.AddDate(now.Year(), 0, 0)
+			//message of last year received at the beginning of new year
+			if timestamp.After(now.Add(24 * time.Hour)) {
+				timestamp = timestamp.AddDate(-1, 0, 0)
+			}
+		}
+		return timestamp, data[size:], nil
+	}
+	return time.Time{}, nil, ErrTimestamp
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
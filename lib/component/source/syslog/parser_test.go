@@ -0,0 +1,203 @@
+package syslog
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRFC5424(t *testing.T) {
+	timestamp := time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC)
+	tests := []struct {
+		line   string
+		fields map[string]any
+		err    error
+	}{
+		{
+			line: `<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed for lonvick on /dev/pts/8`,
+			fields: map[string]any{FieldFacility: 4, FieldSeverity: 2, FieldVersion: 1, FieldTimestamp: timestamp,
+				FieldHostname: "mymachine.example.com", FieldAppName: "su", FieldMsgId: "ID47",
+				FieldMessage: "'su root' failed for lonvick on /dev/pts/8"},
+		},
+		{
+			line: `<165>1 2003-10-11T22:14:15.003Z host evntslog 123 ID47 [exampleSDID@32473 iut="3" eventSource="Application"]` +
+				`[examplePriority@32473 class="high"] ` + "\xEF\xBB\xBF" + `An application event`,
+			fields: map[string]any{FieldFacility: 20, FieldSeverity: 5, FieldVersion: 1, FieldTimestamp: timestamp,
+				FieldHostname: "host", FieldAppName: "evntslog", FieldProcId: "123", FieldMsgId: "ID47",
+				FieldStructuredData: map[string]any{
+					"exampleSDID@32473":     map[string]any{"iut": "3", "eventSource": "Application"},
+					"examplePriority@32473": map[string]any{"class": "high"},
+				},
+				FieldMessage: "An application event"},
+		},
+		//nil values and no message
+		{
+			line:   `<0>1 - - - - - -`,
+			fields: map[string]any{FieldFacility: 0, FieldSeverity: 0, FieldVersion: 1, FieldMessage: ""},
+		},
+		{
+			line: `<13>1 2003-10-11T22:14:15.003Z host app - - [id@1]`,
+			fields: map[string]any{FieldFacility: 1, FieldSeverity: 5, FieldVersion: 1, FieldTimestamp: timestamp,
+				FieldHostname: "host", FieldAppName: "app", FieldStructuredData: map[string]any{"id@1": map[string]any{}},
+				FieldMessage: ""},
+		},
+		{line: `<13>1 2003-10-11 host app - - - msg`, err: ErrTimestamp},
+		{line: `<13>x 2003-10-11T22:14:15.003Z host app - - - msg`, err: ErrHeader},
+		{line: `<13>1 2003-10-11T22:14:15.003Z host`, err: ErrHeader},
+		{line: `<13>1 2003-10-11T22:14:15.003Z host app - - [id a="b"`, err: ErrStructuredData},
+		{line: `<13>1 2003-10-11T22:14:15.003Z host app - - x msg`, err: ErrStructuredData},
+		{line: `<192>1 - - - - - -`, err: ErrPriority},
+		{line: `13>1 - - - - - -`, err: ErrPriority},
+		{line: `<>1 - - - - - -`, err: ErrPriority},
+	}
+	for _, test := range tests {
+		m, err := parseRFC5424([]byte(test.line))
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Fatalf("line %s, expect %v, got %v", test.line, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("line %s, %v", test.line, err)
+		}
+		if !reflect.DeepEqual(m.fields, test.fields) {
+			t.Fatalf("line %s, expect %v, got %v", test.line, test.fields, m.fields)
+		}
+	}
+}
+
+func TestParseStructuredData(t *testing.T) {
+	tests := []struct {
+		data string
+		sd   map[string]any
+		rest string
+		err  bool
+	}{
+		{data: `- msg`, rest: " msg"},
+		{data: `[a b="1"] msg`, sd: map[string]any{"a": map[string]any{"b": "1"}}, rest: " msg"},
+		{data: `[a b="say \"hi\""]`, sd: map[string]any{"a": map[string]any{"b": `say "hi"`}}},
+		{data: `[a b="c:\\d"]`, sd: map[string]any{"a": map[string]any{"b": `c:\d`}}},
+		{data: `[a b="[x\]"]`, sd: map[string]any{"a": map[string]any{"b": `[x]`}}},
+		//other escapes are kept as is
+		{data: `[a b="\n"]`, sd: map[string]any{"a": map[string]any{"b": `\n`}}},
+		{data: `[a b="" c="] d"][e]`, sd: map[string]any{"a": map[string]any{"b": "", "c": "] d"}, "e": map[string]any{}}},
+		{data: ``, err: true},
+		{data: `[]`, err: true},
+		{data: `[a b=1]`, err: true},
+		{data: `[a b="1]`, err: true},
+		{data: `[a b="1"`, err: true},
+		{data: `[a ="1"]`, err: true},
+		{data: `x msg`, err: true},
+	}
+	for _, test := range tests {
+		sd, rest, err := parseStructuredData([]byte(test.data))
+		if test.err {
+			if !errors.Is(err, ErrStructuredData) {
+				t.Fatalf("data %s, expect %v, got %v", test.data, ErrStructuredData, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("data %s, %v", test.data, err)
+		}
+		if !reflect.DeepEqual(sd, test.sd) || string(rest) != test.rest {
+			t.Fatalf("data %s, expect %v %q, got %v %q", test.data, test.sd, test.rest, sd, rest)
+		}
+	}
+}
+
+func TestParseRFC3164(t *testing.T) {
+	tests := []struct {
+		line      string
+		fields    map[string]any
+		timestamp string
+		err       error
+	}{
+		{
+			line:      `<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`,
+			fields:    map[string]any{FieldFacility: 4, FieldSeverity: 2, FieldHostname: "mymachine", FieldAppName: "su", FieldMessage: "'su root' failed for lonvick on /dev/pts/8"},
+			timestamp: "Oct 11 22:14:15",
+		},
+		{
+			line:      `<13>Feb  5 17:32:18 10.0.0.99 sshd[4123]: Accepted publickey`,
+			fields:    map[string]any{FieldFacility: 1, FieldSeverity: 5, FieldHostname: "10.0.0.99", FieldAppName: "sshd", FieldProcId: "4123", FieldMessage: "Accepted publickey"},
+			timestamp: "Feb  5 17:32:18",
+		},
+		{
+			line:      `<13>Feb  5 17:32:18.123456 host kernel: [ 0.000000] Linux`,
+			fields:    map[string]any{FieldFacility: 1, FieldSeverity: 5, FieldHostname: "host", FieldAppName: "kernel", FieldMessage: "[ 0.000000] Linux"},
+			timestamp: "Feb  5 17:32:18.123456",
+		},
+		//no tag, the rest is message
+		{
+			line:      `<13>Feb  5 17:32:18 host no tag here`,
+			fields:    map[string]any{FieldFacility: 1, FieldSeverity: 5, FieldHostname: "host", FieldMessage: "no tag here"},
+			timestamp: "Feb  5 17:32:18",
+		},
+		{line: `<13>2003-10-11 host app: msg`, err: ErrTimestamp},
+		{line: `<13>Feb  5 17:32:18 `, err: ErrHeader},
+		{line: `Feb  5 17:32:18 host app: msg`, err: ErrPriority},
+	}
+	for _, test := range tests {
+		m, err := parseRFC3164([]byte(test.line))
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Fatalf("line %s, expect %v, got %v", test.line, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("line %s, %v", test.line, err)
+		}
+		timestamp := m.fields[FieldTimestamp]
+		delete(m.fields, FieldTimestamp)
+		if !reflect.DeepEqual(m.fields, test.fields) {
+			t.Fatalf("line %s, expect %v, got %v", test.line, test.fields, m.fields)
+		}
+		layout := time.Stamp
+		if len(test.timestamp) > len(layout) {
+			layout = time.StampMicro
+		}
+		//the year is the current or the last one
+		if timestamp != m.timestamp || m.timestamp.Format(layout) != test.timestamp ||
+			m.timestamp.After(time.Now().Add(24*time.Hour)) || m.timestamp.Year() < time.Now().Year()-1 {
+			t.Fatalf("line %s, expect timestamp %s, got %v", test.line, test.timestamp, m.timestamp)
+		}
+	}
+
+	m, err := parseRFC3164([]byte(`<13>2003-10-11T22:14:15.003Z host app: msg`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC); !m.timestamp.Equal(expect) {
+		t.Fatalf("expect timestamp %v, got %v", expect, m.timestamp)
+	}
+}
+
+func TestParseAuto(t *testing.T) {
+	tests := []struct {
+		line    string
+		version bool
+	}{
+		{line: `<13>1 2003-10-11T22:14:15.003Z host app - - - msg`, version: true},
+		{line: `<13>Oct 11 22:14:15 host app: msg`},
+		{line: `<13>1990-10-11T22:14:15.003Z host app: msg`},
+	}
+	for _, test := range tests {
+		m, err := parseAuto([]byte(test.line))
+		if err != nil {
+			t.Fatalf("line %s, %v", test.line, err)
+		}
+		if _, ok := m.fields[FieldVersion]; ok != test.version {
+			t.Fatalf("line %s, expect rfc5424 %v, got %v", test.line, test.version, ok)
+		}
+		if m.fields[FieldMessage] != "msg" {
+			t.Fatalf("line %s, expect message msg, got %v", test.line, m.fields[FieldMessage])
+		}
+	}
+	if _, err := newParser("rfc1234"); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("expect %v, got %v", ErrUnknownFormat, err)
+	}
+}
@@ -0,0 +1,306 @@
+package syslog
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"athena/lib/component"
+	"athena/lib/log"
+	"athena/lib/metrics"
+	"athena/lib/properties"
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	ProtocolUDP = "udp"
+	ProtocolTCP = "tcp"
+	ProtocolTLS = "tls"
+
+	FramingAuto         = "auto"
+	FramingOctetCounted = "octet-counted"
+	FramingNewline      = "newline"
+
+	MetaRemote     = "remote"
+	MetaProtocol   = "protocol"
+	MetaParseError = "parse_error"
+
+	//maxOctetCountDigits bound the length prefix, so peers can't make the reader buffer without limit
+	maxOctetCountDigits = 10
+)
+
+var (
+	ProtocolProperty       = properties.NewProperty[string]("protocol", "listen protocol, udp tcp or tls", ProtocolUDP)
+	AddressProperty        = properties.NewProperty[string]("address", "listen address", ":5514")
+	FormatProperty         = properties.NewProperty[string]("format", "syslog format, auto rfc3164 or rfc5424", FormatAuto)
+	FramingProperty        = properties.NewProperty[string]("framing", "tcp framing, auto octet-counted or newline", FramingAuto)
+	MaxMessageSizeProperty = properties.NewProperty[int]("max-message-size", "max bytes of one message", 64*1024)
+	KeepUnparsedProperty   = properties.NewProperty[bool]("keep-unparsed", "emit unparsed raw message with parse_error meta, drop it if false", true)
+	TLSCertProperty        = properties.NewProperty[string]("tls-cert", "tls cert file", "")
+	TLSKeyProperty         = properties.NewProperty[string]("tls-key", "tls key file", "")
+	CodecProperty          = codec.Property("lines")
+
+	ErrUnknownProtocol = fmt.Errorf("unknown syslog protocol")
+	ErrUnknownFraming  = fmt.Errorf("unknown syslog framing")
+	ErrFrameTooLarge   = fmt.Errorf("syslog frame too large")
+	ErrOctetCount      = fmt.Errorf("invalid syslog octet count")
+)
+
+type source struct {
+	ctx            athena.Context
+	logger         athena.Logger
+	metrics        *metrics.Metrics
+	emitNext       athena.EmitNext
+	protocol       string
+	address        string
+	framing        string
+	maxMessageSize int
+	keepUnparsed   bool
+	tlsConfig      *tls.Config
+	parse          parser
+	decoder        *codec.LineDecoder
+
+	conns sync.Map
+	wait  sync.WaitGroup
+}
+
+func (s *source) Open(ctx athena.Context) (err error) {
+	s.ctx = ctx
+	s.logger = log.Ctx(s.ctx)
+	s.metrics = metrics.Ctx(s.ctx)
+	s.protocol = ctx.Properties().GetString(ProtocolProperty)
+	s.address = ctx.Properties().GetString(AddressProperty)
+	s.maxMessageSize = ctx.Properties().GetInt(MaxMessageSizeProperty)
+	s.keepUnparsed = ctx.Properties().GetBool(KeepUnparsedProperty)
+	if s.parse, err = newParser(ctx.Properties().GetString(FormatProperty)); err != nil {
+		return err
+	}
+	if s.decoder, err = codec.NewLineDecoder(ctx.Properties(), CodecProperty); err != nil {
+		return err
+	}
+	s.framing = ctx.Properties().GetString(FramingProperty)
+	switch s.framing {
+	case FramingAuto, FramingOctetCounted, FramingNewline:
+	default:
+		return errors.WithMessage(ErrUnknownFraming, s.framing)
+	}
+	switch s.protocol {
+	case ProtocolUDP, ProtocolTCP:
+	case ProtocolTLS:
+		cert, err := tls.LoadX509KeyPair(ctx.Properties().GetString(TLSCertProperty), ctx.Properties().GetString(TLSKeyProperty))
+		if err != nil {
+			return errors.WithMessage(err, "can't load tls cert")
+		}
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	default:
+		return errors.WithMessage(ErrUnknownProtocol, s.protocol)
+	}
+	return nil
+}
+
+func (s *source) Close() error {
+	return nil
+}
+
+func (s *source) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{ProtocolProperty, AddressProperty, FormatProperty, FramingProperty,
+		MaxMessageSizeProperty, KeepUnparsedProperty, TLSCertProperty, TLSKeyProperty, CodecProperty}
+}
+
+func (s *source) Collect(emitNext athena.EmitNext) error {
+	s.emitNext = emitNext
+	if s.protocol == ProtocolUDP {
+		return s.collectUDP()
+	}
+	return s.collectTCP()
+}
+
+func (s *source) collectUDP() error {
+	conn, err := net.ListenPacket("udp", s.address)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("listen on udp %s", s.address)
+	go func() {
+		<-s.ctx.Done()
+		_ = conn.Close()
+	}()
+	buffer := make([]byte, s.maxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if s.ctx.Ctx().Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.emit(bytes.TrimRight(buffer[:n], "\r\n\x00"), addr.String())
+	}
+}
+
+func (s *source) collectTCP() error {
+	var (
+		listener net.Listener
+		err      error
+	)
+	if s.tlsConfig != nil {
+		listener, err = tls.Listen("tcp", s.address, s.tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", s.address)
+	}
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("listen on %s %s", s.protocol, s.address)
+	go func() {
+		<-s.ctx.Done()
+		_ = listener.Close()
+		s.conns.Range(func(conn, _ any) bool {
+			_ = conn.(net.Conn).Close()
+			return true
+		})
+	}()
+	defer s.wait.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.ctx.Ctx().Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.conns.Store(conn, struct{}{})
+		s.wait.Add(1)
+		go func() {
+			defer func() {
+				s.conns.Delete(conn)
+				_ = conn.Close()
+				s.wait.Done()
+			}()
+			s.serve(conn)
+		}()
+	}
+}
+
+func (s *source) serve(conn net.Conn) {
+	remote := conn.RemoteAddr().String()
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	for {
+		frame, err := s.readFrame(reader)
+		if len(frame) > 0 {
+			s.emit(frame, remote)
+		}
+		if err != nil {
+			if err != io.EOF && s.ctx.Ctx().Err() == nil {
+				s.logger.Warnw("read syslog frame error, close connection.", "remote", remote, "err", err)
+			}
+			return
+		}
+	}
+}
+
+//readFrame read one message, octet counted frame starts with message length
+func (s *source) readFrame(reader *bufio.Reader) ([]byte, error) {
+	framing := s.framing
+	if framing == FramingAuto {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if first[0] >= '1' && first[0] <= '9' {
+			framing = FramingOctetCounted
+		} else {
+			framing = FramingNewline
+		}
+	}
+	if framing == FramingOctetCounted {
+		size, err := readOctetCount(reader)
+		if err != nil {
+			return nil, err
+		}
+		if size > s.maxMessageSize {
+			return nil, ErrFrameTooLarge
+		}
+		frame := make([]byte, size)
+		if _, err = io.ReadFull(reader, frame); err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(frame, "\r\n"), nil
+	}
+	var frame []byte
+	for {
+		line, err := reader.ReadSlice('\n')
+		frame = append(frame, line...)
+		if len(frame) > s.maxMessageSize {
+			return nil, ErrFrameTooLarge
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return bytes.TrimRight(frame, "\r\n\x00"), err
+	}
+}
+
+//readOctetCount read the message length before the space
+func readOctetCount(reader *bufio.Reader) (int, error) {
+	size := 0
+	for digits := 0; ; digits++ {
+		c, err := reader.ReadByte()
+		if err == io.EOF && digits > 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c == ' ' && digits > 0 {
+			return size, nil
+		}
+		if c < '0' || c > '9' || digits == maxOctetCountDigits {
+			return 0, errors.WithMessagef(ErrOctetCount, "unexpected %q after %d digits", c, digits)
+		}
+		size = size*10 + int(c-'0')
+	}
+}
+
+func (s *source) emit(data []byte, remote string) {
+	if len(data) == 0 {
+		return
+	}
+	meta := map[string]any{MetaRemote: remote, MetaProtocol: s.protocol}
+	m, err := s.parse(data)
+	if err != nil {
+		if !s.keepUnparsed {
+			s.logger.Debugw("drop unparsed syslog.", "remote", remote, "err", err)
+			s.metrics.Drop.Inc()
+			return
+		}
+		meta[MetaParseError] = err.Error()
+		s.emitNext(&athena.Event{Meta: meta, Message: string(data), Time: time.Now()}, nil)
+		return
+	}
+	//codec decode the msg part, like json of structured logging
+	if message, ok := m.fields[FieldMessage].(string); ok {
+		if m.fields[FieldMessage], err = s.decoder.Decode(message); err != nil {
+			meta[codec.MetaDecodeError] = err.Error()
+		}
+	}
+	eventTime := m.timestamp
+	if eventTime.IsZero() {
+		eventTime = time.Now()
+	}
+	s.emitNext(&athena.Event{Meta: meta, Message: m.fields, Time: eventTime}, nil)
+}
+
+func New() athena.Source {
+	return &source{}
+}
+
+func init() {
+	component.RegisterNewSourceFunc("syslog", New)
+}
@@ -0,0 +1,53 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		framing string
+		data    string
+		frames  []string
+		err     error
+	}{
+		{framing: FramingNewline, data: "<13>a\n<13>b\r\n<13>c", frames: []string{"<13>a", "<13>b", "<13>c"}, err: io.EOF},
+		{framing: FramingOctetCounted, data: "5 <13>a7 <13>b c", frames: []string{"<13>a", "<13>b c"}, err: io.EOF},
+		{framing: FramingAuto, data: "5 <13>a<13>b\n6 <13>c\n", frames: []string{"<13>a", "<13>b", "<13>c"}, err: io.EOF},
+		{framing: FramingOctetCounted, data: "10 <13>a", err: io.ErrUnexpectedEOF},
+		{framing: FramingOctetCounted, data: "12", err: io.ErrUnexpectedEOF},
+		{framing: FramingOctetCounted, data: "5x<13>a", err: ErrOctetCount},
+		{framing: FramingOctetCounted, data: " <13>a", err: ErrOctetCount},
+		{framing: FramingOctetCounted, data: "65 <13>a", err: ErrFrameTooLarge},
+		//the length prefix is bounded, not read until space
+		{framing: FramingOctetCounted, data: strings.Repeat("1", 1<<20), err: ErrOctetCount},
+		{framing: FramingOctetCounted, data: "00000000005 <13>a", err: ErrOctetCount},
+		{framing: FramingNewline, data: strings.Repeat("x", 65) + "\n", err: ErrFrameTooLarge},
+	}
+	for _, test := range tests {
+		s := &source{framing: test.framing, maxMessageSize: 64}
+		reader := bufio.NewReaderSize(strings.NewReader(test.data), 16)
+		var frames []string
+		var err error
+		for {
+			var frame []byte
+			frame, err = s.readFrame(reader)
+			if len(frame) > 0 {
+				frames = append(frames, string(frame))
+			}
+			if err != nil {
+				break
+			}
+		}
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s %.20q, expect %v, got %v", test.framing, test.data, test.err, err)
+		}
+		if strings.Join(frames, "|") != strings.Join(test.frames, "|") {
+			t.Fatalf("%s %.20q, expect %q, got %q", test.framing, test.data, test.frames, frames)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package tail
+
+import "sync"
+
+//cursor commit the file offset once all lines before it are acked, acks may arrive out of order
+type cursor struct {
+	mutex sync.Mutex
+	//next is the sequence of the next emitted line, low is the lowest sequence not acked
+	next   uint64
+	low    uint64
+	ends   map[uint64]int64
+	acked  map[uint64]bool
+	offset int64
+}
+
+func newCursor(offset int64) *cursor {
+	return &cursor{ends: map[uint64]int64{}, acked: map[uint64]bool{}, offset: offset}
+}
+
+//track the line ending at end, return its ack handler
+func (c *cursor) track(end int64) func() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	sequence := c.next
+	c.next++
+	c.ends[sequence] = end
+	return func() {
+		c.ack(sequence)
+	}
+}
+
+func (c *cursor) ack(sequence uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.acked[sequence] = true
+	for c.acked[c.low] {
+		c.offset = c.ends[c.low]
+		delete(c.acked, c.low)
+		delete(c.ends, c.low)
+		c.low++
+	}
+}
+
+//committed return the offset of which all lines before are acked
+func (c *cursor) committed() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.offset
+}
+
+//pending return the lines emitted but not acked
+func (c *cursor) pending() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.ends)
+}
@@ -0,0 +1,296 @@
+package tail
+
+import (
+	"athena/athena"
+	"athena/lib/codec"
+	"athena/lib/component"
+	"athena/lib/component/source/void_walker"
+	_tail "athena/lib/component/source/void_walker/tail"
+	"athena/lib/log"
+	"athena/lib/multiline"
+	"athena/lib/properties"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	StartBeginning = "beginning"
+	StartEnd       = "end"
+
+	MetaPath   = "path"
+	MetaOffset = "offset"
+)
+
+var (
+	PathsProperty         = properties.NewRequiredProperty[[]string]("paths", "glob patterns of files to tail")
+	ScanIntervalProperty  = properties.NewProperty[time.Duration]("scan-interval", "interval of rediscovering files by patterns", 10*time.Second)
+	CloseInactiveProperty = properties.NewProperty[time.Duration]("close-inactive", "close file not read for this duration, reopen when it grows", 5*time.Minute)
+	StartPositionProperty = properties.NewProperty[string]("start-position", "position of files without offset found at start, beginning or end", StartBeginning)
+	CodecProperty         = codec.Property("lines")
+
+	ErrUnknownStartPosition = fmt.Errorf("unknown start position")
+	ErrFileChanged          = fmt.Errorf("file changed before open")
+)
+
+//file is the tail state of one file identified by device and inode
+type file struct {
+	path   string
+	cursor *cursor
+	tail   *_tail.Tail
+	//read is the offset after the last line emitted
+	read     int64
+	lastRead time.Time
+}
+
+type source struct {
+	ctx           athena.Context
+	logger        athena.Logger
+	emitNext      athena.EmitNext
+	patterns      []string
+	scanInterval  time.Duration
+	closeInactive time.Duration
+	startEnd      bool
+	decoder       *codec.LineDecoder
+
+	mutex sync.Mutex
+	files map[void_walker.FileIdentify]*file
+	wait  sync.WaitGroup
+}
+
+func (s *source) Open(ctx athena.Context) error {
+	s.ctx = ctx
+	s.logger = log.Ctx(s.ctx)
+	s.patterns = ctx.Properties().GetStringSlice(PathsProperty)
+	for _, pattern := range s.patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return errors.WithMessage(err, pattern)
+		}
+	}
+	s.scanInterval = ctx.Properties().GetDuration(ScanIntervalProperty)
+	s.closeInactive = ctx.Properties().GetDuration(CloseInactiveProperty)
+	switch position := ctx.Properties().GetString(StartPositionProperty); position {
+	case StartBeginning:
+	case StartEnd:
+		s.startEnd = true
+	default:
+		return errors.WithMessage(ErrUnknownStartPosition, position)
+	}
+	if _, err := multiline.New(ctx.Properties(), nil); err != nil {
+		return err
+	}
+	decoder, err := codec.NewLineDecoder(ctx.Properties(), CodecProperty)
+	if err != nil {
+		return err
+	}
+	s.decoder = decoder
+	if s.files == nil {
+		s.files = map[void_walker.FileIdentify]*file{}
+	}
+	return nil
+}
+
+func (s *source) Close() error {
+	return nil
+}
+
+func (s *source) PropertiesDef() athena.PropertiesDef {
+	return append(athena.PropertiesDef{PathsProperty, ScanIntervalProperty, CloseInactiveProperty, StartPositionProperty, CodecProperty},
+		multiline.PropertiesDef()...)
+}
+
+//Snapshot the acked offsets of files
+func (s *source) Snapshot() ([]byte, error) {
+	s.mutex.Lock()
+	offsets := make(map[void_walker.FileIdentify]int64, len(s.files))
+	for id, f := range s.files {
+		offsets[id] = f.cursor.committed()
+	}
+	s.mutex.Unlock()
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(&offsets); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (s *source) Restore(snapshot []byte) error {
+	offsets := map[void_walker.FileIdentify]int64{}
+	if err := gob.NewDecoder(bytes.NewReader(snapshot)).Decode(&offsets); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, offset := range offsets {
+		s.files[id] = &file{cursor: newCursor(offset), read: offset}
+	}
+	return nil
+}
+
+func (s *source) Collect(emitNext athena.EmitNext) error {
+	s.emitNext = emitNext
+	s.scan(true)
+	ticker := time.NewTicker(s.scanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			s.mutex.Lock()
+			for _, f := range s.files {
+				if f.tail != nil {
+					f.tail.Kill(nil)
+				}
+			}
+			s.mutex.Unlock()
+			s.wait.Wait()
+			return nil
+		case <-ticker.C:
+			s.scan(false)
+		}
+	}
+}
+
+//scan discover files by patterns, start tailing new or grown files and close inactive files
+func (s *source) scan(first bool) {
+	matched := map[void_walker.FileIdentify]string{}
+	infos := map[void_walker.FileIdentify]os.FileInfo{}
+	for _, pattern := range s.patterns {
+		paths, _ := filepath.Glob(pattern)
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			id := *void_walker.NewFileIdentifyConvert(info.Sys().(*syscall.Stat_t))
+			matched[id] = path
+			infos[id] = info
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, f := range s.files {
+		if f.tail != nil {
+			if s.closeInactive > 0 && time.Since(f.lastRead) > s.closeInactive {
+				s.logger.Infow("close inactive file.", "path", f.path)
+				f.tail.Kill(nil)
+			}
+			continue
+		}
+		//forget file disappeared from patterns, its lines are all acked or lost with the file
+		if _, ok := matched[id]; !ok && f.cursor.pending() == 0 {
+			delete(s.files, id)
+		}
+	}
+	for id, path := range matched {
+		info := infos[id]
+		f, ok := s.files[id]
+		if ok && f.tail != nil {
+			//renamed file is still tailed by the opened descriptor
+			f.path = path
+			continue
+		}
+		if !ok {
+			f = &file{cursor: newCursor(0)}
+			if first && s.startEnd {
+				f.cursor = newCursor(info.Size())
+				f.read = info.Size()
+			}
+			s.files[id] = f
+		}
+		f.path = path
+		if info.Size() < f.read {
+			s.logger.Infow("file truncated, tail from beginning.", "path", path, "offset", f.read, "size", info.Size())
+			f.cursor = newCursor(0)
+			f.read = 0
+		}
+		if ok && info.Size() == f.read && s.closeInactive > 0 && time.Since(info.ModTime()) > s.closeInactive {
+			continue
+		}
+		if err := s.tail(id, f); err != nil {
+			s.logger.Warnw("can't tail file.", "path", path, "err", err)
+		}
+	}
+}
+
+//tail open the file and emit its lines from the read offset, must be called with lock
+func (s *source) tail(id void_walker.FileIdentify, f *file) error {
+	joiner, err := multiline.New(s.ctx.Properties(), func(line *multiline.Line) {
+		s.mutex.Lock()
+		path, c := f.path, f.cursor
+		s.mutex.Unlock()
+		meta := map[string]any{MetaPath: path, MetaOffset: line.Offset}
+		message, err := s.decoder.Decode(line.Text)
+		if err != nil {
+			meta[codec.MetaDecodeError] = err.Error()
+		}
+		s.emitNext(&athena.Event{
+			Meta:    meta,
+			Message: message,
+			Time:    line.Time,
+		}, c.track(line.Offset))
+	})
+	if err != nil {
+		return err
+	}
+	osFile, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	device, inode, err := void_walker.GetInode(osFile)
+	if err != nil {
+		_ = osFile.Close()
+		return err
+	}
+	if device != id.Device || inode != id.Inode {
+		_ = osFile.Close()
+		return ErrFileChanged
+	}
+	s.logger.Infow("start tail file.", "path", f.path, "offset", f.read)
+	t := _tail.NewTail(f.path, osFile, _tail.Config{
+		Location: &_tail.SeekInfo{Offset: f.read, Whence: io.SeekStart},
+		Logger:   &log.TailLoggerWrapper{Logger: s.logger},
+	})
+	f.tail = t
+	f.lastRead = time.Now()
+	s.wait.Add(1)
+	go func() {
+		defer s.wait.Done()
+		for line := range t.Lines {
+			s.mutex.Lock()
+			f.read = line.Offset
+			f.lastRead = line.Time
+			s.mutex.Unlock()
+			joiner.Add(line.Text, line.Offset, line.Time)
+		}
+		joiner.Flush()
+		if err := t.Wait(); err != nil {
+			s.logger.Warnw("tail file stopped.", "path", f.path, "err", err)
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		f.tail = nil
+		//copytruncate, the offset is beyond the file size
+		if info, err := osFile.Stat(); err == nil && info.Size() < f.read {
+			s.logger.Infow("file truncated, tail from beginning.", "path", f.path)
+			f.cursor = newCursor(0)
+			f.read = 0
+		}
+		_ = osFile.Close()
+	}()
+	return nil
+}
+
+func New() athena.Source {
+	return &source{}
+}
+
+func init() {
+	component.RegisterNewSourceFunc("tail", New)
+}
@@ -0,0 +1,68 @@
+package tail
+
+import (
+	"athena/lib/component/source/void_walker"
+	"bytes"
+	"encoding/gob"
+	"sync"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	c := newCursor(10)
+	first, second, third := c.track(20), c.track(30), c.track(40)
+	//out of order acks are committed once lines before are acked
+	second()
+	third()
+	if c.committed() != 10 || c.pending() != 3 {
+		t.Fatalf("offset is committed before first line acked, offset %d", c.committed())
+	}
+	first()
+	if c.committed() != 40 || c.pending() != 0 {
+		t.Fatalf("expected offset 40, got %d", c.committed())
+	}
+}
+
+//checkpoint pauses emits while snapshotting, but lines are still acked concurrently
+func TestSnapshotWhileRunning(t *testing.T) {
+	id := void_walker.FileIdentify{Device: 1, Inode: 2}
+	s := &source{files: map[void_walker.FileIdentify]*file{id: {cursor: newCursor(0)}}}
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for i := int64(1); i <= 1000; i++ {
+			s.mutex.Lock()
+			c := s.files[id].cursor
+			s.mutex.Unlock()
+			c.track(i)()
+		}
+	}()
+	var last int64
+	for i := 0; i < 100; i++ {
+		snapshot, err := s.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets := map[void_walker.FileIdentify]int64{}
+		if err = gob.NewDecoder(bytes.NewReader(snapshot)).Decode(&offsets); err != nil {
+			t.Fatal(err)
+		}
+		if offsets[id] < last {
+			t.Fatalf("snapshot offset goes back from %d to %d", last, offsets[id])
+		}
+		last = offsets[id]
+	}
+	wait.Wait()
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &source{files: map[void_walker.FileIdentify]*file{}}
+	if err = restored.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if offset := restored.files[id].cursor.committed(); offset != 1000 {
+		t.Fatalf("expected restored offset 1000, got %d", offset)
+	}
+}
@@ -28,11 +28,13 @@ type Line struct {
 	Text string
 	Time time.Time
 	Err  error // Error from tail
+	// Offset is the file position after the line and its newline.
+	Offset int64
 }
 
 // NewLine returns a Line with present time.
 func NewLine(text string) *Line {
-	return &Line{text, time.Now(), nil}
+	return &Line{Text: text, Time: time.Now()}
 }
 
 // SeekInfo represents arguments to `os.Seek`
@@ -194,7 +196,9 @@ func (tail *Tail) tailFileSync() error {
 
 		// Process `line` even if err is EOF.
 		if err == nil {
-			tail.sendLine(line)
+			if !tail.sendLine(line, offset+int64(len(line))+1) {
+				return nil
+			}
 		} else if err == io.EOF {
 			if line != "" {
 				// this has the potential to never return the last line if
@@ -271,9 +275,13 @@ func (tail *Tail) seekTo(pos SeekInfo) error {
 	return nil
 }
 
-// sendLine sends the line(s) to Lines channel, splitting longer lines
-// if necessary. Return false if rate limit is reached.
-func (tail *Tail) sendLine(line string) {
-	now := time.Now()
-	tail.Lines <- &Line{line, now, nil}
+// sendLine sends the line to Lines channel. Return false if the tail
+// is stopped before the line is received.
+func (tail *Tail) sendLine(line string, offset int64) bool {
+	select {
+	case tail.Lines <- &Line{Text: line, Time: time.Now(), Offset: offset}:
+		return true
+	case <-tail.Dying():
+		return false
+	}
 }
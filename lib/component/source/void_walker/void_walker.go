@@ -2,8 +2,10 @@ package void_walker
 
 import (
 	"athena/athena"
+	"athena/lib/codec"
 	"athena/lib/component/source/void_walker/tail"
 	"athena/lib/log"
+	"athena/lib/multiline"
 	"athena/lib/properties"
 	"fmt"
 	"io"
@@ -15,6 +17,7 @@ import (
 var (
 	AccessLogProperty = properties.NewRequiredProperty[string]("access-log", "currentTail access log path")
 	VWFolderProperty  = properties.NewRequiredProperty[string]("vm-folder", "access log vm folder")
+	CodecProperty     = codec.Property("lines")
 )
 
 const tailPositionSuffix string = "tail_position"
@@ -42,6 +45,7 @@ type source struct {
 	currentFileWrapper *FileWrapper
 	currentTail        *tail.Tail
 	lastRowIdentify    *RowIdentify
+	decoder            *codec.LineDecoder
 }
 
 func (s *source) Open(ctx athena.Context) error {
@@ -50,6 +54,11 @@ func (s *source) Open(ctx athena.Context) error {
 	s.logger = log.Ctx(s.ctx)
 	s.accessLog = ctx.Properties().GetString(AccessLogProperty)
 	s.vwFolder = ctx.Properties().GetString(VWFolderProperty)
+	decoder, err := codec.NewLineDecoder(ctx.Properties(), CodecProperty)
+	if err != nil {
+		return err
+	}
+	s.decoder = decoder
 
 	s.lastRowIdentify = loadLastPositions(getTailPositionName(s.accessLog))
 	if s.lastRowIdentify == nil {
@@ -70,7 +79,7 @@ func (s *source) Open(ctx athena.Context) error {
 }
 
 func (s *source) PropertiesDef() athena.PropertiesDef {
-	return athena.PropertiesDef{AccessLogProperty, VWFolderProperty}
+	return append(athena.PropertiesDef{AccessLogProperty, VWFolderProperty, CodecProperty}, multiline.PropertiesDef()...)
 }
 
 func (s *source) Close() error {
@@ -104,13 +113,25 @@ func (s *source) Collect(emitNext athena.EmitNext) error {
 			},
 			Logger: &log.TailLoggerWrapper{Logger: s.logger},
 		})
-		for line := range s.currentTail.Lines {
+		joiner, err := multiline.New(s.ctx.Properties(), func(line *multiline.Line) {
+			meta := map[string]any{"fileWrapper": fileWrapper.Path, "offset": line.Offset}
+			message, err := s.decoder.Decode(line.Text)
+			if err != nil {
+				meta[codec.MetaDecodeError] = err.Error()
+			}
 			emitNext(&athena.Event{
-				Meta:    map[string]any{"fileWrapper": fileWrapper.Path},
-				Message: line.Text,
+				Meta:    meta,
+				Message: message,
 				Time:    line.Time,
 			}, nil)
+		})
+		if err != nil {
+			return err
+		}
+		for line := range s.currentTail.Lines {
+			joiner.Add(line.Text, line.Offset, line.Time)
 		}
+		joiner.Flush()
 	}
 
 }
@@ -0,0 +1,98 @@
+package deadletter
+
+import (
+	"athena/athena"
+	"athena/lib/log"
+	"athena/lib/properties"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	PathProperty = properties.NewProperty[string]("dead-letter", "file path of failed events as json lines, failed events are nacked if empty", "")
+
+	ErrNotString = fmt.Errorf("line is not string")
+)
+
+//record is one line of dead letter file
+type record struct {
+	Time    time.Time      `json:"time"`
+	Context string         `json:"context"`
+	Error   string         `json:"error"`
+	Meta    map[string]any `json:"meta"`
+	Message any            `json:"message"`
+}
+
+//Writer append failed events to the dead letter file
+type Writer struct {
+	name   string
+	logger athena.Logger
+	mutex  sync.Mutex
+	file   *os.File
+}
+
+//New open the dead letter file of the property, return nil writer if path is empty
+func New(ctx athena.Context) (*Writer, error) {
+	path := ctx.Properties().GetString(PathProperty)
+	if path == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{name: ctx.Name(), logger: log.Ctx(ctx), file: file}, nil
+}
+
+//Write the event with its error, the line is written by one write call without buffering
+func (w *Writer) Write(event *athena.Event, cause error) error {
+	line, err := json.Marshal(record{Time: time.Now(), Context: w.name, Error: cause.Error(), Meta: event.Meta, Message: event.Message})
+	if err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, err = w.file.Write(append(line, '\n'))
+	return err
+}
+
+//Fail write the failed event and ack it, the event is nacked if the writer is nil or can't write
+func (w *Writer) Fail(acker athena.ACKer, event *athena.Event, cause error) {
+	if w == nil {
+		acker.OnACK(event, false)
+		return
+	}
+	if err := w.Write(event, cause); err != nil {
+		w.logger.Errorw("can't write dead letter.", "err", err)
+		acker.OnACK(event, false)
+		return
+	}
+	acker.OnACK(event, true)
+}
+
+//Line return the string of string or bytes value, the event is failed with ErrNotString if it's neither
+func Line(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	return "", ErrNotString
+}
+
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.file.Close()
+}
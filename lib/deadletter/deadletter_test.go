@@ -0,0 +1,104 @@
+package deadletter
+
+import (
+	"athena/athena"
+	"athena/lib/context"
+	"athena/lib/log"
+	"athena/lib/properties"
+	_c "context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//newWriter open the dead letter of operator.op in dir
+func newWriter(t *testing.T, dir string) *Writer {
+	log.Setup(log.DefaultOptions())
+	file := filepath.Join(dir, "athena.toml")
+	config := "[operator.op]\ndead-letter = '" + filepath.Join(dir, "dead", "op.json") + "'\n"
+	if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := properties.New(file, properties.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.New(_c.Background(), p).Named("operator.op")
+	if _, err = properties.InitAndRender(ctx.Properties(), athena.PropertiesDef{PathProperty}); err != nil {
+		t.Fatal(err)
+	}
+	w, err := New(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+//newEvent return the event and whether it is acked and nacked
+func newEvent(message any) (*athena.Event, *bool, *bool) {
+	done, nacked := false, false
+	return &athena.Event{Meta: map[string]any{"name": "a"}, Message: message, Private: map[string]any{
+		athena.PrivateNACKHandler: athena.ACKHandler(func() { nacked = true }),
+		athena.PrivateACKHandler:  athena.ACKHandler(func() { done = true }),
+	}}, &done, &nacked
+}
+
+func TestFail(t *testing.T) {
+	acker := athena.NewACKer(context.New(_c.Background(), nil))
+	//failed events are nacked without dead letter
+	var nilWriter *Writer
+	event, done, nacked := newEvent("x")
+	nilWriter.Fail(acker, event, ErrNotString)
+	if !*done || !*nacked {
+		t.Fatalf("event is not nacked without dead letter, done %v nacked %v", *done, *nacked)
+	}
+
+	dir := t.TempDir()
+	w := newWriter(t, dir)
+	event, done, nacked = newEvent("x")
+	w.Fail(acker, event, ErrNotString)
+	if !*done || *nacked {
+		t.Fatalf("event written to dead letter is not acked, done %v nacked %v", *done, *nacked)
+	}
+	//events can't be written are nacked
+	event, done, nacked = newEvent(make(chan int))
+	w.Fail(acker, event, ErrNotString)
+	if !*done || !*nacked {
+		t.Fatalf("event not written is not nacked, done %v nacked %v", *done, *nacked)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "dead", "op.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var r record
+	if len(lines) != 1 || json.Unmarshal([]byte(lines[0]), &r) != nil ||
+		r.Context != "operator.op" || r.Error != ErrNotString.Error() || r.Message != "x" || r.Meta["name"] != "a" {
+		t.Fatalf("unexpected dead letter %q", lines)
+	}
+}
+
+func TestLine(t *testing.T) {
+	tests := []struct {
+		value any
+		line  string
+		err   error
+	}{
+		{value: "a", line: "a"},
+		{value: []byte("b"), line: "b"},
+		{value: 1, err: ErrNotString},
+		{value: nil, err: ErrNotString},
+	}
+	for _, test := range tests {
+		line, err := Line(test.value)
+		if !errors.Is(err, test.err) || line != test.line {
+			t.Fatalf("value %v, expect %q %v, got %q %v", test.value, test.line, test.err, line, err)
+		}
+	}
+}
@@ -60,7 +60,13 @@ func init() {
 								handler()
 							}
 						}
-						event.Private = map[string]any{athena.PrivateACKHandler: newHandler}
+						//copy private, keep the other private values like trace
+						private := make(map[string]any, len(event.Private)+1)
+						for key, value := range event.Private {
+							private[key] = value
+						}
+						private[athena.PrivateACKHandler] = newHandler
+						event.Private = private
 					}
 					for _, emit := range emitNextSlice {
 						emit(event)
@@ -2,16 +2,32 @@ package lib
 
 import (
 	//source
+	_ "athena/lib/component/source/http"
 	_ "athena/lib/component/source/kafka"
 	_ "athena/lib/component/source/mock"
 	_ "athena/lib/component/source/spooldir"
+	_ "athena/lib/component/source/syslog"
+	_ "athena/lib/component/source/tail"
 
 	//operator
+	_ "athena/lib/component/operator/dedup"
+	_ "athena/lib/component/operator/grok"
+	_ "athena/lib/component/operator/mutate"
+	_ "athena/lib/component/operator/parse"
 	_ "athena/lib/component/operator/sample"
 	_ "athena/lib/component/operator/tengo"
 	//sink
 	_ "athena/lib/component/sink/echo"
+	_ "athena/lib/component/sink/file"
+	_ "athena/lib/component/sink/http"
 
 	//emit
 	_ "athena/lib/emit/replicating"
+
+	//codec
+	_ "athena/lib/codec/csv"
+	_ "athena/lib/codec/json"
+	_ "athena/lib/codec/lines"
+	_ "athena/lib/codec/logfmt"
+	_ "athena/lib/codec/msgpack"
 )
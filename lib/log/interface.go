@@ -17,6 +17,15 @@ const (
 	PanicLevel = Level(zapcore.PanicLevel)
 )
 
+//ParseLevel parse level text, the optional value is debug info warn error fatal panic
+func ParseLevel(text string) (Level, error) {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(text)); err != nil {
+		return InfoLevel, err
+	}
+	return Level(l), nil
+}
+
 type OutputEncoder func(cfg zapcore.EncoderConfig) zapcore.Encoder
 
 var (
@@ -4,19 +4,54 @@ import (
 	"athena/athena"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
 	one   *logger
 	mutex sync.Mutex
+	level = zap.NewAtomicLevel()
+	//base is the logger without level filter, named loggers apply their own level
+	base        *zap.Logger
+	namedLevels map[string]Level
+	rotateStop  chan struct{}
 )
 
 type logger struct {
 	*zap.SugaredLogger
 }
 
+//levelCore filter entries by its own level instead of the wrapped core
+type levelCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return c.level.Enabled(lvl)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
+
+func withLevel(l zapcore.LevelEnabler) zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: core, level: l}
+	})
+}
+
 func Setup(options *Options) {
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -29,14 +64,36 @@ func Setup(options *Options) {
 		encoderConfig = zap.NewProductionEncoderConfig()
 	)
 
-	infoWriteSyncers = append(infoWriteSyncers, zapcore.AddSync(os.Stdout))
-	errWriteSyncers = append(errWriteSyncers, zapcore.AddSync(os.Stderr))
+	if rotateStop != nil {
+		close(rotateStop)
+		rotateStop = nil
+	}
+	if options.file != nil {
+		fileWriter := &lumberjack.Logger{
+			Filename:   options.file.Filename,
+			MaxSize:    options.file.MaxSize,
+			MaxAge:     options.file.MaxAge,
+			MaxBackups: options.file.MaxBackups,
+			Compress:   options.file.Compress,
+		}
+		if options.file.RotateInterval > 0 {
+			rotateStop = make(chan struct{})
+			go rotate(fileWriter, options.file.RotateInterval, rotateStop)
+		}
+		infoWriteSyncers = append(infoWriteSyncers, zapcore.AddSync(fileWriter))
+		errWriteSyncers = append(errWriteSyncers, zapcore.AddSync(fileWriter))
+	} else {
+		infoWriteSyncers = append(infoWriteSyncers, zapcore.AddSync(os.Stdout))
+		errWriteSyncers = append(errWriteSyncers, zapcore.AddSync(os.Stderr))
+	}
 
 	if options.callerEncoder != nil {
 		opts = append(opts, zap.AddCaller())
 		encoderConfig.EncodeCaller = zapcore.CallerEncoder(options.callerEncoder)
 	}
 
+	level.SetLevel(zapcore.Level(options.level))
+	namedLevels = options.namedLevels
 	encoderConfig.EncodeLevel = zapcore.LevelEncoder(options.levelEncoder)
 	encoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout(options.timeLayout)
 	//fix #15
@@ -45,33 +102,77 @@ func Setup(options *Options) {
 		options.outPutEncoder(encoderConfig),
 		zapcore.NewMultiWriteSyncer(infoWriteSyncers...),
 		zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-			return lvl >= zapcore.Level(options.level) && lvl < zapcore.WarnLevel
+			return lvl < zapcore.WarnLevel
 		}),
 	), zapcore.NewCore(
 		options.outPutEncoder(encoderConfig),
 		zapcore.NewMultiWriteSyncer(errWriteSyncers...),
 		zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-			return lvl >= zapcore.Level(options.level) && lvl >= zapcore.WarnLevel
+			return lvl >= zapcore.WarnLevel
 		}),
 	)}
 
 	if options.stacktrace {
 		opts = append(opts, zap.AddStacktrace(zapcore.WarnLevel))
 	}
-	zapSugarLogger := zap.New(zapcore.NewTee(cores...), opts...).Sugar()
+	base = zap.New(zapcore.NewTee(cores...), opts...)
 	if options.name != "" {
-		zapSugarLogger = zapSugarLogger.Named(options.name)
+		base = base.Named(options.name)
+	}
+
+	one = &logger{base.WithOptions(withLevel(level)).Sugar()}
+}
 
+func rotate(fileWriter *lumberjack.Logger, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_ = fileWriter.Rotate()
+		}
 	}
+}
 
-	one = &logger{zapSugarLogger}
+//namedLevel return the level override of the name or its closest parent name
+func namedLevel(name string) (Level, bool) {
+	for n := name; n != ""; {
+		if l, ok := namedLevels[n]; ok {
+			return l, true
+		}
+		index := strings.LastIndex(n, ".")
+		if index < 0 {
+			break
+		}
+		n = n[:index]
+	}
+	return InfoLevel, false
 }
 
 func Ctx(ctx athena.Context) athena.Logger {
-	return one.SugaredLogger.Named(ctx.Name())
+	return Named(ctx.Name())
 }
 
 func Named(name string) athena.Logger {
+	if l, ok := namedLevel(name); ok {
+		return &logger{base.WithOptions(withLevel(zapcore.Level(l))).Sugar().Named(name)}
+	}
 	named := one.SugaredLogger.Named(name)
 	return &logger{named}
 }
+
+//SetLevel change log level at runtime, the optional value is debug info warn error
+func SetLevel(text string) error {
+	l, err := ParseLevel(text)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(zapcore.Level(l))
+	return nil
+}
+
+func GetLevel() string {
+	return level.String()
+}
@@ -1,5 +1,24 @@
 package log
 
+import (
+	"time"
+)
+
+//FileOptions is the log file rotation options
+type FileOptions struct {
+	Filename string
+	//MaxSize is the maximum size in megabytes of the log file before it gets rotated
+	MaxSize int
+	//MaxAge is the maximum number of days to retain old log files
+	MaxAge int
+	//MaxBackups is the maximum number of old log files to retain, retain all if zero
+	MaxBackups int
+	//RotateInterval rotate the log file periodically, disabled if zero
+	RotateInterval time.Duration
+	//Compress the rotated log files using gzip
+	Compress bool
+}
+
 type Options struct {
 	//-------------------
 	//Is it displayed in standard output and standard error
@@ -18,6 +37,10 @@ type Options struct {
 	timeLayout string
 	//init the named
 	name string
+	//Output to the rotated file instead of standard output and standard error
+	file *FileOptions
+	//Named logger level overrides, keyed by logger name like operator.aggregate
+	namedLevels map[string]Level
 }
 
 func (o *Options) WithStacktrace(stacktrace bool) *Options {
@@ -55,6 +78,19 @@ func (o *Options) WithNamed(name string) *Options {
 	return o
 }
 
+func (o *Options) WithFile(file *FileOptions) *Options {
+	o.file = file
+	return o
+}
+
+func (o *Options) WithNamedLevel(name string, level Level) *Options {
+	if o.namedLevels == nil {
+		o.namedLevels = map[string]Level{}
+	}
+	o.namedLevels[name] = level
+	return o
+}
+
 func DefaultOptions() *Options {
 	return &Options{level: InfoLevel,
 		timeLayout:    "02/Jan/2006:15:04:05 +0800",
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"athena/athena"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	namespace    = "athena"
+	contextLabel = "context"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	eventsIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "events_in_total", Help: "events received by component.",
+	}, []string{contextLabel})
+	eventsOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "events_out_total", Help: "events emitted by component.",
+	}, []string{contextLabel})
+	acks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "acks_total", Help: "events acked by component.",
+	}, []string{contextLabel})
+	nacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "nacks_total", Help: "events nacked by component.",
+	}, []string{contextLabel})
+	drops = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "drops_total", Help: "events dropped by component without ack.",
+	}, []string{contextLabel})
+	latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "process_duration_seconds", Help: "time spent by component processing one event.",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+	}, []string{contextLabel})
+	bufferDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Name: "buffer_depth", Help: "events buffered by component.",
+	}, []string{contextLabel})
+	kafkaLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Name: "kafka_consumer_lag", Help: "kafka consumer lag per partition.",
+	}, []string{contextLabel, "topic", "partition"})
+
+	all sync.Map
+)
+
+//Metrics is the collectors of one component, labelled by context name
+type Metrics struct {
+	name        string
+	In          prometheus.Counter
+	Out         prometheus.Counter
+	ACK         prometheus.Counter
+	NACK        prometheus.Counter
+	Drop        prometheus.Counter
+	Latency     prometheus.Observer
+	BufferDepth prometheus.Gauge
+}
+
+//KafkaLag return consumer lag gauge of topic partition
+func (m *Metrics) KafkaLag(topic string, partition int32) prometheus.Gauge {
+	return kafkaLag.WithLabelValues(m.name, topic, strconv.FormatInt(int64(partition), 10))
+}
+
+//Ctx return the component metrics of ctx
+func Ctx(ctx athena.Context) *Metrics {
+	return Named(ctx.Name())
+}
+
+func Named(name string) *Metrics {
+	if m, ok := all.Load(name); ok {
+		return m.(*Metrics)
+	}
+	m, _ := all.LoadOrStore(name, &Metrics{
+		name:        name,
+		In:          eventsIn.WithLabelValues(name),
+		Out:         eventsOut.WithLabelValues(name),
+		ACK:         acks.WithLabelValues(name),
+		NACK:        nacks.WithLabelValues(name),
+		Drop:        drops.WithLabelValues(name),
+		Latency:     latency.WithLabelValues(name),
+		BufferDepth: bufferDepth.WithLabelValues(name),
+	})
+	return m.(*Metrics)
+}
+
+//ACKObserver count acks and nacks of the component
+func ACKObserver(ctx athena.Context) athena.ACKObserver {
+	m := Ctx(ctx)
+	return func(_ *athena.Event, ok bool) {
+		if ok {
+			m.ACK.Inc()
+		} else {
+			m.NACK.Inc()
+		}
+	}
+}
+
+//WrapEmitGenerator count events in and processing latency of the component
+func WrapEmitGenerator(ctx athena.Context, generator athena.EmitGenerator) athena.EmitGenerator {
+	m := Ctx(ctx)
+	return func(upstreamCtx athena.Context) athena.Emit {
+		emit := generator(upstreamCtx)
+		return func(event *athena.Event) {
+			start := time.Now()
+			m.In.Inc()
+			emit(event)
+			m.Latency.Observe(time.Since(start).Seconds())
+		}
+	}
+}
+
+//WrapEmitNext count events out of the component
+func WrapEmitNext(ctx athena.Context, emitNext athena.EmitNext) athena.EmitNext {
+	m := Ctx(ctx)
+	return func(event *athena.Event, handler athena.ACKHandler) {
+		m.Out.Inc()
+		emitNext(event, handler)
+	}
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+func init() {
+	registry.MustRegister(eventsIn, eventsOut, acks, nacks, drops, latency, bufferDepth, kafkaLag,
+		collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
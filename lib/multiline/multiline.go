@@ -0,0 +1,177 @@
+package multiline
+
+import (
+	"athena/athena"
+	"athena/lib/properties"
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ModeNone     = "none"
+	ModeStart    = "start"
+	ModeContinue = "continue"
+	ModeEnd      = "end"
+)
+
+var (
+	ModeProperty     = properties.NewProperty[string]("multiline-mode", "join lines by pattern, none start(pattern starts event) continue(pattern continues previous line) or end(pattern ends event)", ModeNone)
+	PatternProperty  = properties.NewProperty[string]("multiline-pattern", "multiline regex pattern", "")
+	NegateProperty   = properties.NewProperty[bool]("multiline-negate", "match lines not matching the pattern", false)
+	MaxLinesProperty = properties.NewProperty[int]("multiline-max-lines", "flush event when lines reach", 500)
+	MaxBytesProperty = properties.NewProperty[int]("multiline-max-bytes", "flush event when bytes reach", 1<<20)
+	TimeoutProperty  = properties.NewProperty[time.Duration]("multiline-timeout", "flush event when no line is joined for the duration", time.Second)
+
+	ErrUnknownMode     = fmt.Errorf("unknown multiline mode")
+	ErrPatternRequired = fmt.Errorf("multiline pattern is required")
+)
+
+//PropertiesDef is appended to the properties def of line oriented sources
+func PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{ModeProperty, PatternProperty, NegateProperty, MaxLinesProperty, MaxBytesProperty, TimeoutProperty}
+}
+
+//Line is a line or joined lines, offset is the end of the last line
+type Line struct {
+	Text   string
+	Offset int64
+	Time   time.Time
+}
+
+type Emit func(line *Line)
+
+//Joiner join lines to events by the multiline rules, all lines are emitted as is if mode is none
+type Joiner struct {
+	mode     string
+	pattern  *regexp.Regexp
+	negate   bool
+	maxLines int
+	maxBytes int
+	timeout  time.Duration
+	emit     Emit
+
+	mutex   sync.Mutex
+	lines   []string
+	bytes   int
+	offset  int64
+	time    time.Time
+	timer   *time.Timer
+	version uint64
+}
+
+func New(p athena.Properties, emit Emit) (*Joiner, error) {
+	j := &Joiner{
+		mode:     p.GetString(ModeProperty),
+		negate:   p.GetBool(NegateProperty),
+		maxLines: p.GetInt(MaxLinesProperty),
+		maxBytes: p.GetInt(MaxBytesProperty),
+		timeout:  p.GetDuration(TimeoutProperty),
+		emit:     emit,
+	}
+	switch j.mode {
+	case ModeNone:
+		return j, nil
+	case ModeStart, ModeContinue, ModeEnd:
+	default:
+		return nil, errors.WithMessage(ErrUnknownMode, j.mode)
+	}
+	pattern := p.GetString(PatternProperty)
+	if pattern == "" {
+		return nil, ErrPatternRequired
+	}
+	var err error
+	if j.pattern, err = regexp.Compile(pattern); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Joiner) match(text string) bool {
+	return j.pattern.MatchString(text) != j.negate
+}
+
+//Add the line ending at offset, emit the joined event if it is completed
+func (j *Joiner) Add(text string, offset int64, t time.Time) {
+	if j.mode == ModeNone {
+		j.emit(&Line{Text: text, Offset: offset, Time: t})
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	switch j.mode {
+	case ModeStart:
+		if j.match(text) {
+			j.flush()
+		}
+		j.append(text, offset, t)
+	case ModeContinue:
+		if !j.match(text) {
+			j.flush()
+		}
+		j.append(text, offset, t)
+	case ModeEnd:
+		j.append(text, offset, t)
+		if j.match(text) {
+			j.flush()
+		}
+	}
+	if len(j.lines) > 0 && ((j.maxLines > 0 && len(j.lines) >= j.maxLines) || (j.maxBytes > 0 && j.bytes >= j.maxBytes)) {
+		j.flush()
+	}
+	if len(j.lines) > 0 && j.timeout > 0 {
+		j.schedule()
+	}
+}
+
+func (j *Joiner) append(text string, offset int64, t time.Time) {
+	if len(j.lines) == 0 {
+		j.time = t
+	}
+	j.lines = append(j.lines, text)
+	j.bytes += len(text)
+	j.offset = offset
+}
+
+//schedule flush after timeout, version discards timers of flushed events
+func (j *Joiner) schedule() {
+	j.version++
+	version := j.version
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	j.timer = time.AfterFunc(j.timeout, func() {
+		j.mutex.Lock()
+		defer j.mutex.Unlock()
+		if j.version == version {
+			j.flush()
+		}
+	})
+}
+
+func (j *Joiner) flush() {
+	if len(j.lines) == 0 {
+		return
+	}
+	line := &Line{Text: strings.Join(j.lines, "\n"), Offset: j.offset, Time: j.time}
+	j.lines = nil
+	j.bytes = 0
+	j.version++
+	j.emit(line)
+}
+
+//Flush emit the pending lines as an event
+func (j *Joiner) Flush() {
+	if j.mode == ModeNone {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	j.flush()
+}
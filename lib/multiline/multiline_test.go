@@ -0,0 +1,191 @@
+package multiline
+
+import (
+	"athena/athena"
+	"athena/lib/properties"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+//newProperties return the properties of source config like multiline-mode = "start"
+func newProperties(t *testing.T, config string) athena.Properties {
+	file := filepath.Join(t.TempDir(), "athena.toml")
+	if err := os.WriteFile(file, []byte("[source]\n"+config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := properties.New(file, properties.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := p.Sub("source")
+	if _, err = properties.InitAndRender(ps, PropertiesDef()); err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
+
+//collector collect the emitted lines, timers emit in other goroutines
+type collector struct {
+	mutex sync.Mutex
+	lines []Line
+}
+
+func (c *collector) emit(line *Line) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lines = append(c.lines, *line)
+}
+
+func (c *collector) get() []Line {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]Line(nil), c.lines...)
+}
+
+//add the lines with offset of the line end, as if lines are read from a file
+func add(j *Joiner, texts []string) {
+	var offset int64
+	for i, text := range texts {
+		offset += int64(len(text)) + 1
+		j.Add(text, offset, time.Unix(int64(i), 0))
+	}
+}
+
+func TestJoin(t *testing.T) {
+	stack := []string{"2024-01-01 error", "  at a", "  at b", "2024-01-01 info", "2024-01-01 warn", "  at c"}
+	tests := []struct {
+		config string
+		texts  []string
+		lines  []Line
+	}{
+		{
+			config: `multiline-mode = "none"`,
+			texts:  []string{"a", "  b"},
+			lines:  []Line{{Text: "a", Offset: 2, Time: time.Unix(0, 0)}, {Text: "  b", Offset: 6, Time: time.Unix(1, 0)}},
+		},
+		{
+			config: `multiline-mode = "start"
+multiline-pattern = "^\\d{4}-"`,
+			texts: stack,
+			lines: []Line{
+				{Text: "2024-01-01 error\n  at a\n  at b", Offset: 31, Time: time.Unix(0, 0)},
+				{Text: "2024-01-01 info", Offset: 47, Time: time.Unix(3, 0)},
+				{Text: "2024-01-01 warn\n  at c", Offset: 70, Time: time.Unix(4, 0)},
+			},
+		},
+		{
+			config: `multiline-mode = "start"
+multiline-pattern = "^\\s"
+multiline-negate = true`,
+			texts: stack,
+			lines: []Line{
+				{Text: "2024-01-01 error\n  at a\n  at b", Offset: 31, Time: time.Unix(0, 0)},
+				{Text: "2024-01-01 info", Offset: 47, Time: time.Unix(3, 0)},
+				{Text: "2024-01-01 warn\n  at c", Offset: 70, Time: time.Unix(4, 0)},
+			},
+		},
+		{
+			config: `multiline-mode = "continue"
+multiline-pattern = "^\\s"`,
+			texts: stack,
+			lines: []Line{
+				{Text: "2024-01-01 error\n  at a\n  at b", Offset: 31, Time: time.Unix(0, 0)},
+				{Text: "2024-01-01 info", Offset: 47, Time: time.Unix(3, 0)},
+				{Text: "2024-01-01 warn\n  at c", Offset: 70, Time: time.Unix(4, 0)},
+			},
+		},
+		{
+			config: `multiline-mode = "end"
+multiline-pattern = ";$"`,
+			texts: []string{"select *", "from t;", "select 1;", "update t"},
+			lines: []Line{
+				{Text: "select *\nfrom t;", Offset: 17, Time: time.Unix(0, 0)},
+				{Text: "select 1;", Offset: 27, Time: time.Unix(2, 0)},
+				{Text: "update t", Offset: 36, Time: time.Unix(3, 0)},
+			},
+		},
+		{
+			config: `multiline-mode = "continue"
+multiline-pattern = "^\\s"
+multiline-max-lines = 2`,
+			texts: stack,
+			lines: []Line{
+				{Text: "2024-01-01 error\n  at a", Offset: 24, Time: time.Unix(0, 0)},
+				{Text: "  at b", Offset: 31, Time: time.Unix(2, 0)},
+				{Text: "2024-01-01 info", Offset: 47, Time: time.Unix(3, 0)},
+				{Text: "2024-01-01 warn\n  at c", Offset: 70, Time: time.Unix(4, 0)},
+			},
+		},
+		{
+			config: `multiline-mode = "start"
+multiline-pattern = "^\\d{4}-"
+multiline-max-bytes = 20`,
+			texts: stack,
+			lines: []Line{
+				{Text: "2024-01-01 error\n  at a", Offset: 24, Time: time.Unix(0, 0)},
+				{Text: "  at b", Offset: 31, Time: time.Unix(2, 0)},
+				{Text: "2024-01-01 info", Offset: 47, Time: time.Unix(3, 0)},
+				{Text: "2024-01-01 warn\n  at c", Offset: 70, Time: time.Unix(4, 0)},
+			},
+		},
+	}
+	for _, test := range tests {
+		c := &collector{}
+		j, err := New(newProperties(t, test.config+"\nmultiline-timeout = \"0s\""), c.emit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		add(j, test.texts)
+		j.Flush()
+		if lines := c.get(); !reflect.DeepEqual(lines, test.lines) {
+			t.Fatalf("config %s, expect %v, got %v", test.config, test.lines, lines)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	c := &collector{}
+	j, err := New(newProperties(t, `multiline-mode = "start"
+multiline-pattern = "^\\d{4}-"
+multiline-timeout = "20ms"`), c.emit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(j, []string{"2024-01-01 error", "  at a"})
+	if lines := c.get(); len(lines) != 0 {
+		t.Fatalf("pending lines are emitted before timeout, %v", lines)
+	}
+	time.Sleep(200 * time.Millisecond)
+	expect := []Line{{Text: "2024-01-01 error\n  at a", Offset: 24, Time: time.Unix(0, 0)}}
+	if lines := c.get(); !reflect.DeepEqual(lines, expect) {
+		t.Fatalf("expect %v, got %v", expect, lines)
+	}
+	//nothing is pending after the timeout flush
+	j.Flush()
+	if lines := c.get(); len(lines) != 1 {
+		t.Fatalf("flushed lines are emitted again, %v", lines)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		config string
+		err    error
+	}{
+		{config: `multiline-mode = "middle"`, err: ErrUnknownMode},
+		{config: `multiline-mode = "start"`, err: ErrPatternRequired},
+	}
+	for _, test := range tests {
+		if _, err := New(newProperties(t, test.config), nil); !errors.Is(err, test.err) {
+			t.Fatalf("config %s, expect %v, got %v", test.config, test.err, err)
+		}
+	}
+	if _, err := New(newProperties(t, "multiline-mode = \"end\"\nmultiline-pattern = \"(\""), nil); err == nil {
+		t.Fatalf("illegal pattern is accepted")
+	}
+}
@@ -7,13 +7,21 @@ import (
 	"github.com/olekukonko/tablewriter"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
 )
 
+const profilePrefix = "profile"
+
 var (
-	ErrPropertyNoSet = fmt.Errorf("property is requied,but not set")
-	ErrPropertyIsNil = fmt.Errorf("property and proerty default is nil")
+	ErrPropertyNoSet   = fmt.Errorf("property is requied,but not set")
+	ErrPropertyIsNil   = fmt.Errorf("property and proerty default is nil")
+	ErrUnknownFormat   = fmt.Errorf("can't detect config format by extension, specify it explicitly")
+	ErrProfileNotFound = fmt.Errorf("profile not found")
+	ErrIllegalOverride = fmt.Errorf("illegal override, expect key=value")
 )
 
 type properties struct {
@@ -58,6 +66,18 @@ func (p *properties) GetDuration(property athena.Property) time.Duration {
 	return p.Viper.GetDuration(property.Name())
 }
 
+func (p *properties) GetBool(property athena.Property) bool {
+	return p.Viper.GetBool(property.Name())
+}
+
+func (p *properties) GetFloat64(property athena.Property) float64 {
+	return p.Viper.GetFloat64(property.Name())
+}
+
+func (p *properties) GetStringMap(property athena.Property) map[string]any {
+	return p.Viper.GetStringMap(property.Name())
+}
+
 func InitAndRender(p athena.Properties, def athena.PropertiesDef) (string, error) {
 	switch _p := p.(type) {
 	case *properties:
@@ -111,15 +131,101 @@ func RenderDef(p athena.PropertiesDef) string {
 	return buffer.String()
 }
 
-func New(propertiesName string, propertiesType string, propertiesPath ...string) athena.Properties {
+//Options is the config loading options
+type Options struct {
+	//Format is config format like toml yaml json, detected by file extension if empty
+	Format string
+	//Profile merge [profile.x] overlay into config if not empty
+	Profile string
+	//Overrides is dotted key=value like sink.echo.batch=10, value [a,b] is a list
+	Overrides []string
+}
+
+func New(configFile string, options Options) (athena.Properties, error) {
 	v := viper.New()
-	v.SetConfigName(propertiesName)
-	v.SetConfigType(propertiesType)
-	for _, p := range propertiesPath {
-		v.AddConfigPath(p)
+	format := options.Format
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(configFile), ".")
+	}
+	if format == "" {
+		return nil, errors.WithMessage(ErrUnknownFormat, configFile)
 	}
+	v.SetConfigFile(configFile)
+	v.SetConfigType(format)
 	if err := v.ReadInConfig(); err != nil {
-		panic(fmt.Sprintf("read config error:%s", err.Error()))
+		return nil, errors.WithMessage(err, "read config error")
+	}
+	if options.Profile != "" {
+		key := profilePrefix + "." + options.Profile
+		if !v.IsSet(key) {
+			return nil, errors.WithMessage(ErrProfileNotFound, options.Profile)
+		}
+		if err := v.MergeConfigMap(v.GetStringMap(key)); err != nil {
+			return nil, errors.WithMessagef(err, "can't merge profile %s", options.Profile)
+		}
+	}
+	for _, override := range options.Overrides {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok || key == "" {
+			return nil, errors.WithMessage(ErrIllegalOverride, override)
+		}
+		converted, err := convertValue(v.Get(key), value)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "can't override %s", key)
+		}
+		//merge into config instead of viper.Set, which shadows the sibling keys in Sub
+		if err = v.MergeConfigMap(nest(strings.Split(key, "."), converted)); err != nil {
+			return nil, errors.WithMessagef(err, "can't override %s", key)
+		}
+		//viper skips the key silently if types are different
+		if !reflect.DeepEqual(v.Get(key), converted) {
+			return nil, errors.WithMessagef(ErrIllegalOverride, "%s is %T, can't override", key, v.Get(key))
+		}
+	}
+	return &properties{Viper: v, runtime: v.Sub("global")}, nil
+}
+
+func nest(keys []string, value any) map[string]any {
+	if len(keys) == 1 {
+		return map[string]any{keys[0]: value}
+	}
+	return map[string]any{keys[0]: nest(keys[1:], value)}
+}
+
+//convertValue convert the override value to the type of existing value, the merge of viper requires the same type
+func convertValue(existing any, value string) (any, error) {
+	switch existing.(type) {
+	case nil:
+		return parseValue(value), nil
+	case string:
+		return value, nil
+	case int:
+		return strconv.Atoi(value)
+	case int64:
+		return strconv.ParseInt(value, 10, 64)
+	case float64:
+		return strconv.ParseFloat(value, 64)
+	case bool:
+		return strconv.ParseBool(value)
+	case []any:
+		if list, ok := parseValue(value).([]any); ok {
+			return list, nil
+		}
+		return []any{value}, nil
+	}
+	return nil, errors.WithMessagef(ErrIllegalOverride, "unsupported type %T", existing)
+}
+
+func parseValue(value string) any {
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		items := strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"), ",")
+		list := make([]any, 0, len(items))
+		for _, item := range items {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, strings.Trim(item, `"'`))
+			}
+		}
+		return list
 	}
-	return &properties{Viper: v, runtime: v.Sub("global")}
+	return value
 }
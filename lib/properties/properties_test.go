@@ -0,0 +1,56 @@
+package properties
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const config = `
+[global]
+log-level = "info"
+[sink.echo]
+type = "echo"
+batch = 1
+pretty = false
+rate = 0.5
+outputs = ["a"]
+`
+
+func TestOverrides(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "athena.toml")
+	if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(file, Options{Overrides: []string{"sink.echo.batch=7", "sink.echo.pretty=true", "sink.echo.rate=2.5",
+		"sink.echo.outputs=[b, c]", "sink.echo.codec=json"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := p.Sub("sink.echo")
+	if batch := echo.GetInt(NewProperty[int]("batch", "", 0)); batch != 7 {
+		t.Fatalf("int override is ignored, batch %d", batch)
+	}
+	if !echo.GetBool(NewProperty[bool]("pretty", "", false)) {
+		t.Fatalf("bool override is ignored")
+	}
+	if rate := echo.GetFloat64(NewProperty[float64]("rate", "", 0)); rate != 2.5 {
+		t.Fatalf("float override is ignored, rate %v", rate)
+	}
+	if outputs := echo.GetStringSlice(NewProperty[[]string]("outputs", "", nil)); len(outputs) != 2 || outputs[1] != "c" {
+		t.Fatalf("list override is ignored, outputs %v", outputs)
+	}
+	if codec := echo.GetString(NewProperty[string]("codec", "", "")); codec != "json" {
+		t.Fatalf("new key is not set, codec %s", codec)
+	}
+	//sibling keys are kept
+	if typ := echo.GetString(NewProperty[string]("type", "", "")); typ != "echo" {
+		t.Fatalf("sibling key is shadowed, type %s", typ)
+	}
+
+	for _, override := range []string{"sink.echo.batch=seven", "sink.echo.pretty=yes", "sink.echo=1", "batch"} {
+		if _, err = New(file, Options{Overrides: []string{override}}); err == nil {
+			t.Fatalf("illegal override %s is accepted", override)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package runtime
+
+import (
+	"athena/athena"
+	"athena/lib/log"
+	"athena/lib/runtime/task"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+)
+
+const (
+	adminPrefix = "/admin"
+	maskedValue = "******"
+)
+
+var (
+	secretPattern = regexp.MustCompile(`(?i)password|secret|token|credential|authorization|sasl|user-?info`)
+	//headersPattern match the header maps, all their values are masked, like Authorization: Bearer
+	headersPattern = regexp.MustCompile(`(?i)headers$`)
+)
+
+type taskView struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	State string `json:"state"`
+	Err   string `json:"error,omitempty"`
+}
+
+func newTaskView(name string, kind string, status *task.Status) taskView {
+	view := taskView{Name: name, Kind: kind, State: status.State().String()}
+	if err := status.Err(); err != nil {
+		view.Err = err.Error()
+	}
+	return view
+}
+
+func (e *Runtime) initAdmin(address string) {
+	e.handle(address, adminPrefix+"/tasks", allow(http.MethodGet, e.listTasks))
+	e.handle(address, adminPrefix+"/topology", allow(http.MethodGet, e.showTopology))
+	e.handle(address, adminPrefix+"/properties", allow(http.MethodGet, e.showProperties))
+	e.handle(address, adminPrefix+"/checkpoint", allow(http.MethodPost, e.triggerCheckpoint))
+	e.handle(address, adminPrefix+"/log-level", http.HandlerFunc(e.logLevel))
+	e.handle(address, adminPrefix+"/stop", allow(http.MethodPost, e.stop))
+}
+
+func (e *Runtime) listTasks(w http.ResponseWriter, _ *http.Request) {
+	views := make([]taskView, 0, len(e.sourceTasks)+len(e.operatorTasks)+len(e.sinkTasks))
+	for ctx, sourceTask := range e.sourceTasks {
+		views = append(views, newTaskView(ctx.Name(), SourcePrefix, &sourceTask.Status))
+	}
+	for ctx, operatorTask := range e.operatorTasks {
+		views = append(views, newTaskView(ctx.Name(), OperatorPrefix, &operatorTask.Status))
+	}
+	for ctx, sinkTask := range e.sinkTasks {
+		views = append(views, newTaskView(ctx.Name(), SinkPrefix, &sinkTask.Status))
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (e *Runtime) showTopology(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, e.outputs())
+}
+
+func (e *Runtime) showProperties(w http.ResponseWriter, _ *http.Request) {
+	all := map[string]any{"global": mask(e.runtime.AllSettings())}
+	for _, ctx := range e.contexts() {
+		all[ctx.Name()] = mask(ctx.Properties().AllSettings())
+	}
+	writeJSON(w, http.StatusOK, all)
+}
+
+func (e *Runtime) triggerCheckpoint(w http.ResponseWriter, _ *http.Request) {
+	checkpointId, err := e.checkpoint.Trigger()
+	if err != nil {
+		e.logger.Errorw("failed trigger checkpoint.", "checkpoint", checkpointId, "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"checkpoint": checkpointId, "error": err.Error()})
+		return
+	}
+	e.logger.Infow("checkpoint is complete.", "checkpoint", checkpointId)
+	writeJSON(w, http.StatusOK, map[string]any{"checkpoint": checkpointId})
+}
+
+func (e *Runtime) logLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		if err := log.SetLevel(r.FormValue("level")); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+		e.logger.Infow("change log level.", "level", log.GetLevel())
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"level": log.GetLevel()})
+}
+
+func (e *Runtime) stop(w http.ResponseWriter, _ *http.Request) {
+	e.logger.Info("admin request stop.")
+	writeJSON(w, http.StatusAccepted, map[string]any{"stopping": true})
+	go e.Stop()
+}
+
+//outputs return the resolved topology, component name to its outputs name
+func (e *Runtime) outputs() map[string][]string {
+	outputs := map[string][]string{}
+	for downstream, upstreams := range e.topology {
+		for _, upstream := range upstreams {
+			outputs[upstream.Name()] = append(outputs[upstream.Name()], downstream.Name())
+		}
+	}
+	for _, names := range outputs {
+		sort.Strings(names)
+	}
+	return outputs
+}
+
+func (e *Runtime) contexts() []athena.Context {
+	contexts := make([]athena.Context, 0, len(e.sourceTasks)+len(e.operatorTasks)+len(e.sinkTasks))
+	for ctx := range e.sourceTasks {
+		contexts = append(contexts, ctx)
+	}
+	for ctx := range e.operatorTasks {
+		contexts = append(contexts, ctx)
+	}
+	for ctx := range e.sinkTasks {
+		contexts = append(contexts, ctx)
+	}
+	return contexts
+}
+
+//mask replace the value of secret keys, header maps and the password of urls
+func mask(settings map[string]any) map[string]any {
+	masked := make(map[string]any, len(settings))
+	for key, value := range settings {
+		switch v := value.(type) {
+		case map[string]any:
+			if headersPattern.MatchString(key) {
+				masked[key] = maskAll(v)
+			} else {
+				masked[key] = mask(v)
+			}
+		case string:
+			if secretPattern.MatchString(key) {
+				masked[key] = maskedValue
+			} else {
+				masked[key] = maskURL(v)
+			}
+		default:
+			if secretPattern.MatchString(key) {
+				masked[key] = maskedValue
+			} else {
+				masked[key] = value
+			}
+		}
+	}
+	return masked
+}
+
+//maskAll replace all values
+func maskAll(settings map[string]any) map[string]any {
+	masked := make(map[string]any, len(settings))
+	for key, value := range settings {
+		if v, ok := value.(map[string]any); ok {
+			masked[key] = maskAll(v)
+		} else {
+			masked[key] = maskedValue
+		}
+	}
+	return masked
+}
+
+//maskURL replace the password of url user info, like schema registry url
+func maskURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	return u.Redacted()
+}
+
+func allow(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
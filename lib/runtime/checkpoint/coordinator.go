@@ -1 +1,100 @@
 package checkpoint
+
+import (
+	"athena/athena"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const snapshotSuffix = ".snapshot"
+
+//Pauser pause the task of stateful component, no event is emitted to or by the component until resumed
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
+//Coordinator persists Stateful component snapshots under the status dir
+type Coordinator struct {
+	dir          string
+	mutex        sync.Mutex
+	checkpointId int64
+	stateful     map[string]athena.Stateful
+	pausers      map[string]Pauser
+}
+
+func (c *Coordinator) path(name string) string {
+	return filepath.Join(c.dir, name+snapshotSuffix)
+}
+
+//Restore register the stateful component with the pauser of its task, and restore its last snapshot if exists
+func (c *Coordinator) Restore(name string, stateful athena.Stateful, pauser Pauser) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stateful[name] = stateful
+	c.pausers[name] = pauser
+	snapshot, err := os.ReadFile(c.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.WithMessagef(err, "can't read %s snapshot", name)
+	}
+	if len(snapshot) == 0 {
+		return nil
+	}
+	return errors.WithMessagef(stateful.Restore(snapshot), "can't restore %s", name)
+}
+
+//Snapshot write the final snapshot of the stateful component and unregister it
+func (c *Coordinator) Snapshot(name string, stateful athena.Stateful) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.stateful, name)
+	delete(c.pausers, name)
+	return c.write(name, stateful)
+}
+
+//Trigger snapshot all registered stateful components, return the checkpoint id
+func (c *Coordinator) Trigger() (int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.checkpointId++
+	for name, stateful := range c.stateful {
+		if err := c.pauseAndWrite(name, stateful); err != nil {
+			return c.checkpointId, err
+		}
+	}
+	return c.checkpointId, nil
+}
+
+//pauseAndWrite snapshot the running component while its task is paused, as if it's closed
+func (c *Coordinator) pauseAndWrite(name string, stateful athena.Stateful) error {
+	if pauser := c.pausers[name]; pauser != nil {
+		pauser.Pause()
+		defer pauser.Resume()
+	}
+	return c.write(name, stateful)
+}
+
+func (c *Coordinator) write(name string, stateful athena.Stateful) error {
+	snapshot, err := stateful.Snapshot()
+	if err != nil {
+		return errors.WithMessagef(err, "can't snapshot %s", name)
+	}
+	if err = os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	//write to temp file and rename, avoid broken snapshot
+	tmp := c.path(name) + ".tmp"
+	if err = os.WriteFile(tmp, snapshot, 0644); err != nil {
+		return errors.WithMessagef(err, "can't write %s snapshot", name)
+	}
+	return os.Rename(tmp, c.path(name))
+}
+
+func NewCoordinator(dir string) *Coordinator {
+	return &Coordinator{dir: dir, stateful: map[string]athena.Stateful{}, pausers: map[string]Pauser{}}
+}
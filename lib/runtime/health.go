@@ -0,0 +1,73 @@
+package runtime
+
+import (
+	"athena/lib/runtime/task"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type probe struct {
+	Status  string   `json:"status"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+func (e *Runtime) initHealth(address string, sourceIdleTimeout time.Duration) {
+	e.handle(address, "/healthz", allow(http.MethodGet, func(w http.ResponseWriter, _ *http.Request) {
+		writeProbe(w, e.liveness(sourceIdleTimeout))
+	}))
+	e.handle(address, "/readyz", allow(http.MethodGet, func(w http.ResponseWriter, _ *http.Request) {
+		writeProbe(w, e.readiness())
+	}))
+}
+
+//liveness fails if any task failed, or any source emitted nothing for sourceIdleTimeout
+func (e *Runtime) liveness(sourceIdleTimeout time.Duration) []string {
+	var reasons []string
+	check := func(name string, status *task.Status) {
+		if status.State() == task.Failed {
+			reasons = append(reasons, fmt.Sprintf("%s failed: %v", name, status.Err()))
+		}
+	}
+	for ctx, sourceTask := range e.sourceTasks {
+		check(ctx.Name(), &sourceTask.Status)
+		if sourceIdleTimeout > 0 && sourceTask.State() == task.Running && sourceTask.Idle() > sourceIdleTimeout {
+			reasons = append(reasons, fmt.Sprintf("%s emitted nothing for %s", ctx.Name(), sourceTask.Idle().Truncate(time.Second)))
+		}
+	}
+	for ctx, operatorTask := range e.operatorTasks {
+		check(ctx.Name(), &operatorTask.Status)
+	}
+	for ctx, sinkTask := range e.sinkTasks {
+		check(ctx.Name(), &sinkTask.Status)
+	}
+	return reasons
+}
+
+//readiness is true only after every task opened and is running
+func (e *Runtime) readiness() []string {
+	var reasons []string
+	check := func(name string, status *task.Status) {
+		if state := status.State(); state != task.Running {
+			reasons = append(reasons, fmt.Sprintf("%s is %s", name, state))
+		}
+	}
+	for ctx, sourceTask := range e.sourceTasks {
+		check(ctx.Name(), &sourceTask.Status)
+	}
+	for ctx, operatorTask := range e.operatorTasks {
+		check(ctx.Name(), &operatorTask.Status)
+	}
+	for ctx, sinkTask := range e.sinkTasks {
+		check(ctx.Name(), &sinkTask.Status)
+	}
+	return reasons
+}
+
+func writeProbe(w http.ResponseWriter, reasons []string) {
+	if len(reasons) == 0 {
+		writeJSON(w, http.StatusOK, probe{Status: "ok"})
+	} else {
+		writeJSON(w, http.StatusServiceUnavailable, probe{Status: "failed", Reasons: reasons})
+	}
+}
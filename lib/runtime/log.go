@@ -0,0 +1,71 @@
+package runtime
+
+import (
+	"athena/athena"
+	"athena/lib/log"
+	"athena/pkg/constant"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+)
+
+var (
+	ErrUnknownLogFormat = fmt.Errorf("unknown log format")
+)
+
+//newLogOptions build log options from global properties
+func newLogOptions(global athena.Properties) (*log.Options, error) {
+	options := log.DefaultOptions()
+	level, err := log.ParseLevel(global.GetString(constant.RuntimeLogLevelProperty))
+	if err != nil {
+		return nil, err
+	}
+	options.WithLevel(level)
+
+	switch format := global.GetString(constant.RuntimeLogFormatProperty); format {
+	case "console":
+		options.WithOutputEncoder(log.ConsoleOutputEncoder)
+	case "json":
+		options.WithOutputEncoder(log.JsonOutputEncoder)
+	default:
+		return nil, errors.WithMessage(ErrUnknownLogFormat, format)
+	}
+
+	if filename := global.GetString(constant.RuntimeLogFileProperty); filename != "" {
+		options.WithFile(&log.FileOptions{
+			Filename:       filename,
+			MaxSize:        global.GetInt(constant.RuntimeLogFileMaxSizeProperty),
+			MaxAge:         global.GetInt(constant.RuntimeLogFileMaxAgeProperty),
+			MaxBackups:     global.GetInt(constant.RuntimeLogFileMaxBackupsProperty),
+			RotateInterval: global.GetDuration(constant.RuntimeLogFileRotateIntervalProperty),
+			Compress:       global.GetBool(constant.RuntimeLogFileCompressProperty),
+		})
+	}
+
+	for name, levelText := range flatten("", global.GetStringMap(constant.RuntimeLogLevelsProperty)) {
+		namedLevel, err := log.ParseLevel(cast.ToString(levelText))
+		if err != nil {
+			return nil, errors.WithMessagef(err, "log level of %s", name)
+		}
+		options.WithNamedLevel(name, namedLevel)
+	}
+	return options, nil
+}
+
+//flatten nested map to dotted keys, like {operator: {aggregate: debug}} to {operator.aggregate: debug}
+func flatten(prefix string, m map[string]any) map[string]any {
+	flat := map[string]any{}
+	for key, value := range m {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]any); ok {
+			for k, v := range flatten(key, nested) {
+				flat[k] = v
+			}
+		} else {
+			flat[key] = value
+		}
+	}
+	return flat
+}
@@ -6,16 +6,27 @@ import (
 	"athena/lib/context"
 	"athena/lib/emit"
 	"athena/lib/log"
+	"athena/lib/metrics"
 	"athena/lib/properties"
+	"athena/lib/runtime/checkpoint"
 	"athena/lib/runtime/task"
+	"athena/lib/trace"
 	"athena/pkg/constant"
+	"bytes"
 	_c "context"
 	"fmt"
+	"github.com/olekukonko/tablewriter"
 	"github.com/pkg/errors"
 	"gopkg.in/tomb.v2"
+	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
 type QOS uint
@@ -27,7 +38,17 @@ const (
 )
 
 var (
-	propertiesDef = athena.PropertiesDef{constant.RuntimeModeProperty, constant.RuntimeLogLevelProperty, constant.RuntimeStatusDirProperty}
+	ErrTopologyCycle = fmt.Errorf("topology has cycle")
+	ErrTaskPanic     = fmt.Errorf("task panic")
+
+	propertiesDef = athena.PropertiesDef{constant.RuntimeModeProperty, constant.RuntimeStatusDirProperty,
+		constant.RuntimeLogLevelProperty, constant.RuntimeLogFormatProperty, constant.RuntimeLogLevelsProperty,
+		constant.RuntimeLogFileProperty, constant.RuntimeLogFileMaxSizeProperty, constant.RuntimeLogFileMaxAgeProperty,
+		constant.RuntimeLogFileMaxBackupsProperty, constant.RuntimeLogFileRotateIntervalProperty, constant.RuntimeLogFileCompressProperty,
+		constant.RuntimeMetricsAddressProperty, constant.RuntimeMetricsPathProperty, constant.RuntimeAdminAddressProperty,
+		constant.RuntimeHealthAddressProperty, constant.RuntimeSourceIdleProperty,
+		constant.RuntimeDrainTimeoutProperty, constant.RuntimeTraceExporterProperty, constant.RuntimeTraceEndpointProperty,
+		constant.RuntimeTraceInsecureProperty, constant.RuntimeTraceFileProperty, constant.RuntimeTraceSampleRatioProperty}
 )
 
 type Runtime struct {
@@ -41,6 +62,12 @@ type Runtime struct {
 
 	allEmitNext map[athena.Context]athena.EmitGenerator
 	topology    map[athena.Context][]athena.Context
+
+	restartPolicies map[athena.Context]*task.RestartPolicy
+	finished        map[athena.Context]chan struct{}
+	stopOnce        sync.Once
+	checkpoint      *checkpoint.Coordinator
+	muxes           map[string]*http.ServeMux
 }
 
 func (e *Runtime) initSources() {
@@ -55,16 +82,12 @@ func (e *Runtime) initSources() {
 			panic("sources can't be nil")
 		}
 		source := component.NewSourceFunc(sourceCtx.Properties().GetString(constant.TypeProperty))()
-		renderText, err := properties.InitAndRender(sourceCtx.Properties(), source.PropertiesDef())
-		if err != nil {
-			panic(errors.WithMessage(err, "failed to init source properties"))
-		} else {
-			e.logger.Infof("init %s:\n%s", sourceName, renderText)
-		}
+		e.initTask(sourceCtx, source.PropertiesDef())
 		sourceTask := &task.SourceTask{
-			Source: source,
-			Ctx:    sourceCtx,
-			Name:   sourceName,
+			Source:     source,
+			Ctx:        sourceCtx,
+			Name:       sourceName,
+			Checkpoint: e.checkpoint,
 		}
 		e.sourceTasks[sourceCtx] = sourceTask
 
@@ -80,19 +103,14 @@ func (e *Runtime) initOperators() {
 			panic(fmt.Sprintf("operator %s properties can't be nil.", operatorName))
 		}
 		operator := component.NewOperatorFunc(operatorCtx.Properties().GetString(constant.TypeProperty))()
-
-		renderText, err := properties.InitAndRender(operatorCtx.Properties(), operator.PropertiesDef())
-		if err != nil {
-			panic(errors.WithMessage(err, "failed to init operator properties"))
-		} else {
-			e.logger.Infof("init %s:\n%s", operatorName, renderText)
-		}
+		e.initTask(operatorCtx, operator.PropertiesDef())
 		operatorTask := &task.OperatorTask{
-			Operator: operator,
-			Ctx:      operatorCtx,
+			Operator:   operator,
+			Ctx:        operatorCtx,
+			Checkpoint: e.checkpoint,
 		}
 		e.operatorTasks[operatorCtx] = operatorTask
-		e.allEmitNext[operatorCtx] = operatorTask.GenerateEmit
+		e.allEmitNext[operatorCtx] = trace.WrapEmitGenerator(operatorCtx, metrics.WrapEmitGenerator(operatorCtx, operatorTask.GenerateEmit))
 	}
 }
 
@@ -108,37 +126,114 @@ func (e *Runtime) initSinks() {
 			panic(fmt.Sprintf("sink %s properties can't be nil.", sinkName))
 		}
 		sink := component.NewSinkFunc(sinkCtx.Properties().GetString(constant.TypeProperty))()
-		renderText, err := properties.InitAndRender(sinkCtx.Properties(), sink.PropertiesDef())
-		if err != nil {
-			panic(errors.WithMessage(err, "failed to init sink properties"))
-		} else {
-			e.logger.Infof("init %s:\n%s", sinkName, renderText)
-		}
+		e.initTask(sinkCtx, sink.PropertiesDef())
 		sinkTask := &task.SinkTask{
-			Sink: sink,
-			Ctx:  sinkCtx,
+			Sink:       sink,
+			Ctx:        sinkCtx,
+			Checkpoint: e.checkpoint,
 		}
 		e.sinkTasks[sinkCtx] = sinkTask
-		e.allEmitNext[sinkCtx] = sinkTask.GenerateEmit
+		e.allEmitNext[sinkCtx] = trace.WrapEmitGenerator(sinkCtx, metrics.WrapEmitGenerator(sinkCtx, sinkTask.GenerateEmit))
 	}
 }
 
 func (e *Runtime) initTopology() {
 	for _, operatorTask := range e.operatorTasks {
 		emitNextGenerator := emit.NewEmitNextGeneratorFunc(operatorTask.Ctx.Properties().GetString(constant.SelectorProperty))()
-		operatorTask.EmitNext = emitNextGenerator(operatorTask.Ctx, e.allEmitNext, e.topology)
+		operatorTask.EmitNext = metrics.WrapEmitNext(operatorTask.Ctx, emitNextGenerator(operatorTask.Ctx, e.allEmitNext, e.topology))
 	}
 	for _, sourceTask := range e.sourceTasks {
 		emitNextGenerator := emit.NewEmitNextGeneratorFunc(sourceTask.Ctx.Properties().GetString(constant.SelectorProperty))()
-		sourceTask.EmitNext = emitNextGenerator(sourceTask.Ctx, e.allEmitNext, e.topology)
+		sourceTask.EmitNext = trace.WrapSourceEmitNext(sourceTask.Ctx, metrics.WrapEmitNext(sourceTask.Ctx, emitNextGenerator(sourceTask.Ctx, e.allEmitNext, e.topology)))
+	}
+	e.checkTopology()
+}
+
+//checkTopology panic if operators form a cycle, warn components without upstream
+func (e *Runtime) checkTopology() {
+	for ctx := range e.operatorTasks {
+		if len(e.topology[ctx]) == 0 {
+			e.logger.Warnf("operator %s has no upstream.", ctx.Name())
+		}
+	}
+	for ctx := range e.sinkTasks {
+		if len(e.topology[ctx]) == 0 {
+			e.logger.Warnf("sink %s has no upstream.", ctx.Name())
+		}
+	}
+	outputs := e.outputs()
+	const (
+		visiting = iota + 1
+		visited
+	)
+	states := map[string]int{}
+	var visit func(name string, path []string)
+	visit = func(name string, path []string) {
+		switch states[name] {
+		case visiting:
+			panic(errors.WithMessage(ErrTopologyCycle, strings.Join(append(path, name), " -> ")))
+		case visited:
+			return
+		}
+		states[name] = visiting
+		for _, downstream := range outputs[name] {
+			visit(downstream, append(path, name))
+		}
+		states[name] = visited
+	}
+	for ctx := range e.sourceTasks {
+		visit(ctx.Name(), nil)
+	}
+	for ctx := range e.operatorTasks {
+		visit(ctx.Name(), nil)
+	}
+}
+
+//Build init all components and check the topology without running them
+func (e *Runtime) Build() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _err, ok := r.(error); ok {
+				err = _err
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	e.initSources()
+	e.initOperators()
+	e.initSinks()
+	e.initTopology()
+	return nil
+}
+
+//RenderTopology render components and their outputs as table
+func (e *Runtime) RenderTopology() string {
+	outputs := e.outputs()
+	contexts := e.contexts()
+	sort.Slice(contexts, func(i, j int) bool {
+		return contexts[i].Name() < contexts[j].Name()
+	})
+	buffer := &bytes.Buffer{}
+	tWriter := tablewriter.NewWriter(buffer)
+	tWriter.SetHeader([]string{"name", "type", "outputs"})
+	tWriter.SetAutoFormatHeaders(false)
+	tWriter.SetAutoWrapText(false)
+	for _, ctx := range contexts {
+		tWriter.Append([]string{
+			ctx.Name(),
+			ctx.Properties().GetString(constant.TypeProperty),
+			strings.Join(outputs[ctx.Name()], ","),
+		})
 	}
-	//check topology
+	tWriter.Render()
+	return buffer.String()
 }
 
 func (e *Runtime) Run() {
 	//notify system signal
 	e.life.Go(func() error {
-		c := make(chan os.Signal)
+		c := make(chan os.Signal, 1)
 		signal.Notify(c)
 		for {
 			select {
@@ -146,7 +241,7 @@ func (e *Runtime) Run() {
 				switch s {
 				case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT: // ctrl + c
 					e.logger.Infof("notify system signal %s, done.", s)
-					e.ctx.Cancel()
+					e.Stop()
 					return nil
 				}
 			case <-e.ctx.Done():
@@ -156,87 +251,213 @@ func (e *Runtime) Run() {
 		}
 	})
 
-	e.initSources()
-	e.initOperators()
-	e.initSinks()
-	e.initTopology()
+	if err := e.Build(); err != nil {
+		panic(errors.WithMessage(err, "can't build runtime"))
+	}
+	e.handle(e.runtime.GetString(constant.RuntimeMetricsAddressProperty), e.runtime.GetString(constant.RuntimeMetricsPathProperty), metrics.Handler())
+	e.initAdmin(e.runtime.GetString(constant.RuntimeAdminAddressProperty))
+	e.initHealth(e.runtime.GetString(constant.RuntimeHealthAddressProperty), e.runtime.GetDuration(constant.RuntimeSourceIdleProperty))
+	e.serve()
 	e.runAll()
 	<-e.life.Dead()
 }
 
+//Stop drain the runtime gracefully, and force stop after drain timeout
+func (e *Runtime) Stop() {
+	e.stopOnce.Do(func() {
+		timeout := e.runtime.GetDuration(constant.RuntimeDrainTimeoutProperty)
+		e.logger.Infow("start draining.", "timeout", timeout)
+		drained := make(chan struct{})
+		go func() {
+			e.drain()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+			e.logger.Info("drain is complete.")
+		case <-time.After(timeout):
+			e.logger.Warnw("drain timeout, force stop.", "pending", e.pending())
+		}
+		if err := trace.Shutdown(serverShutdownTimeout); err != nil {
+			e.logger.Warnw("failed flush traces.", "err", err)
+		}
+		e.ctx.Cancel()
+	})
+}
+
+//drain terminate tasks in topological order:
+//stop sources, flush and close operators and sinks after all their upstream closed,
+//then wait for outstanding acks
+func (e *Runtime) drain() {
+	for ctx := range e.sourceTasks {
+		ctx.Cancel()
+	}
+	for ctx := range e.sourceTasks {
+		<-e.finished[ctx]
+	}
+	e.logger.Info("all source tasks are stopped.")
+
+	var wg sync.WaitGroup
+	closeAfterUpstream := func(ctx athena.Context) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, upstream := range e.topology[ctx] {
+				<-e.finished[upstream]
+			}
+			ctx.Cancel()
+			<-e.finished[ctx]
+		}()
+	}
+	for ctx := range e.operatorTasks {
+		closeAfterUpstream(ctx)
+	}
+	for ctx := range e.sinkTasks {
+		closeAfterUpstream(ctx)
+	}
+	wg.Wait()
+	e.logger.Info("all operator and sink tasks are closed.")
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for pending := e.pending(); pending > 0; pending = e.pending() {
+		e.logger.Debugw("waiting for outstanding acks.", "pending", pending)
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//pending return the number of events emitted by sources and waiting for ack
+func (e *Runtime) pending() int64 {
+	var pending int64
+	for _, sourceTask := range e.sourceTasks {
+		pending += sourceTask.Pending()
+	}
+	return pending
+}
+
 func (e *Runtime) runAll() {
 	//starting
 	for ctx, sinkTask := range e.sinkTasks {
-		_task := sinkTask
-		_ctx := ctx
-		e.life.Go(func() error {
-			e.logger.Infow("starting run sink task.", "task", _ctx.Name())
-			var err error
-			if err = _task.Run(); err != nil {
-				e.logger.Errorw("failed run sink task.", "task", _ctx.Name(), "err", err)
-			} else {
-				e.logger.Infow("sink task is complete.", "task", _ctx.Name())
-			}
-			e.ctx.Cancel()
-			return err
-		})
+		e.supervise(ctx, SinkPrefix, sinkTask.Run)
 	}
-
 	for ctx, operatorTask := range e.operatorTasks {
-		_task := operatorTask
-		_ctx := ctx
-		e.life.Go(func() error {
-			e.logger.Infow("starting run operator task.", "task", _ctx.Name())
-			var err error
-			if err = _task.Run(); err != nil {
-				e.logger.Errorw("failed run operator task.", "task", _ctx.Name(), "err", err)
-			} else {
-				e.logger.Infow("operator task is complete.", "task", _ctx.Name())
-			}
-			e.ctx.Cancel()
-			return err
-		})
+		e.supervise(ctx, OperatorPrefix, operatorTask.Run)
 	}
+	for ctx, sourceTask := range e.sourceTasks {
+		e.supervise(ctx, SourcePrefix, sourceTask.Run)
+	}
+}
 
-	for _, sourceTask := range e.sourceTasks {
-		_task := sourceTask
-		e.life.Go(func() error {
-			e.logger.Infow("starting run source task.", "task", _task.Name)
-			var err error
-			if err = _task.Run(); err != nil {
-				e.logger.Errorw("failed run source task.", "task", _task.Name, "err", err)
+//supervise run the task and restart it by its restart policy,
+//the whole runtime stops when the task will not be restarted
+func (e *Runtime) supervise(ctx athena.Context, kind string, run func() error) {
+	restartPolicy := e.restartPolicies[ctx]
+	finished := e.finished[ctx]
+	e.life.Go(func() error {
+		defer close(finished)
+		for restarts := 0; ; restarts++ {
+			e.logger.Infow(fmt.Sprintf("starting run %s task.", kind), "task", ctx.Name(), "restarts", restarts)
+			err := e.call(ctx, run)
+			if err != nil {
+				e.logger.Errorw(fmt.Sprintf("failed run %s task.", kind), "task", ctx.Name(), "err", err)
 			} else {
-				e.logger.Infow("operator task is complete.", "task", _task.Name)
+				e.logger.Infow(fmt.Sprintf("%s task is complete.", kind), "task", ctx.Name())
 			}
-			e.ctx.Cancel()
-			return err
-		})
-	}
+			select {
+			case <-ctx.Done():
+				return err
+			default:
+			}
+			backoff, ok := restartPolicy.Next(err, restarts)
+			if !ok {
+				e.logger.Warnw(fmt.Sprintf("%s task will not be restarted, stopping.", kind), "task", ctx.Name())
+				go e.Stop()
+				return err
+			}
+			e.logger.Infow(fmt.Sprintf("restarting %s task.", kind), "task", ctx.Name(), "backoff", backoff)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+		}
+	})
+}
 
+//call run and recover the panic as error, so the task is restarted by its restart policy
+func (e *Runtime) call(ctx athena.Context, run func() error) (err error) {
+	defer func() {
+		if reason := recover(); reason != nil {
+			e.logger.Errorw("task panic.", "task", ctx.Name(), "reason", reason, "stack", string(debug.Stack()))
+			err = errors.WithMessagef(ErrTaskPanic, "%v", reason)
+		}
+	}()
+	return run()
 }
 
-func New(originCtx _c.Context, propertiesName string, propertiesType string, propertiesPath ...string) *Runtime {
+//initTask init component and task properties, and the restart policy of the task
+func (e *Runtime) initTask(ctx athena.Context, def athena.PropertiesDef) {
+	renderText, err := properties.InitAndRender(ctx.Properties(), append(def, task.PropertiesDef()...))
+	if err != nil {
+		panic(errors.WithMessagef(err, "failed to init %s properties", ctx.Name()))
+	}
+	e.logger.Infof("init %s:\n%s", ctx.Name(), renderText)
+	restartPolicy, err := task.NewRestartPolicy(ctx.Properties())
+	if err != nil {
+		panic(errors.WithMessagef(err, "failed to init %s restart policy", ctx.Name()))
+	}
+	e.restartPolicies[ctx] = restartPolicy
+	e.finished[ctx] = make(chan struct{})
+	metricsObserver, traceObserver := metrics.ACKObserver(ctx), trace.ACKObserver(ctx)
+	ctx.Store(athena.ACKObserverKey, athena.ACKObserver(func(event *athena.Event, ok bool) {
+		metricsObserver(event, ok)
+		traceObserver(event, ok)
+	}))
+}
+
+func New(originCtx _c.Context, ps athena.Properties) *Runtime {
 	log.Setup(log.DefaultOptions().WithOutputEncoder(log.ConsoleOutputEncoder))
-	ps := properties.New(propertiesName, propertiesType, propertiesPath...)
-	ctx := context.New(originCtx, ps)
-	logger := log.Ctx(ctx)
 	initAndRender, err := properties.InitAndRender(ps.Global(), propertiesDef)
 	if err != nil {
 		panic(errors.WithMessage(err, "can't init runtime properties"))
 	}
+	logOptions, err := newLogOptions(ps.Global())
+	if err != nil {
+		panic(errors.WithMessage(err, "can't init log"))
+	}
+	log.Setup(logOptions)
+	if err = trace.Setup(trace.Options{
+		Exporter:    ps.Global().GetString(constant.RuntimeTraceExporterProperty),
+		Endpoint:    ps.Global().GetString(constant.RuntimeTraceEndpointProperty),
+		Insecure:    ps.Global().GetBool(constant.RuntimeTraceInsecureProperty),
+		File:        ps.Global().GetString(constant.RuntimeTraceFileProperty),
+		SampleRatio: ps.Global().GetFloat64(constant.RuntimeTraceSampleRatioProperty),
+	}); err != nil {
+		panic(errors.WithMessage(err, "can't init trace"))
+	}
+	ctx := context.New(originCtx, ps)
+	logger := log.Ctx(ctx)
 	logger.Infof("global:\n%s", initAndRender)
 
 	life, _ := tomb.WithContext(ctx.Ctx())
 	engine := &Runtime{
-		logger:        logger,
-		sourceTasks:   map[athena.Context]*task.SourceTask{},
-		operatorTasks: map[athena.Context]*task.OperatorTask{},
-		sinkTasks:     map[athena.Context]*task.SinkTask{},
-		allEmitNext:   map[athena.Context]athena.EmitGenerator{},
-		topology:      map[athena.Context][]athena.Context{},
-		runtime:       ps.Global(),
-		life:          life,
-		ctx:           ctx,
+		logger:          logger,
+		sourceTasks:     map[athena.Context]*task.SourceTask{},
+		operatorTasks:   map[athena.Context]*task.OperatorTask{},
+		sinkTasks:       map[athena.Context]*task.SinkTask{},
+		allEmitNext:     map[athena.Context]athena.EmitGenerator{},
+		topology:        map[athena.Context][]athena.Context{},
+		restartPolicies: map[athena.Context]*task.RestartPolicy{},
+		finished:        map[athena.Context]chan struct{}{},
+		checkpoint:      checkpoint.NewCoordinator(ps.Global().GetString(constant.RuntimeStatusDirProperty)),
+		muxes:           map[string]*http.ServeMux{},
+		runtime:         ps.Global(),
+		life:            life,
+		ctx:             ctx,
 	}
 	return engine
 }
@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	_c "context"
+	"net/http"
+	"time"
+)
+
+const serverShutdownTimeout = 5 * time.Second
+
+//handle registers handler on the http server listening on address,
+//handlers with the same address share one server
+func (e *Runtime) handle(address string, pattern string, handler http.Handler) {
+	if address == "" {
+		return
+	}
+	mux, ok := e.muxes[address]
+	if !ok {
+		mux = http.NewServeMux()
+		e.muxes[address] = mux
+	}
+	mux.Handle(pattern, handler)
+}
+
+func (e *Runtime) serve() {
+	for address, mux := range e.muxes {
+		server := &http.Server{Addr: address, Handler: mux}
+		e.life.Go(func() error {
+			e.logger.Infow("starting http server.", "address", server.Addr)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				e.logger.Errorw("failed run http server.", "address", server.Addr, "err", err)
+				e.ctx.Cancel()
+				return err
+			}
+			return nil
+		})
+		e.life.Go(func() error {
+			<-e.ctx.Done()
+			ctx, cancel := _c.WithTimeout(_c.Background(), serverShutdownTimeout)
+			defer cancel()
+			return server.Shutdown(ctx)
+		})
+	}
+}
@@ -2,21 +2,48 @@ package task
 
 import (
 	"athena/athena"
+	"athena/lib/runtime/checkpoint"
 )
 
 type OperatorTask struct {
 	athena.Operator
-	Ctx      athena.Context
-	EmitNext athena.EmitNext
+	Status
+	Ctx        athena.Context
+	EmitNext   athena.EmitNext
+	Checkpoint *checkpoint.Coordinator
+
+	gate gate
+}
+
+//GenerateEmit blocks upstream while the operator is not running
+func (o *OperatorTask) GenerateEmit(upstreamCtx athena.Context) athena.Emit {
+	return o.gate.guard(o.Ctx.Done(), o.Operator.GenerateEmit(upstreamCtx))
 }
 
 func (o *OperatorTask) Run() error {
+	o.set(Opening)
 	if err := o.Open(o.Ctx); err != nil {
-		return err
+		return o.fail(err)
 	}
-
-	if err := o.Collect(o.EmitNext); err != nil {
-		return err
+	if err := restore(o.Checkpoint, o.Ctx, o.Operator, &o.gate); err != nil {
+		_ = o.Close()
+		return o.fail(err)
+	}
+	o.set(Running)
+	o.gate.open()
+	err := o.Collect(o.EmitNext)
+	o.gate.close()
+	o.set(Closing)
+	if err != nil {
+		_ = o.Close()
+		return o.fail(err)
+	}
+	if err = o.Close(); err != nil {
+		return o.fail(err)
+	}
+	if err = snapshot(o.Checkpoint, o.Ctx, o.Operator); err != nil {
+		return o.fail(err)
 	}
-	return o.Close()
+	o.set(Closed)
+	return nil
 }
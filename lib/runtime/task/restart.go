@@ -0,0 +1,76 @@
+package task
+
+import (
+	"athena/athena"
+	"athena/lib/properties"
+	"fmt"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	RestartNever     = "never"
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+)
+
+var (
+	RestartProperty           = properties.NewProperty[string]("restart", "restart policy, never always or on-failure.", RestartNever)
+	RestartBackoffProperty    = properties.NewProperty[time.Duration]("restart-backoff", "initial restart backoff, doubled on every restart.", time.Second)
+	RestartMaxBackoffProperty = properties.NewProperty[time.Duration]("restart-max-backoff", "max restart backoff.", time.Minute)
+	RestartMaxProperty        = properties.NewProperty[int]("restart-max", "max restarts, the job stops after exceeded, unlimited if zero.", 0)
+
+	ErrUnknownRestartPolicy = fmt.Errorf("unknown restart policy")
+)
+
+//PropertiesDef is common properties of all tasks
+func PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{RestartProperty, RestartBackoffProperty, RestartMaxBackoffProperty, RestartMaxProperty}
+}
+
+//RestartPolicy decide whether a finished task should be restarted
+type RestartPolicy struct {
+	policy     string
+	backoff    time.Duration
+	maxBackoff time.Duration
+	max        int
+}
+
+//Next return the backoff before next restart, false if the task should not be restarted
+func (r *RestartPolicy) Next(err error, restarts int) (time.Duration, bool) {
+	switch r.policy {
+	case RestartAlways:
+	case RestartOnFailure:
+		if err == nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	if r.max > 0 && restarts >= r.max {
+		return 0, false
+	}
+	backoff := r.backoff
+	for i := 0; i < restarts && backoff < r.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.maxBackoff {
+		backoff = r.maxBackoff
+	}
+	return backoff, true
+}
+
+func NewRestartPolicy(p athena.Properties) (*RestartPolicy, error) {
+	policy := p.GetString(RestartProperty)
+	switch policy {
+	case RestartNever, RestartAlways, RestartOnFailure:
+	default:
+		return nil, errors.WithMessage(ErrUnknownRestartPolicy, policy)
+	}
+	return &RestartPolicy{
+		policy:     policy,
+		backoff:    p.GetDuration(RestartBackoffProperty),
+		maxBackoff: p.GetDuration(RestartMaxBackoffProperty),
+		max:        p.GetInt(RestartMaxProperty),
+	}, nil
+}
@@ -0,0 +1,36 @@
+package task
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRestartPolicyNext(t *testing.T) {
+	failure := fmt.Errorf("failure")
+	tests := []struct {
+		name     string
+		policy   RestartPolicy
+		err      error
+		restarts int
+		backoff  time.Duration
+		restart  bool
+	}{
+		{"never", RestartPolicy{policy: RestartNever, backoff: time.Second, maxBackoff: time.Minute}, failure, 0, 0, false},
+		{"on-failure complete", RestartPolicy{policy: RestartOnFailure, backoff: time.Second, maxBackoff: time.Minute}, nil, 0, 0, false},
+		{"on-failure first", RestartPolicy{policy: RestartOnFailure, backoff: time.Second, maxBackoff: time.Minute}, failure, 0, time.Second, true},
+		{"always complete", RestartPolicy{policy: RestartAlways, backoff: time.Second, maxBackoff: time.Minute}, nil, 0, time.Second, true},
+		{"doubled", RestartPolicy{policy: RestartAlways, backoff: time.Second, maxBackoff: time.Minute}, failure, 3, 8 * time.Second, true},
+		{"max backoff", RestartPolicy{policy: RestartAlways, backoff: time.Second, maxBackoff: time.Minute}, failure, 6, time.Minute, true},
+		{"no overflow", RestartPolicy{policy: RestartAlways, backoff: time.Second, maxBackoff: time.Minute}, failure, 1000, time.Minute, true},
+		{"backoff over max", RestartPolicy{policy: RestartAlways, backoff: time.Hour, maxBackoff: time.Minute}, failure, 0, time.Minute, true},
+		{"under max restarts", RestartPolicy{policy: RestartAlways, backoff: time.Second, maxBackoff: time.Minute, max: 3}, failure, 2, 4 * time.Second, true},
+		{"max restarts", RestartPolicy{policy: RestartAlways, backoff: time.Second, maxBackoff: time.Minute, max: 3}, failure, 3, 0, false},
+	}
+	for _, test := range tests {
+		backoff, restart := test.policy.Next(test.err, test.restarts)
+		if backoff != test.backoff || restart != test.restart {
+			t.Fatalf("%s: expected %v %v, got %v %v", test.name, test.backoff, test.restart, backoff, restart)
+		}
+	}
+}
@@ -2,18 +2,63 @@ package task
 
 import (
 	"athena/athena"
+	"athena/lib/runtime/checkpoint"
+	"fmt"
 )
 
+//ErrSinkFailed is the failure of sink without error, like the failed channel is closed
+var ErrSinkFailed = fmt.Errorf("sink failed")
+
 type SinkTask struct {
 	athena.Sink
-	Ctx athena.Context
+	Status
+	Ctx        athena.Context
+	Checkpoint *checkpoint.Coordinator
+
+	gate gate
+}
+
+//GenerateEmit blocks upstream while the sink is not running
+func (s *SinkTask) GenerateEmit(upstreamCtx athena.Context) athena.Emit {
+	return s.gate.guard(s.Ctx.Done(), s.Sink.GenerateEmit(upstreamCtx))
 }
 
 func (s *SinkTask) Run() error {
+	s.set(Opening)
 	if err := s.Open(s.Ctx); err != nil {
-		return err
+		return s.fail(err)
+	}
+	if err := restore(s.Checkpoint, s.Ctx, s.Sink, &s.gate); err != nil {
+		_ = s.Close()
+		return s.fail(err)
+	}
+	var failed <-chan error
+	if failing, ok := s.Sink.(athena.Failing); ok {
+		failed = failing.Failed()
+	}
+	s.set(Running)
+	s.gate.open()
+	//Sink does not block, so wait until done or failed
+	var err error
+	select {
+	case <-s.Ctx.Done():
+	case err = <-failed:
+		if err == nil {
+			err = ErrSinkFailed
+		}
+	}
+	s.gate.close()
+	s.set(Closing)
+	if err != nil {
+		_ = s.Close()
+		return s.fail(err)
+	}
+	if err = s.Close(); err != nil {
+		return s.fail(err)
+	}
+	if err = snapshot(s.Checkpoint, s.Ctx, s.Sink); err != nil {
+		return s.fail(err)
 	}
-	//Sink does not block, so wait
-	<-s.Ctx.Done()
-	return s.Close()
+	s.set(Closed)
+	return nil
 }
@@ -0,0 +1,91 @@
+package task
+
+import (
+	"athena/athena"
+	"athena/lib/context"
+	_c "context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+//failingSink fail at runtime when failure is sent
+type failingSink struct {
+	failed   chan error
+	received chan *athena.Event
+	opens    int
+}
+
+func (f *failingSink) Open(_ athena.Context) error {
+	f.opens++
+	f.failed = make(chan error, 1)
+	return nil
+}
+
+func (f *failingSink) Close() error {
+	return nil
+}
+
+func (f *failingSink) PropertiesDef() athena.PropertiesDef {
+	return athena.PropertiesDef{}
+}
+
+func (f *failingSink) GenerateEmit(_ athena.Context) athena.Emit {
+	return func(event *athena.Event) {
+		f.received <- event
+	}
+}
+
+func (f *failingSink) Failed() <-chan error {
+	return f.failed
+}
+
+func TestSinkTaskFailed(t *testing.T) {
+	ctx := context.New(_c.Background(), nil)
+	defer ctx.Cancel()
+	sink := &failingSink{received: make(chan *athena.Event, 1)}
+	s := &SinkTask{Sink: sink, Ctx: ctx}
+	emit := s.GenerateEmit(ctx)
+
+	result := make(chan error, 1)
+	go func() { result <- s.Run() }()
+	emit(&athena.Event{Message: 1})
+	<-sink.received
+	failure := fmt.Errorf("connection lost")
+	sink.failed <- failure
+	if err := <-result; !errors.Is(err, failure) || s.State() != Failed || s.Err() != failure {
+		t.Fatalf("sink failure is not reported, err %v state %s", err, s.State())
+	}
+
+	//upstream is blocked until the sink is reopened
+	emitted := make(chan struct{})
+	go func() {
+		emit(&athena.Event{Message: 2})
+		close(emitted)
+	}()
+	select {
+	case <-emitted:
+		t.Fatal("event is emitted to failed sink")
+	case <-time.After(50 * time.Millisecond):
+	}
+	go func() { result <- s.Run() }()
+	if event := <-sink.received; event.Message != 2 || sink.opens != 2 {
+		t.Fatalf("blocked event is not emitted after reopen, got %v opens %d", event.Message, sink.opens)
+	}
+	<-emitted
+
+	//closed failed channel is a failure too
+	close(sink.failed)
+	if err := <-result; err != ErrSinkFailed {
+		t.Fatalf("expected %v, got %v", ErrSinkFailed, err)
+	}
+	go func() { result <- s.Run() }()
+	for s.State() != Running {
+		time.Sleep(time.Millisecond)
+	}
+	ctx.Cancel()
+	if err := <-result; err != nil || s.State() != Closed {
+		t.Fatalf("sink is not closed, err %v state %s", err, s.State())
+	}
+}
@@ -2,21 +2,71 @@ package task
 
 import (
 	"athena/athena"
+	"athena/lib/runtime/checkpoint"
+	"sync/atomic"
+	"time"
 )
 
 type SourceTask struct {
 	athena.Source
-	Ctx      athena.Context
-	EmitNext athena.EmitNext
-	Name     string
+	Status
+	Ctx        athena.Context
+	EmitNext   athena.EmitNext
+	Name       string
+	Checkpoint *checkpoint.Coordinator
+
+	lastEmit int64
+	pending  int64
+	//gate pause the emits of source, it's always open
+	gate gate
+}
+
+//Pending return the number of emitted events waiting for ack
+func (s *SourceTask) Pending() int64 {
+	return atomic.LoadInt64(&s.pending)
+}
+
+//Idle return the duration since source last emitted, or since it started running
+func (s *SourceTask) Idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&s.lastEmit)))
+}
+
+func (s *SourceTask) emitNext(event *athena.Event, handler athena.ACKHandler) {
+	atomic.StoreInt64(&s.lastEmit, time.Now().UnixNano())
+	if handler != nil {
+		atomic.AddInt64(&s.pending, 1)
+		ackHandler := handler
+		handler = func() {
+			atomic.AddInt64(&s.pending, -1)
+			ackHandler()
+		}
+	}
+	s.gate.pass(func() { s.EmitNext(event, handler) })
 }
 
 func (s *SourceTask) Run() error {
+	s.set(Opening)
 	if err := s.Open(s.Ctx); err != nil {
-		return err
+		return s.fail(err)
+	}
+	if err := restore(s.Checkpoint, s.Ctx, s.Source, &s.gate); err != nil {
+		_ = s.Close()
+		return s.fail(err)
+	}
+	atomic.StoreInt64(&s.lastEmit, time.Now().UnixNano())
+	s.set(Running)
+	err := s.Collect(s.emitNext)
+	s.set(Closing)
+	if err != nil {
+		_ = s.Close()
+		return s.fail(err)
+	}
+	if err = s.Close(); err != nil {
+		return s.fail(err)
 	}
-	if err := s.Collect(s.EmitNext); err != nil {
-		return err
+	if err = snapshot(s.Checkpoint, s.Ctx, s.Source); err != nil {
+		return s.fail(err)
 	}
-	return s.Close()
+	s.set(Closed)
+	return nil
 }
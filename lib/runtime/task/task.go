@@ -0,0 +1,154 @@
+package task
+
+import (
+	"athena/athena"
+	"athena/lib/runtime/checkpoint"
+	"sync"
+	"sync/atomic"
+)
+
+type State int32
+
+const (
+	Created State = iota
+	Opening
+	Running
+	Closing
+	Closed
+	Failed
+)
+
+var stateNames = [...]string{"created", "opening", "running", "closing", "closed", "failed"}
+
+func (s State) String() string {
+	return stateNames[s]
+}
+
+type failure struct {
+	err error
+}
+
+//Status is task lifecycle state, it is safe for concurrent use
+type Status struct {
+	state   int32
+	failure atomic.Value
+}
+
+func (s *Status) State() State {
+	return State(atomic.LoadInt32(&s.state))
+}
+
+//Err return the error of last failure
+func (s *Status) Err() error {
+	if f, ok := s.failure.Load().(failure); ok {
+		return f.err
+	}
+	return nil
+}
+
+func (s *Status) set(state State) {
+	atomic.StoreInt32(&s.state, int32(state))
+}
+
+func (s *Status) fail(err error) error {
+	s.failure.Store(failure{err})
+	s.set(Failed)
+	return err
+}
+
+//restore component state after open if component is stateful, checkpoint pause the task by gate
+func restore(coordinator *checkpoint.Coordinator, ctx athena.Context, component athena.Component, gate *gate) error {
+	if stateful, ok := component.(athena.Stateful); ok && coordinator != nil {
+		return coordinator.Restore(ctx.Name(), stateful, gate)
+	}
+	return nil
+}
+
+//snapshot component state after close if component is stateful
+func snapshot(coordinator *checkpoint.Coordinator, ctx athena.Context, component athena.Component) error {
+	if stateful, ok := component.(athena.Stateful); ok && coordinator != nil {
+		return coordinator.Snapshot(ctx.Name(), stateful)
+	}
+	return nil
+}
+
+//gate blocks upstream emits while the task is not running, e.g. opening or restarting
+type gate struct {
+	mutex sync.RWMutex
+	ready chan struct{}
+	//emitting is read locked by in flight emits, and locked while paused
+	emitting sync.RWMutex
+}
+
+func (g *gate) channel() chan struct{} {
+	g.mutex.RLock()
+	ready := g.ready
+	g.mutex.RUnlock()
+	if ready != nil {
+		return ready
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.ready == nil {
+		g.ready = make(chan struct{})
+	}
+	return g.ready
+}
+
+//wait until the gate opened, return false if done first
+func (g *gate) wait(done <-chan struct{}) bool {
+	select {
+	case <-g.channel():
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (g *gate) open() {
+	ready := g.channel()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	select {
+	case <-ready:
+	default:
+		close(ready)
+	}
+}
+
+func (g *gate) close() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.ready != nil {
+		select {
+		case <-g.ready:
+			g.ready = make(chan struct{})
+		default:
+		}
+	}
+}
+
+//Pause block emits and wait the in flight ones
+func (g *gate) Pause() {
+	g.emitting.Lock()
+}
+
+func (g *gate) Resume() {
+	g.emitting.Unlock()
+}
+
+//pass emit the event, blocking while paused
+func (g *gate) pass(emit func()) {
+	g.emitting.RLock()
+	defer g.emitting.RUnlock()
+	emit()
+}
+
+//guard wrap emit, blocking while the gate is closed or paused and dropping event after done
+func (g *gate) guard(done <-chan struct{}, emit athena.Emit) athena.Emit {
+	return func(event *athena.Event) {
+		if g.wait(done) {
+			g.pass(func() { emit(event) })
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package task
+
+import (
+	"athena/athena"
+	"testing"
+	"time"
+)
+
+func TestGatePause(t *testing.T) {
+	g := &gate{}
+	g.open()
+	entered, release := make(chan struct{}), make(chan struct{})
+	emitted := make(chan int, 2)
+	emit := g.guard(nil, func(event *athena.Event) {
+		if event.Message == 1 {
+			close(entered)
+			<-release
+		}
+		emitted <- event.Message.(int)
+	})
+	go emit(&athena.Event{Message: 1})
+	<-entered
+	//pause wait the in flight emit
+	paused := make(chan struct{})
+	go func() {
+		g.Pause()
+		close(paused)
+	}()
+	select {
+	case <-paused:
+		t.Fatal("paused with emit in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-paused
+	if message := <-emitted; message != 1 {
+		t.Fatalf("expected in flight event 1, got %d", message)
+	}
+	//emits are blocked until resumed
+	go emit(&athena.Event{Message: 2})
+	select {
+	case message := <-emitted:
+		t.Fatalf("event %d is emitted while paused", message)
+	case <-time.After(50 * time.Millisecond):
+	}
+	g.Resume()
+	if message := <-emitted; message != 2 {
+		t.Fatalf("expected event 2 after resume, got %d", message)
+	}
+}
@@ -0,0 +1,224 @@
+package trace
+
+import (
+	"athena/athena"
+	_c "context"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	tracerName   = "athena"
+	contextKey   = attribute.Key("athena.context")
+	ackKey       = attribute.Key("athena.ack")
+	ExporterOTLP = "otlp"
+	ExporterFile = "file"
+)
+
+var (
+	ErrUnknownExporter = fmt.Errorf("unknown trace exporter")
+
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	//file is the file of file exporter, closed on shutdown
+	file *os.File
+)
+
+//Options is the tracing options, tracing is disabled if exporter is empty
+type Options struct {
+	Exporter    string
+	Endpoint    string
+	Insecure    bool
+	File        string
+	SampleRatio float64
+}
+
+//spans is the trace state carried by event in Private, it's shared by outputs and acked concurrently
+type spans struct {
+	//root is ended when source event acked
+	root  trace.Span
+	mutex sync.Mutex
+	//components is the hop span keyed by component name, the root is of source
+	components map[string]trace.Span
+	nacked     bool
+}
+
+//span return the hop span of the component, or root if the component is not traced
+func (s *spans) span(name string) trace.Span {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if span, ok := s.components[name]; ok {
+		return span
+	}
+	return s.root
+}
+
+func (s *spans) setSpan(name string, span trace.Span) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.components[name] = span
+}
+
+func (s *spans) nack() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nacked = true
+}
+
+func (s *spans) isNacked() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.nacked
+}
+
+func load(event *athena.Event) *spans {
+	if event.Private == nil {
+		return nil
+	}
+	if s, ok := event.Private[athena.PrivateTrace].(*spans); ok {
+		return s
+	}
+	return nil
+}
+
+func store(event *athena.Event, s *spans) {
+	if event.Private == nil {
+		event.Private = map[string]any{}
+	}
+	event.Private[athena.PrivateTrace] = s
+}
+
+func Setup(options Options) error {
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch options.Exporter {
+	case "":
+		return nil
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(options.Endpoint)}
+		if options.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(_c.Background(), opts...)
+	case ExporterFile:
+		file, err = os.OpenFile(options.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return errors.WithMessage(ErrUnknownExporter, options.Exporter)
+	}
+	if err != nil {
+		return errors.WithMessage(err, "can't create trace exporter")
+	}
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(tracerName))),
+	)
+	tracer = provider.Tracer(tracerName)
+	return nil
+}
+
+//Shutdown flush and export all ended spans, and close the file of file exporter
+func Shutdown(timeout time.Duration) error {
+	if provider == nil {
+		return nil
+	}
+	ctx, cancel := _c.WithTimeout(_c.Background(), timeout)
+	defer cancel()
+	err := provider.Shutdown(ctx)
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		file = nil
+	}
+	return err
+}
+
+//WrapSourceEmitNext start the root span of sampled source events, which is ended at ack time
+func WrapSourceEmitNext(ctx athena.Context, emitNext athena.EmitNext) athena.EmitNext {
+	if tracer == nil {
+		return emitNext
+	}
+	return func(event *athena.Event, handler athena.ACKHandler) {
+		_, root := tracer.Start(_c.Background(), ctx.Name(), trace.WithAttributes(contextKey.String(ctx.Name())))
+		if !root.SpanContext().IsSampled() {
+			emitNext(event, handler)
+			return
+		}
+		s := &spans{root: root, components: map[string]trace.Span{ctx.Name(): root}}
+		store(event, s)
+		if handler == nil {
+			emitNext(event, nil)
+			root.End()
+			return
+		}
+		emitNext(event, func() {
+			if s.isNacked() {
+				root.SetAttributes(ackKey.Bool(false))
+				root.SetStatus(codes.Error, "nacked")
+			} else {
+				root.SetAttributes(ackKey.Bool(true))
+			}
+			root.End()
+			handler()
+		})
+	}
+}
+
+//WrapEmitGenerator record a span of every sampled event hop on the component
+func WrapEmitGenerator(ctx athena.Context, generator athena.EmitGenerator) athena.EmitGenerator {
+	if tracer == nil {
+		return generator
+	}
+	return func(upstreamCtx athena.Context) athena.Emit {
+		emit := generator(upstreamCtx)
+		return func(event *athena.Event) {
+			s := load(event)
+			if s == nil {
+				emit(event)
+				return
+			}
+			parent := s.span(upstreamCtx.Name())
+			_, span := tracer.Start(trace.ContextWithSpan(_c.Background(), parent), ctx.Name(),
+				trace.WithAttributes(contextKey.String(ctx.Name()), attribute.String("athena.upstream", upstreamCtx.Name())))
+			s.setSpan(ctx.Name(), span)
+			emit(event)
+			span.End()
+		}
+	}
+}
+
+//ACKObserver record ack outcome of the component as a child span of its hop span,
+//as the hop span is usually ended before asynchronous ack
+func ACKObserver(ctx athena.Context) athena.ACKObserver {
+	return func(event *athena.Event, ok bool) {
+		s := load(event)
+		if s == nil {
+			return
+		}
+		_, span := tracer.Start(trace.ContextWithSpan(_c.Background(), s.span(ctx.Name())), ctx.Name()+" ack",
+			trace.WithAttributes(contextKey.String(ctx.Name()), ackKey.Bool(ok)))
+		if !ok {
+			span.SetStatus(codes.Error, "nacked")
+			s.nack()
+		}
+		span.End()
+	}
+}
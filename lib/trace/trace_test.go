@@ -0,0 +1,99 @@
+package trace
+
+import (
+	"athena/athena"
+	"athena/lib/context"
+	"athena/lib/properties"
+	_c "context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestACKObserver(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(tracerName)
+	defer func() { tracer = nil }()
+
+	config := filepath.Join(t.TempDir(), "athena.toml")
+	if err := os.WriteFile(config, []byte("[source]\ntype = \"s\"\n[a]\ntype = \"a\"\n[b]\ntype = \"b\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ps, err := properties.New(config, properties.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := context.New(_c.Background(), ps)
+	source, a, b := root.Named("source"), root.Named("a"), root.Named("b")
+	acked := make(chan struct{})
+	var wait sync.WaitGroup
+	//a acks synchronously, b acks after its hop span is ended
+	emitA := WrapEmitGenerator(a, func(_ athena.Context) athena.Emit {
+		return func(event *athena.Event) {
+			ACKObserver(a)(event, true)
+		}
+	})(source)
+	emitB := WrapEmitGenerator(b, func(_ athena.Context) athena.Emit {
+		return func(event *athena.Event) {
+			wait.Add(1)
+			go func() {
+				defer wait.Done()
+				ACKObserver(b)(event, false)
+			}()
+		}
+	})(source)
+	emitNext := WrapSourceEmitNext(source, func(event *athena.Event, handler athena.ACKHandler) {
+		emitA(event)
+		emitB(event)
+		wait.Wait()
+		handler()
+	})
+	emitNext(&athena.Event{}, func() { close(acked) })
+	select {
+	case <-acked:
+	case <-time.After(time.Second):
+		t.Fatal("source handler is not called")
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	if len(spans) != 5 {
+		t.Fatalf("expected 5 spans, got %d", len(spans))
+	}
+	for _, name := range []string{"a", "b"} {
+		if spans[name].Parent().SpanID() != spans["source"].SpanContext().SpanID() {
+			t.Fatalf("%s hop span is not child of source", name)
+		}
+		if spans[name+" ack"].Parent().SpanID() != spans[name].SpanContext().SpanID() {
+			t.Fatalf("%s ack is not attached to its hop span", name)
+		}
+	}
+	if spans["b ack"].Status().Description != "nacked" || spans["source"].Status().Description != "nacked" {
+		t.Fatal("nack is not recorded")
+	}
+}
+
+func TestShutdownCloseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+	if err := Setup(Options{Exporter: ExporterFile, File: path, SampleRatio: 1}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { provider, tracer = nil, nil }()
+	opened := file
+	if err := Shutdown(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if file != nil || opened.Close() == nil {
+		t.Fatal("trace file is not closed")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@ package constant
 
 import (
 	"athena/lib/properties"
+	"time"
 )
 
 var (
@@ -9,7 +10,28 @@ var (
 
 	RuntimeModeProperty      = properties.NewProperty[string]("mode", "athena work mode, ack or snapshot.", "ack")
 	RuntimeLogLevelProperty  = properties.NewRequiredProperty[string]("log-level", "log-level")
-	RuntimeStatusDirProperty = properties.NewProperty[string]("status-dir", "status-dir", ".")
+	RuntimeLogFormatProperty = properties.NewProperty[string]("log-format", "log encoding, console or json.", "console")
+	RuntimeLogLevelsProperty = properties.NewProperty[map[string]any]("log-levels", "log level overrides keyed by context name, like operator.aggregate = \"debug\".", map[string]any{})
+
+	RuntimeLogFileProperty               = properties.NewProperty[string]("log-file", "log output file, standard output and error if empty.", "")
+	RuntimeLogFileMaxSizeProperty        = properties.NewProperty[int]("log-file-max-size", "log file max megabytes before rotated.", 100)
+	RuntimeLogFileMaxAgeProperty         = properties.NewProperty[int]("log-file-max-age", "max days to retain rotated log files.", 7)
+	RuntimeLogFileMaxBackupsProperty     = properties.NewProperty[int]("log-file-max-backups", "max rotated log files to retain, retain all if zero.", 0)
+	RuntimeLogFileRotateIntervalProperty = properties.NewProperty[time.Duration]("log-file-rotate-interval", "rotate log file periodically, disabled if zero.", 0)
+	RuntimeLogFileCompressProperty       = properties.NewProperty[bool]("log-file-compress", "gzip rotated log files.", false)
+	RuntimeStatusDirProperty             = properties.NewProperty[string]("status-dir", "status-dir", ".")
+
+	RuntimeMetricsAddressProperty   = properties.NewProperty[string]("metrics-address", "prometheus metrics listen address, disabled if empty.", "")
+	RuntimeMetricsPathProperty      = properties.NewProperty[string]("metrics-path", "prometheus metrics http path.", "/metrics")
+	RuntimeAdminAddressProperty     = properties.NewProperty[string]("admin-address", "admin api listen address, disabled if empty.", "")
+	RuntimeHealthAddressProperty    = properties.NewProperty[string]("health-address", "healthz and readyz probes listen address, disabled if empty.", "")
+	RuntimeSourceIdleProperty       = properties.NewProperty[time.Duration]("source-idle-timeout", "liveness fails if a source emits nothing for this period, disabled if zero.", 0)
+	RuntimeTraceExporterProperty    = properties.NewProperty[string]("trace-exporter", "trace exporter, otlp or file, disabled if empty.", "")
+	RuntimeTraceEndpointProperty    = properties.NewProperty[string]("trace-endpoint", "otlp http endpoint host:port.", "localhost:4318")
+	RuntimeTraceInsecureProperty    = properties.NewProperty[bool]("trace-insecure", "otlp http without tls.", false)
+	RuntimeTraceFileProperty        = properties.NewProperty[string]("trace-file", "file exporter output path, json per span.", "trace.json")
+	RuntimeTraceSampleRatioProperty = properties.NewProperty[float64]("trace-sample-ratio", "ratio of source events to trace.", 1.0)
+	RuntimeDrainTimeoutProperty     = properties.NewProperty[time.Duration]("drain-timeout", "graceful drain timeout on shutdown, force stop after exceeded.", 30*time.Second)
 
 	//component property
 
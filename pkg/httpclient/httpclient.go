@@ -0,0 +1,77 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const maxRedirects = 10
+
+var ErrTooManyRedirects = fmt.Errorf("stopped after %d redirects", maxRedirects)
+
+//StatusError is returned by Do when response status code is not 2xx
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("StatusCode: %d\r\nBody: %s", e.StatusCode, string(e.Body))
+}
+
+//Options is the options of client
+type Options struct {
+	Timeout           time.Duration
+	DisableKeepAlives bool
+	MaxConnsPerHost   int
+	//BasicAuth is set on the redirected request if user is not empty
+	User     string
+	Password string
+}
+
+//Transport clone the default transport with options
+func Transport(options Options) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = options.DisableKeepAlives
+	transport.MaxConnsPerHost = options.MaxConnsPerHost
+	return transport
+}
+
+//New create client with the round tripper, nil round tripper uses Transport(options)
+func New(options Options, roundTripper http.RoundTripper) *http.Client {
+	if roundTripper == nil {
+		roundTripper = Transport(options)
+	}
+	return &http.Client{
+		Transport: roundTripper,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return ErrTooManyRedirects
+			}
+			if options.User != "" {
+				req.SetBasicAuth(options.User, options.Password)
+			}
+			return nil
+		},
+		Timeout: options.Timeout,
+	}
+}
+
+//Do send request and read the whole response body, error is *StatusError if status code is not 2xx
+func Do(client *http.Client, req *http.Request) ([]byte, error) {
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return body, &StatusError{StatusCode: res.StatusCode, Body: body}
+	}
+	return body, nil
+}
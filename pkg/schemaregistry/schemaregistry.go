@@ -0,0 +1,126 @@
+package schemaregistry
+
+import (
+	"athena/pkg/httpclient"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	TypeAvro     = "AVRO"
+	TypeProtobuf = "PROTOBUF"
+	TypeJSON     = "JSON"
+
+	//magicByte is the first byte of confluent wire format
+	magicByte = 0
+	//headerSize is magic byte and 4 bytes big endian schema id
+	headerSize = 5
+)
+
+var ErrWireFormat = fmt.Errorf("not confluent wire format")
+
+//Reference is a schema imported by another schema
+type Reference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+//Schema is the registered schema, Type is empty for avro as registry omits it
+type Schema struct {
+	ID         int         `json:"id"`
+	Type       string      `json:"schemaType"`
+	Schema     string      `json:"schema"`
+	References []Reference `json:"references"`
+}
+
+//Client get schemas from confluent compatible schema registry, schemas are cached forever as they are immutable
+type Client struct {
+	url      string
+	user     string
+	password string
+	client   *http.Client
+	mutex    sync.Mutex
+	ids      map[int]*Schema
+	versions map[Reference]*Schema
+}
+
+//New create client of registry url, nil round tripper uses httpclient.Transport(options)
+func New(registryUrl string, options httpclient.Options, roundTripper http.RoundTripper) *Client {
+	return &Client{
+		url:      strings.TrimRight(registryUrl, "/"),
+		user:     options.User,
+		password: options.Password,
+		client:   httpclient.New(options, roundTripper),
+		ids:      map[int]*Schema{},
+		versions: map[Reference]*Schema{},
+	}
+}
+
+//Schema get schema by id
+func (c *Client) Schema(id int) (*Schema, error) {
+	c.mutex.Lock()
+	schema, ok := c.ids[id]
+	c.mutex.Unlock()
+	if ok {
+		return schema, nil
+	}
+	schema = &Schema{}
+	if err := c.get(fmt.Sprintf("/schemas/ids/%d", id), schema); err != nil {
+		return nil, errors.WithMessagef(err, "can't get schema %d", id)
+	}
+	schema.ID = id
+	c.mutex.Lock()
+	c.ids[id] = schema
+	c.mutex.Unlock()
+	return schema, nil
+}
+
+//Reference get the schema of reference subject version
+func (c *Client) Reference(reference Reference) (*Schema, error) {
+	key := Reference{Subject: reference.Subject, Version: reference.Version}
+	c.mutex.Lock()
+	schema, ok := c.versions[key]
+	c.mutex.Unlock()
+	if ok {
+		return schema, nil
+	}
+	schema = &Schema{}
+	if err := c.get(fmt.Sprintf("/subjects/%s/versions/%d", url.PathEscape(reference.Subject), reference.Version), schema); err != nil {
+		return nil, errors.WithMessagef(err, "can't get schema of subject %s version %d", reference.Subject, reference.Version)
+	}
+	c.mutex.Lock()
+	c.versions[key] = schema
+	c.mutex.Unlock()
+	return schema, nil
+}
+
+func (c *Client) get(path string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, c.url+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	body, err := httpclient.Do(c.client, req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+//ParseWireFormat split confluent wire format data into schema id and payload
+func ParseWireFormat(data []byte) (int, []byte, error) {
+	if len(data) < headerSize || data[0] != magicByte {
+		return 0, nil, ErrWireFormat
+	}
+	return int(binary.BigEndian.Uint32(data[1:headerSize])), data[headerSize:], nil
+}
@@ -0,0 +1,127 @@
+package schemaregistry
+
+import (
+	"athena/pkg/httpclient"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+//newServer serve the schemas, requests without basic auth user:password are unauthorized if user is set
+func newServer(t *testing.T, user string, password string) (*httptest.Server, *int32) {
+	requests := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if r.Header.Get("Accept") != "application/vnd.schemaregistry.v1+json" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		if u, p, ok := r.BasicAuth(); user != "" && (!ok || u != user || p != password) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		//subjects are path escaped
+		switch r.URL.EscapedPath() {
+		case "/schemas/ids/7":
+			_, _ = w.Write([]byte(`{"schema":"syntax = \"proto3\";","schemaType":"PROTOBUF","references":[{"name":"a.proto","subject":"a/b","version":1}]}`))
+		case "/schemas/ids/8":
+			_, _ = w.Write([]byte(`{"schema":"\"string\""}`))
+		case "/subjects/a%2Fb/versions/1":
+			_, _ = w.Write([]byte(`{"id":3,"schema":"syntax = \"proto3\";","schemaType":"PROTOBUF"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestClient(t *testing.T) {
+	server, requests := newServer(t, "", "")
+	client := New(server.URL+"/", httpclient.Options{}, nil)
+
+	schema, err := client.Schema(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.ID != 7 || schema.Type != TypeProtobuf || len(schema.References) != 1 {
+		t.Fatalf("unexpected schema %+v", schema)
+	}
+	//avro type is omitted
+	if schema, err = client.Schema(8); err != nil || schema.ID != 8 || schema.Type != "" || schema.Schema != `"string"` {
+		t.Fatalf("unexpected schema %+v, err %v", schema, err)
+	}
+	reference, err := client.Reference(Reference{Name: "a.proto", Subject: "a/b", Version: 1})
+	if err != nil || reference.ID != 3 {
+		t.Fatalf("unexpected reference %+v, err %v", reference, err)
+	}
+	//schemas are cached by id and subject version, reference name is not a part of key
+	count := atomic.LoadInt32(requests)
+	if _, err = client.Schema(7); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Reference(Reference{Name: "other.proto", Subject: "a/b", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(requests) != count {
+		t.Fatalf("schemas are not cached, requests %d", atomic.LoadInt32(requests)-count)
+	}
+	//errors are not cached
+	for i := 0; i < 2; i++ {
+		var statusErr *httpclient.StatusError
+		if _, err = client.Schema(9); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+			t.Fatalf("expect not found, got %v", err)
+		}
+	}
+	if atomic.LoadInt32(requests) != count+2 {
+		t.Fatalf("failed schema is cached, requests %d", atomic.LoadInt32(requests)-count)
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	server, _ := newServer(t, "user", "secret")
+	tests := []struct {
+		user     string
+		password string
+		status   int
+	}{
+		{user: "user", password: "secret"},
+		{user: "user", password: "wrong", status: http.StatusUnauthorized},
+		{status: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		client := New(server.URL, httpclient.Options{User: test.user, Password: test.password}, nil)
+		_, err := client.Schema(7)
+		var statusErr *httpclient.StatusError
+		if test.status == 0 && err != nil || test.status != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != test.status) {
+			t.Fatalf("user %s password %s, expect status %d, got %v", test.user, test.password, test.status, err)
+		}
+	}
+}
+
+func TestParseWireFormat(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		id      int
+		payload string
+		err     error
+	}{
+		{data: []byte{0, 0, 0, 1, 2, 'x'}, id: 258, payload: "x"},
+		//big endian id
+		{data: []byte{0, 0x7f, 0xff, 0xff, 0xff}, id: 1<<31 - 1},
+		{data: []byte{1, 0, 0, 0, 1}, err: ErrWireFormat},
+		{data: []byte{0, 0, 0, 1}, err: ErrWireFormat},
+		{data: nil, err: ErrWireFormat},
+	}
+	for _, test := range tests {
+		id, payload, err := ParseWireFormat(test.data)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("data %x, expect %v, got %v", test.data, test.err, err)
+		}
+		if test.err == nil && (id != test.id || string(payload) != test.payload) {
+			t.Fatalf("data %x, expect %d %q, got %d %q", test.data, test.id, test.payload, id, payload)
+		}
+	}
+}